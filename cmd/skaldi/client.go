@@ -0,0 +1,515 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/reuski/skaldi/internal/client"
+	"github.com/reuski/skaldi/internal/player"
+	"github.com/reuski/skaldi/internal/resolver"
+	"github.com/reuski/skaldi/internal/server"
+)
+
+type clientCommand struct {
+	name string
+	args string
+	help string
+}
+
+var clientCommands = []clientCommand{
+	{name: "status", help: "show what is playing"},
+	{name: "queue", help: "list the queue with indices"},
+	{name: "add", args: "<url|query>", help: "add a URL, or the best search hit for a query"},
+	{name: "skip", help: "skip to the next track"},
+	{name: "pause", help: "pause playback"},
+	{name: "resume", help: "resume playback"},
+	{name: "volume", args: "<0-100>", help: "set the volume"},
+	{name: "seek", args: "<position>", help: "seek to seconds, by +/- seconds, or to a percentage (90, +15, 50%)"},
+	{name: "repeat", args: "<off|one|all>", help: "set the repeat mode"},
+	{name: "shuffle", args: "[off]", help: "shuffle the queue, or restore its order with off"},
+	{name: "order", args: "<append|fair>", help: "play requests as they come, or take turns between requesters"},
+	{name: "sound", args: "<preset>", help: "set the audio preset (flat, dynaudnorm, loudnorm, bass_boost, night)"},
+	{name: "eq", args: "<10 gains in dB>|off", help: "set the equalizer bands from 31 Hz to 16 kHz"},
+	{name: "device", args: "[name]", help: "list audio outputs, or switch to one"},
+	{name: "sleep", args: "<minutes>|tracks <n>|off", help: "pause after a while or after n tracks, fading out first"},
+	{name: "schedule", help: "list upcoming scheduled actions"},
+	{name: "move", args: "<from> <to>", help: "move a queue item"},
+	{name: "rm", args: "<index>", help: "remove a queue item"},
+}
+
+func findClientCommand(name string) (clientCommand, bool) {
+	for _, cmd := range clientCommands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return clientCommand{}, false
+}
+
+func runClient(cmd clientCommand, args []string, stdout, stderr io.Writer) int {
+	name := cmd.name
+	fs := flag.NewFlagSet("skaldi "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	serverURL := fs.String("server", envOr("SKALDI_SERVER", client.DefaultServerURL), "URL of the running Skaldi instance")
+	pin := fs.String("pin", os.Getenv("SKALDI_PIN"), "host PIN, required for host-only commands when auth is enabled")
+	insecure := fs.Bool("insecure", false, "skip TLS certificate verification")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: skaldi %s [flags] %s\n\nFlags:\n", name, cmd.args)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	c, err := client.New(*serverURL, *insecure)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	ctx := context.Background()
+	if *pin != "" {
+		if err := c.Login(ctx, *pin); err != nil {
+			fmt.Fprintf(stderr, "login failed: %v\n", err)
+			return 1
+		}
+	}
+
+	if err := runClientCommand(ctx, c, cmd, fs.Args(), stdout); err != nil {
+		fmt.Fprintln(stderr, err)
+		var usageErr usageError
+		if errors.As(err, &usageErr) {
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
+
+func runClientCommand(ctx context.Context, c *client.Client, cmd clientCommand, args []string, stdout io.Writer) error {
+	usage := usageError(fmt.Sprintf("usage: skaldi %s %s", cmd.name, cmd.args))
+
+	switch cmd.name {
+	case "status":
+		snap, err := c.Snapshot(ctx)
+		if err != nil {
+			return err
+		}
+		printStatus(stdout, snap)
+	case "queue":
+		snap, err := c.Snapshot(ctx)
+		if err != nil {
+			return err
+		}
+		printQueue(stdout, snap)
+	case "add":
+		if len(args) == 0 {
+			return usage
+		}
+		return addToQueue(ctx, c, strings.Join(args, " "), stdout)
+	case "skip":
+		return c.Playback(ctx, server.PlaybackRequest{Action: "skip"})
+	case "pause":
+		return c.Playback(ctx, server.PlaybackRequest{Action: "pause"})
+	case "resume":
+		return c.Playback(ctx, server.PlaybackRequest{Action: "resume"})
+	case "volume":
+		if len(args) != 1 {
+			return usage
+		}
+		value, err := strconv.ParseFloat(args[0], 64)
+		if err != nil {
+			return usageError(fmt.Sprintf("invalid volume: %s", args[0]))
+		}
+		return c.Playback(ctx, server.PlaybackRequest{Action: "set_volume", Value: &value})
+	case "seek":
+		if len(args) != 1 {
+			return usage
+		}
+		req, err := parseSeek(args[0])
+		if err != nil {
+			return err
+		}
+		return c.Playback(ctx, req)
+	case "repeat":
+		if len(args) != 1 {
+			return usage
+		}
+		if _, ok := player.ParseRepeatMode(args[0]); !ok {
+			return usageError(fmt.Sprintf("invalid repeat mode: %s", args[0]))
+		}
+		return c.Playback(ctx, server.PlaybackRequest{Action: "set_repeat", Mode: args[0]})
+	case "shuffle":
+		switch {
+		case len(args) == 0:
+			return c.Playback(ctx, server.PlaybackRequest{Action: "shuffle"})
+		case len(args) == 1 && args[0] == "off":
+			return c.Playback(ctx, server.PlaybackRequest{Action: "unshuffle"})
+		default:
+			return usage
+		}
+	case "order":
+		if len(args) != 1 {
+			return usage
+		}
+		if _, ok := player.ParseQueueOrder(args[0]); !ok {
+			return usageError(fmt.Sprintf("invalid queue order: %s", args[0]))
+		}
+		return c.Playback(ctx, server.PlaybackRequest{Action: "set_queue_order", Mode: args[0]})
+	case "sound":
+		if len(args) != 1 {
+			return usage
+		}
+		if _, ok := player.ParseAudioPreset(args[0]); !ok {
+			return usageError(fmt.Sprintf("invalid audio preset: %s", args[0]))
+		}
+		return c.Playback(ctx, server.PlaybackRequest{Action: "set_audio_preset", Preset: args[0]})
+	case "eq":
+		gains, err := parseEqualizer(args)
+		if err != nil {
+			return err
+		}
+		return c.Playback(ctx, server.PlaybackRequest{Action: "set_equalizer", Gains: gains})
+	case "device":
+		switch len(args) {
+		case 0:
+			return listAudioDevices(ctx, c, stdout)
+		case 1:
+			return c.Playback(ctx, server.PlaybackRequest{Action: "set_audio_device", Device: args[0]})
+		default:
+			return usage
+		}
+	case "sleep":
+		req, err := parseSleep(args)
+		if err != nil {
+			return err
+		}
+		return c.Playback(ctx, req)
+	case "schedule":
+		if len(args) != 0 {
+			return usage
+		}
+		schedule, err := c.Schedule(ctx)
+		if err != nil {
+			return err
+		}
+		printSchedule(stdout, schedule)
+		return nil
+	case "move":
+		if len(args) != 2 {
+			return usage
+		}
+		from, err1 := strconv.Atoi(args[0])
+		to, err2 := strconv.Atoi(args[1])
+		if err1 != nil || err2 != nil {
+			return usage
+		}
+		return c.Move(ctx, from, to)
+	case "rm":
+		if len(args) != 1 {
+			return usage
+		}
+		index, err := strconv.Atoi(args[0])
+		if err != nil {
+			return usageError(fmt.Sprintf("invalid index: %s", args[0]))
+		}
+		return c.Remove(ctx, index)
+	default:
+		return usageError(fmt.Sprintf("unknown command: %s", cmd.name))
+	}
+	return nil
+}
+
+// parseSeek turns "90", "+15", "-15" or "50%" into the matching seek action.
+func parseSeek(arg string) (server.PlaybackRequest, error) {
+	action := "seek"
+	number := arg
+	switch {
+	case strings.HasSuffix(arg, "%"):
+		action = "seek_percent"
+		number = strings.TrimSuffix(arg, "%")
+	case strings.HasPrefix(arg, "+"), strings.HasPrefix(arg, "-"):
+		action = "seek_relative"
+	}
+
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return server.PlaybackRequest{}, usageError(fmt.Sprintf("invalid seek position: %s", arg))
+	}
+	return server.PlaybackRequest{Action: action, Value: &value}, nil
+}
+
+// parseEqualizer reads one gain per band, or "off" for a flat response.
+func parseEqualizer(args []string) ([]float64, error) {
+	if len(args) == 1 && args[0] == "off" {
+		return nil, nil
+	}
+	if len(args) != len(player.EqualizerBands) {
+		return nil, usageError(fmt.Sprintf("eq takes %d gains or off", len(player.EqualizerBands)))
+	}
+
+	gains := make([]float64, len(args))
+	for i, arg := range args {
+		gain, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return nil, usageError(fmt.Sprintf("invalid gain: %s", arg))
+		}
+		gains[i] = gain
+	}
+	if err := player.ValidateEqualizer(gains); err != nil {
+		return nil, usageError(err.Error())
+	}
+	return gains, nil
+}
+
+// parseSleep reads a timer in minutes, "tracks <n>" to stop after n tracks
+// counting the current one, or "off" to cancel.
+func parseSleep(args []string) (server.PlaybackRequest, error) {
+	switch {
+	case len(args) == 1 && args[0] == "off":
+		return server.PlaybackRequest{Action: "cancel_sleep"}, nil
+	case len(args) == 1:
+		minutes, err := strconv.ParseFloat(args[0], 64)
+		if err != nil || minutes <= 0 {
+			return server.PlaybackRequest{}, usageError(fmt.Sprintf("invalid minutes: %s", args[0]))
+		}
+		return server.PlaybackRequest{Action: "sleep", Value: &minutes}, nil
+	case len(args) == 2 && args[0] == "tracks":
+		tracks, err := strconv.Atoi(args[1])
+		if err != nil || tracks < 1 {
+			return server.PlaybackRequest{}, usageError(fmt.Sprintf("invalid track count: %s", args[1]))
+		}
+		value := float64(tracks)
+		return server.PlaybackRequest{Action: "sleep_tracks", Value: &value}, nil
+	default:
+		return server.PlaybackRequest{}, usageError("sleep takes minutes, tracks <n>, or off")
+	}
+}
+
+func listAudioDevices(ctx context.Context, c *client.Client, stdout io.Writer) error {
+	devices, err := c.AudioDevices(ctx)
+	if err != nil {
+		return err
+	}
+	snap, err := c.Snapshot(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, device := range devices {
+		marker := " "
+		if device.Name == snap.AudioDevice {
+			marker = ">"
+		}
+		fmt.Fprintf(stdout, "%s %s  %s\n", marker, device.Name, device.Description)
+	}
+	return nil
+}
+
+func addToQueue(ctx context.Context, c *client.Client, input string, stdout io.Writer) error {
+	var (
+		result client.QueueResult
+		err    error
+	)
+
+	if looksLikeURL(input) {
+		result, err = c.QueueURL(ctx, input)
+	} else {
+		hits, searchErr := c.Search(ctx, input)
+		if searchErr != nil {
+			return searchErr
+		}
+		// Albums and artists are for browsing; add queues a single track.
+		top := slices.IndexFunc(hits, func(hit resolver.SearchHit) bool { return hit.Kind == "" })
+		if top < 0 {
+			return fmt.Errorf("no results for %q", input)
+		}
+		result, err = c.QueueHits(ctx, hits[top:top+1])
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, track := range result.Tracks {
+		fmt.Fprintf(stdout, "Queued %s\n", trackLabel(track.Title, track.Artist))
+	}
+	if result.Merged > 0 {
+		fmt.Fprintf(stdout, "Added %d vote(s) to tracks already queued\n", result.Merged)
+	}
+	for _, rejection := range result.Rejections {
+		fmt.Fprintf(stdout, "Skipped %s (%s)\n", rejection.Title, strings.ReplaceAll(rejection.Reason, "_", " "))
+	}
+	return nil
+}
+
+func looksLikeURL(input string) bool {
+	u, err := url.Parse(input)
+	return err == nil && u.Scheme != "" && (u.Host != "" || strings.HasPrefix(u.Scheme, "skaldi+"))
+}
+
+func printStatus(w io.Writer, snap player.Snapshot) {
+	fmt.Fprintf(w, "Status:   %s\n", snap.Status)
+	if snap.NowPlaying != nil {
+		fmt.Fprintf(w, "Playing:  %s\n", queueItemLabel(*snap.NowPlaying))
+		fmt.Fprintf(w, "Position: %s / %s\n", formatDuration(snap.CurrentTime), formatDuration(snap.Duration))
+	}
+	volume := fmt.Sprintf("%.0f", snap.Volume)
+	if snap.Muted {
+		volume += " (muted)"
+	}
+	fmt.Fprintf(w, "Volume:   %s\n", volume)
+	mode := "repeat " + string(snap.Repeat)
+	if snap.Shuffle {
+		mode += ", shuffled"
+	}
+	if snap.QueueOrder == player.OrderFair {
+		mode += ", fair queue"
+	}
+	fmt.Fprintf(w, "Mode:     %s\n", mode)
+	sound := string(snap.AudioPreset)
+	if len(snap.Equalizer) > 0 {
+		sound += " + equalizer"
+	}
+	fmt.Fprintf(w, "Sound:    %s\n", sound)
+	if snap.AudioDevice != "" {
+		fmt.Fprintf(w, "Output:   %s\n", snap.AudioDevice)
+	}
+	if snap.Sleep != nil {
+		fmt.Fprintf(w, "Sleep:    %s\n", sleepLabel(*snap.Sleep))
+	}
+	fmt.Fprintf(w, "Upcoming: %d\n", len(snap.Upcoming))
+}
+
+func sleepLabel(timer player.SleepTimer) string {
+	var parts []string
+	if timer.Tracks > 0 {
+		parts = append(parts, fmt.Sprintf("after %d track(s)", timer.Tracks))
+	}
+	if timer.Remaining > 0 {
+		parts = append(parts, "in "+formatDuration(timer.Remaining))
+	}
+	if len(parts) == 0 {
+		return "pending"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func printSchedule(w io.Writer, schedule client.Schedule) {
+	if schedule.VolumeCap != nil {
+		fmt.Fprintf(w, "Volume capped at %.0f\n", *schedule.VolumeCap)
+	}
+	if len(schedule.Upcoming) == 0 {
+		fmt.Fprintln(w, "Nothing scheduled")
+		return
+	}
+	for _, action := range schedule.Upcoming {
+		detail := action.Action
+		switch {
+		case action.Playlist != "":
+			detail += " " + action.Playlist
+		case action.URL != "":
+			detail += " " + action.URL
+		case action.MaxVolume != nil:
+			detail += fmt.Sprintf(" %.0f", *action.MaxVolume)
+		}
+		fmt.Fprintf(w, "%s  %-16s %s\n", action.At.Local().Format("Mon Jan 2 15:04"), action.Name, detail)
+	}
+}
+
+func printQueue(w io.Writer, snap player.Snapshot) {
+	if len(snap.Queue) == 0 {
+		fmt.Fprintln(w, "Queue is empty")
+		return
+	}
+	for i, item := range snap.Queue {
+		marker := " "
+		if i == snap.CurrentIdx {
+			marker = ">"
+		}
+		duration := ""
+		if item.Duration > 0 {
+			duration = "  " + formatDuration(item.Duration)
+		}
+		if item.Metadata != nil && item.Metadata.Autoplay {
+			duration += "  (radio)"
+		}
+		if item.Votes > 0 {
+			duration += fmt.Sprintf("  +%d", item.Votes)
+		}
+		if item.Pinned {
+			duration += "  (pinned)"
+		}
+		if item.Metadata != nil && item.Metadata.RequesterName != "" {
+			duration += "  by " + item.Metadata.RequesterName
+		}
+		fmt.Fprintf(w, "%s %3d  %s%s\n", marker, i, queueItemLabel(item), duration)
+	}
+}
+
+func queueItemLabel(item player.QueueItem) string {
+	if item.Metadata != nil {
+		return trackLabel(coalesce(item.Metadata.Title, item.Title, item.Filename), item.Metadata.Artist)
+	}
+	return coalesce(item.Title, item.Filename)
+}
+
+func trackLabel(title, artist string) string {
+	if artist == "" {
+		return title
+	}
+	return title + " - " + artist
+}
+
+func formatDuration(seconds float64) string {
+	total := int(seconds)
+	if total < 0 {
+		total = 0
+	}
+	if total >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", total/3600, (total/60)%60, total%60)
+	}
+	return fmt.Sprintf("%d:%02d", total/60, total%60)
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: skaldi [flags]            run the jukebox server")
+	fmt.Fprintln(w, "       skaldi <command> [flags]  control a running instance")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, cmd := range clientCommands {
+		fmt.Fprintf(w, "  %-8s %-12s %s\n", cmd.name, cmd.args, cmd.help)
+	}
+	fmt.Fprintln(w, "\nServer flags:")
+	flag.PrintDefaults()
+}
+
+func coalesce(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
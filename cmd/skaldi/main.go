@@ -4,6 +4,8 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
@@ -20,6 +22,26 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := findClientCommand(os.Args[1]); ok {
+			os.Exit(runClient(cmd, os.Args[2:], os.Stdout, os.Stderr))
+		}
+	}
+
+	var listen server.ListenOptions
+	flag.StringVar(&listen.Address, "addr", "", "IP address to listen on (default: all interfaces)")
+	flag.IntVar(&listen.Port, "port", 0, "port to listen on (default: 8080)")
+	flag.StringVar(&listen.CertFile, "tls-cert", "", "TLS certificate file; enables HTTPS together with -tls-key")
+	flag.StringVar(&listen.KeyFile, "tls-key", "", "TLS private key file")
+	flag.BoolVar(&listen.SelfSigned, "tls-self-signed", false, "serve HTTPS with a self-signed certificate kept in the cache dir")
+	flag.Usage = func() { printUsage(flag.CommandLine.Output()) }
+	flag.Parse()
+	if flag.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n\n", flag.Arg(0))
+		printUsage(os.Stderr)
+		os.Exit(2)
+	}
+
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
 	if err := bootstrap.Run(logger); err != nil {
@@ -42,13 +64,22 @@ func main() {
 	for _, warning := range res.Warnings() {
 		logger.Warn("Optional resolver source disabled", "error", warning)
 	}
+	mgr.SetResolver(res)
+
+	srv, err := server.New(cfg, logger, mgr, res, web.IndexHTML, listen)
+	if err != nil {
+		logger.Error("Failed to initialize server", "error", err)
+		os.Exit(1)
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	res.Start(ctx, logger)
 
-	const port = 8080
-
-	mdnsCleanup, mdnsActive := discovery.Register(ctx, logger, port)
+	mdnsCleanup, mdnsActive := func() {}, false
+	if srv.LANVisible() {
+		mdnsCleanup, mdnsActive = discovery.Register(ctx, logger, srv.Port(), srv.TLSEnabled())
+	}
 	defer mdnsCleanup()
 
 	playerDone := make(chan struct{})
@@ -60,8 +91,6 @@ func main() {
 		}
 	}()
 
-	srv := server.New(logger, mgr, res, web.IndexHTML, port)
-
 	go func() {
 		if err := srv.Start(mdnsActive); err != nil && err != http.ErrServerClosed {
 			logger.Error("Server failed", "error", err)
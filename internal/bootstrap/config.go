@@ -15,6 +15,7 @@ type Config struct {
 	UvBinDir   string
 	MpvSocket  string
 	DataDir    string
+	StateDir   string
 	ConfigPath string
 }
 
@@ -34,7 +35,8 @@ func LoadConfig() (*Config, error) {
 		}
 		dataDir = filepath.Join(home, ".local", "share")
 	}
-	historyDir := filepath.Join(dataDir, "skaldi", "history")
+	stateDir := filepath.Join(dataDir, "skaldi")
+	historyDir := filepath.Join(stateDir, "history")
 
 	configDir := os.Getenv("XDG_CONFIG_HOME")
 	if configDir == "" {
@@ -52,6 +54,7 @@ func LoadConfig() (*Config, error) {
 		UvBinDir:   filepath.Join(cacheDir, "uv-bin"),
 		MpvSocket:  filepath.Join(cacheDir, "mpv.sock"),
 		DataDir:    historyDir,
+		StateDir:   stateDir,
 		ConfigPath: appConfigPath,
 	}, nil
 }
@@ -71,3 +74,23 @@ func (c *Config) ShimPath() string {
 func (c *Config) RealYtDlpPath() string {
 	return filepath.Join(c.UvBinDir, "yt-dlp")
 }
+
+func (c *Config) QueueStatePath() string {
+	return filepath.Join(c.StateDir, "queue.json")
+}
+
+func (c *Config) ScrobbleQueuePath() string {
+	return filepath.Join(c.StateDir, "scrobbles.json")
+}
+
+func (c *Config) GuestKeyPath() string {
+	return filepath.Join(c.StateDir, "guest.key")
+}
+
+func (c *Config) LocalIndexPath() string {
+	return filepath.Join(c.CacheDir, "local_library.json")
+}
+
+func (c *Config) DiskCacheDir() string {
+	return filepath.Join(c.CacheDir, "search_cache")
+}
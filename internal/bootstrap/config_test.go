@@ -42,6 +42,7 @@ func TestConfig_Paths(t *testing.T) {
 		BinDir:     "/tmp/skaldi-test/bin",
 		UvBinDir:   "/tmp/skaldi-test/uv-bin",
 		MpvSocket:  "/tmp/skaldi-test/mpv.sock",
+		StateDir:   "/tmp/skaldi-test-data/skaldi",
 		ConfigPath: "/tmp/skaldi-test-config/skaldi/config.json",
 	}
 
@@ -54,6 +55,10 @@ func TestConfig_Paths(t *testing.T) {
 		{"BunPath", cfg.BunPath(), "/tmp/skaldi-test/bin/bun"},
 		{"ShimPath", cfg.ShimPath(), "/tmp/skaldi-test/bin/yt-dlp"},
 		{"RealYtDlpPath", cfg.RealYtDlpPath(), "/tmp/skaldi-test/uv-bin/yt-dlp"},
+		{"QueueStatePath", cfg.QueueStatePath(), "/tmp/skaldi-test-data/skaldi/queue.json"},
+		{"ScrobbleQueuePath", cfg.ScrobbleQueuePath(), "/tmp/skaldi-test-data/skaldi/scrobbles.json"},
+		{"LocalIndexPath", cfg.LocalIndexPath(), "/tmp/skaldi-test/local_library.json"},
+		{"DiskCacheDir", cfg.DiskCacheDir(), "/tmp/skaldi-test/search_cache"},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,272 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// Package client talks to a running Skaldi instance over its HTTP API.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/reuski/skaldi/internal/player"
+	"github.com/reuski/skaldi/internal/resolver"
+	"github.com/reuski/skaldi/internal/server"
+)
+
+const (
+	DefaultServerURL = "http://skaldi.local:8080"
+
+	requestTimeout = 60 * time.Second
+)
+
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+type QueueResult struct {
+	Status     string           `json:"status"`
+	Count      int              `json:"count"`
+	Rejected   int              `json:"rejected"`
+	Merged     int              `json:"merged,omitempty"`
+	Rejections []QueueRejection `json:"rejections,omitempty"`
+	Tracks     []resolver.Track `json:"tracks"`
+}
+
+type QueueRejection struct {
+	Title  string `json:"title"`
+	Reason string `json:"reason"`
+}
+
+type Schedule struct {
+	VolumeCap *float64          `json:"volume_cap,omitempty"`
+	Upcoming  []ScheduledAction `json:"upcoming"`
+}
+
+type ScheduledAction struct {
+	Name      string    `json:"name"`
+	Action    string    `json:"action"`
+	At        time.Time `json:"at"`
+	URL       string    `json:"url,omitempty"`
+	Playlist  string    `json:"playlist,omitempty"`
+	MaxVolume *float64  `json:"max_volume,omitempty"`
+}
+
+// searchBucketPreference is the order in which bucket hits are considered
+// when a query has to be turned into a single track, after the hits from
+// every OpenSubsonic library.
+var searchBucketPreference = []resolver.SearchBucket{
+	resolver.SearchBucketLocal,
+	resolver.SearchBucketYouTube,
+	resolver.SearchBucketYTMusic,
+	resolver.SearchBucketSoundCloud,
+	resolver.SearchBucketBandcamp,
+}
+
+func New(serverURL string, insecure bool) (*Client, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("server must be an http or https URL: %q", serverURL)
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return &Client{
+		baseURL: strings.TrimRight(u.String(), "/"),
+		httpClient: &http.Client{
+			Jar:       jar,
+			Transport: transport,
+			Timeout:   requestTimeout,
+		},
+	}, nil
+}
+
+func (c *Client) Login(ctx context.Context, pin string) error {
+	var info server.SessionInfo
+	if err := c.doJSON(ctx, http.MethodPost, "/auth/login", server.LoginRequest{PIN: pin}, &info); err != nil {
+		return err
+	}
+	if info.Role != server.RoleHost {
+		return fmt.Errorf("login did not grant host access")
+	}
+	return nil
+}
+
+func (c *Client) Snapshot(ctx context.Context) (player.Snapshot, error) {
+	var snap player.Snapshot
+
+	resp, err := c.do(ctx, http.MethodGet, "/events", nil)
+	if err != nil {
+		return snap, err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+
+	event := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			event = ""
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: ") && event == "":
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &snap); err != nil {
+				return snap, fmt.Errorf("invalid snapshot: %w", err)
+			}
+			return snap, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return snap, err
+	}
+	return snap, fmt.Errorf("event stream ended before a snapshot was received")
+}
+
+func (c *Client) Playback(ctx context.Context, req server.PlaybackRequest) error {
+	return c.doJSON(ctx, http.MethodPost, "/playback", req, nil)
+}
+
+func (c *Client) AudioDevices(ctx context.Context) ([]player.AudioDevice, error) {
+	var devices []player.AudioDevice
+	err := c.doJSON(ctx, http.MethodGet, "/audio/devices", nil, &devices)
+	return devices, err
+}
+
+func (c *Client) Schedule(ctx context.Context) (Schedule, error) {
+	var schedule Schedule
+	err := c.doJSON(ctx, http.MethodGet, "/schedule", nil, &schedule)
+	return schedule, err
+}
+
+func (c *Client) QueueURL(ctx context.Context, rawURL string) (QueueResult, error) {
+	var result QueueResult
+	err := c.doJSON(ctx, http.MethodPost, "/queue", server.QueueRequest{URL: rawURL}, &result)
+	return result, err
+}
+
+func (c *Client) QueueHits(ctx context.Context, hits []resolver.SearchHit) (QueueResult, error) {
+	var result QueueResult
+	err := c.doJSON(ctx, http.MethodPost, "/queue", server.QueueRequest{Hits: hits}, &result)
+	return result, err
+}
+
+func (c *Client) Move(ctx context.Context, from, to int) error {
+	return c.doJSON(ctx, http.MethodPost, "/queue/move", server.MoveRequest{From: from, To: to}, nil)
+}
+
+func (c *Client) Remove(ctx context.Context, index int) error {
+	return c.doJSON(ctx, http.MethodDelete, "/queue/"+strconv.Itoa(index), nil, nil)
+}
+
+// Search runs a full results search and returns the hits ordered by bucket
+// preference, best candidate first.
+func (c *Client) Search(ctx context.Context, query string) ([]resolver.SearchHit, error) {
+	params := url.Values{}
+	params.Set("q", query)
+	params.Set("intent", string(resolver.SearchIntentResults))
+
+	resp, err := c.do(ctx, http.MethodGet, "/search?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	buckets := make(map[resolver.SearchBucket][]resolver.SearchHit)
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var batch resolver.SearchBatch
+		if err := decoder.Decode(&batch); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("invalid search response: %w", err)
+		}
+		buckets[batch.Bucket] = batch.Hits
+	}
+
+	var libraries []resolver.SearchBucket
+	for bucket := range buckets {
+		if bucket.IsExternal() {
+			libraries = append(libraries, bucket)
+		}
+	}
+	slices.Sort(libraries)
+
+	var hits []resolver.SearchHit
+	for _, bucket := range append(libraries, searchBucketPreference...) {
+		hits = append(hits, buckets[bucket]...)
+	}
+	return hits, nil
+}
+
+func (c *Client) doJSON(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	resp, err := c.do(ctx, method, path, reader)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid response from %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 8*1024))
+		if text := strings.TrimSpace(string(msg)); text != "" {
+			return nil, fmt.Errorf("%s: %s", resp.Status, text)
+		}
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	return resp, nil
+}
@@ -0,0 +1,172 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/reuski/skaldi/internal/resolver"
+	"github.com/reuski/skaldi/internal/server"
+)
+
+func TestNew_RejectsInvalidServer(t *testing.T) {
+	for _, raw := range []string{"", "skaldi.local:8080", "ftp://skaldi.local"} {
+		if _, err := New(raw, false); err == nil {
+			t.Errorf("New(%q) should fail", raw)
+		}
+	}
+}
+
+func TestClient_Snapshot(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/events" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "retry: 3000\n")
+		fmt.Fprint(w, "event: session\ndata: {\"role\":\"guest\",\"auth_required\":true}\n\n")
+		fmt.Fprint(w, "data: {\"v\":3,\"status\":\"playing\",\"volume\":40,\"current_index\":0,\"queue\":[{\"index\":0,\"filename\":\"a\",\"title\":\"A\"}]}\n\n")
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL, false)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	snap, err := c.Snapshot(context.Background())
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	if snap.Version != 3 || snap.Volume != 40 || len(snap.Queue) != 1 {
+		t.Errorf("Snapshot = %+v, want version 3, volume 40, one queue item", snap)
+	}
+}
+
+func TestClient_SearchOrdersBuckets(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("intent"); got != "results" {
+			t.Errorf("intent = %q, want results", got)
+		}
+		enc := json.NewEncoder(w)
+		_ = enc.Encode(resolver.SearchBatch{Bucket: resolver.SearchBucketYTMusic, Complete: true, Hits: []resolver.SearchHit{{ID: "music"}}})
+		_ = enc.Encode(resolver.SearchBatch{Bucket: resolver.SearchBucketYouTube, Complete: false, Hits: []resolver.SearchHit{{ID: "partial"}}})
+		_ = enc.Encode(resolver.SearchBatch{Bucket: resolver.SearchBucketYouTube, Complete: true, Hits: []resolver.SearchHit{{ID: "video"}}})
+		_ = enc.Encode(resolver.SearchBatch{Bucket: resolver.ExternalBucket("navidrome"), Complete: true, Hits: []resolver.SearchHit{{ID: "navidrome"}}})
+		_ = enc.Encode(resolver.SearchBatch{Bucket: resolver.ExternalBucket("gonic"), Complete: true, Hits: []resolver.SearchHit{{ID: "gonic"}}})
+	}))
+	defer srv.Close()
+
+	c, _ := New(srv.URL, false)
+	hits, err := c.Search(context.Background(), "song")
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+
+	var ids []string
+	for _, hit := range hits {
+		ids = append(ids, hit.ID)
+	}
+	if got := strings.Join(ids, ","); got != "gonic,navidrome,video,music" {
+		t.Errorf("hit order = %s, want gonic,navidrome,video,music", got)
+	}
+}
+
+func TestClient_LoginKeepsSessionCookie(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/auth/login":
+			var req server.LoginRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			if req.PIN != "2468" {
+				http.Error(w, "Invalid PIN", http.StatusUnauthorized)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "skaldi_session", Value: "token", Path: "/"})
+			_ = json.NewEncoder(w).Encode(server.SessionInfo{Role: server.RoleHost, AuthRequired: true})
+		case "/playback":
+			if cookie, err := r.Cookie("skaldi_session"); err != nil || cookie.Value != "token" {
+				http.Error(w, "Host access required", http.StatusForbidden)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer srv.Close()
+
+	c, _ := New(srv.URL, false)
+	ctx := context.Background()
+
+	err := c.Playback(ctx, server.PlaybackRequest{Action: "skip"})
+	if err == nil || !strings.Contains(err.Error(), "Host access required") {
+		t.Fatalf("Playback without login error = %v, want host access error", err)
+	}
+
+	if err := c.Login(ctx, "0000"); err == nil {
+		t.Fatal("Login with wrong PIN should fail")
+	}
+	if err := c.Login(ctx, "2468"); err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	if err := c.Playback(ctx, server.PlaybackRequest{Action: "skip"}); err != nil {
+		t.Errorf("Playback after login failed: %v", err)
+	}
+}
+
+func TestClient_AudioDevices(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/audio/devices" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `[{"name":"auto","description":"Autoselect device"},{"name":"alsa/hdmi","description":"HDMI"}]`)
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL, false)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	devices, err := c.AudioDevices(context.Background())
+	if err != nil {
+		t.Fatalf("AudioDevices failed: %v", err)
+	}
+	if len(devices) != 2 || devices[1].Name != "alsa/hdmi" || devices[1].Description != "HDMI" {
+		t.Errorf("devices = %+v", devices)
+	}
+}
+
+func TestClient_Schedule(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/schedule" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"volume_cap":30,"upcoming":[{"name":"alarm","action":"play","at":"2026-03-03T07:30:00Z","playlist":"morning"}]}`)
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL, false)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	schedule, err := c.Schedule(context.Background())
+	if err != nil {
+		t.Fatalf("Schedule failed: %v", err)
+	}
+	if schedule.VolumeCap == nil || *schedule.VolumeCap != 30 {
+		t.Errorf("VolumeCap = %v, want 30", schedule.VolumeCap)
+	}
+	if len(schedule.Upcoming) != 1 || schedule.Upcoming[0].Playlist != "morning" || schedule.Upcoming[0].At.Hour() != 7 {
+		t.Errorf("Upcoming = %+v", schedule.Upcoming)
+	}
+}
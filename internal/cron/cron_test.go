@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) should fail", expr)
+		}
+	}
+}
+
+func TestSchedule_Matches(t *testing.T) {
+	// 2026-03-02 is a Monday.
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 3, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		expr string
+		t    time.Time
+		want bool
+	}{
+		{expr: "* * * * *", t: at(2, 13, 37), want: true},
+		{expr: "30 7 * * *", t: at(2, 7, 30), want: true},
+		{expr: "30 7 * * *", t: at(2, 7, 31), want: false},
+		{expr: "* 22-23,0-6 * * *", t: at(2, 23, 59), want: true},
+		{expr: "* 22-23,0-6 * * *", t: at(2, 7, 0), want: false},
+		{expr: "*/15 * * * *", t: at(2, 9, 45), want: true},
+		{expr: "*/15 * * * *", t: at(2, 9, 50), want: false},
+		{expr: "5/20 * * * *", t: at(2, 9, 25), want: true},
+		{expr: "0 9 * * 1-5", t: at(2, 9, 0), want: true},
+		{expr: "0 9 * * 1-5", t: at(7, 9, 0), want: false},
+		{expr: "0 9 * * 7", t: at(8, 9, 0), want: true},
+		{expr: "0 9 * 4 *", t: at(2, 9, 0), want: false},
+		// Both day fields restricted: either one matching is enough.
+		{expr: "0 9 15 * 1", t: at(2, 9, 0), want: true},
+		{expr: "0 9 15 * 1", t: at(15, 9, 0), want: true},
+		{expr: "0 9 15 * 1", t: at(3, 9, 0), want: false},
+	}
+
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", tt.expr, err)
+		}
+		if got := s.Matches(tt.t); got != tt.want {
+			t.Errorf("Parse(%q).Matches(%v) = %v, want %v", tt.expr, tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestSchedule_Next(t *testing.T) {
+	from := time.Date(2026, 3, 2, 22, 10, 30, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{expr: "* * * * *", want: time.Date(2026, 3, 2, 22, 11, 0, 0, time.UTC)},
+		{expr: "0 0 * * *", want: time.Date(2026, 3, 3, 0, 0, 0, 0, time.UTC)},
+		{expr: "10 22 * * *", want: time.Date(2026, 3, 3, 22, 10, 0, 0, time.UTC)},
+		{expr: "30 7 * * 6", want: time.Date(2026, 3, 7, 7, 30, 0, 0, time.UTC)},
+		{expr: "0 12 1 * *", want: time.Date(2026, 4, 1, 12, 0, 0, 0, time.UTC)},
+		{expr: "0 0 29 2 *", want: time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 30 2 *"},
+	}
+
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", tt.expr, err)
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("Parse(%q).Next() = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
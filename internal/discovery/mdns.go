@@ -17,27 +17,32 @@ import (
 
 const Hostname = "skaldi"
 
-func Register(ctx context.Context, logger *slog.Logger, port int) (cleanup func(), ok bool) {
+func Register(ctx context.Context, logger *slog.Logger, port int, secure bool) (cleanup func(), ok bool) {
 	ip := primaryLANIP()
 	if ip == "" {
 		logger.Warn("No LAN IP found, skipping mDNS registration")
 		return func() {}, false
 	}
 
+	serviceType := "_http._tcp"
+	if secure {
+		serviceType = "_https._tcp"
+	}
+
 	switch runtime.GOOS {
 	case "linux":
-		return registerAvahi(ctx, logger, ip, port)
+		return registerAvahi(ctx, logger, ip, serviceType, port)
 	case "darwin":
-		return registerBonjour(ctx, logger, ip, port)
+		return registerBonjour(ctx, logger, ip, serviceType, port)
 	case "windows":
-		return registerWindows(ctx, logger, ip, port)
+		return registerWindows(ctx, logger, ip, serviceType, port)
 	default:
 		logger.Warn("mDNS not supported on this platform", "os", runtime.GOOS)
 		return func() {}, false
 	}
 }
 
-func registerAvahi(ctx context.Context, logger *slog.Logger, ip string, port int) (cleanup func(), ok bool) {
+func registerAvahi(ctx context.Context, logger *slog.Logger, ip, serviceType string, port int) (cleanup func(), ok bool) {
 	path, err := exec.LookPath("avahi-publish-service")
 	if err != nil {
 		path, err = exec.LookPath("avahi-publish")
@@ -65,7 +70,7 @@ func registerAvahi(ctx context.Context, logger *slog.Logger, ip string, port int
 		return func() {}, false
 	}
 
-	svcCmd := exec.CommandContext(ctx, path, "-s", "-H", fqdn, "Skaldi Jukebox", "_http._tcp", fmt.Sprint(port), "path=/")
+	svcCmd := exec.CommandContext(ctx, path, "-s", "-H", fqdn, "Skaldi Jukebox", serviceType, fmt.Sprint(port), "path=/")
 	if err := svcCmd.Start(); err != nil {
 		_ = addrCmd.Process.Signal(os.Interrupt)
 		_ = addrCmd.Wait()
@@ -82,7 +87,7 @@ func registerAvahi(ctx context.Context, logger *slog.Logger, ip string, port int
 	}, true
 }
 
-func registerBonjour(ctx context.Context, logger *slog.Logger, ip string, port int) (cleanup func(), ok bool) {
+func registerBonjour(ctx context.Context, logger *slog.Logger, ip, serviceType string, port int) (cleanup func(), ok bool) {
 	path, err := exec.LookPath("dns-sd")
 	if err != nil {
 		logger.Warn("dns-sd not found, mDNS unavailable")
@@ -90,7 +95,7 @@ func registerBonjour(ctx context.Context, logger *slog.Logger, ip string, port i
 	}
 
 	cmd := exec.CommandContext(ctx, path, "-P", "Skaldi Jukebox",
-		"_http._tcp", "local", fmt.Sprintf("%d", port),
+		serviceType, "local", fmt.Sprintf("%d", port),
 		Hostname+".local", ip)
 
 	if err := cmd.Start(); err != nil {
@@ -105,12 +110,12 @@ func registerBonjour(ctx context.Context, logger *slog.Logger, ip string, port i
 	}, true
 }
 
-func registerWindows(ctx context.Context, logger *slog.Logger, ip string, port int) (cleanup func(), ok bool) {
+func registerWindows(ctx context.Context, logger *slog.Logger, ip, serviceType string, port int) (cleanup func(), ok bool) {
 	if _, err := exec.LookPath("dns-sd"); err != nil {
 		logger.Warn("dns-sd not found (install Bonjour SDK), mDNS unavailable")
 		return func() {}, false
 	}
-	return registerBonjour(ctx, logger, ip, port)
+	return registerBonjour(ctx, logger, ip, serviceType, port)
 }
 
 func primaryLANIP() string {
@@ -10,13 +10,23 @@ import (
 	"path/filepath"
 	"sync"
 	"time"
+
+	"github.com/reuski/skaldi/internal/metrics"
+)
+
+var (
+	writeFailures = metrics.NewCounter("skaldi_history_write_failures_total",
+		"History entries that could not be written.")
+	droppedEntries = metrics.NewCounter("skaldi_history_dropped_total",
+		"History entries dropped because the write buffer was full.")
 )
 
 type Entry struct {
-	Timestamp time.Time `json:"timestamp"`
-	Title     string    `json:"title,omitempty"`
-	Artist    string    `json:"artist,omitempty"`
-	SourceURL string    `json:"source_url,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+	Title       string    `json:"title,omitempty"`
+	Artist      string    `json:"artist,omitempty"`
+	SourceURL   string    `json:"source_url,omitempty"`
+	RequestedBy string    `json:"requested_by,omitempty"`
 }
 
 type Logger struct {
@@ -43,6 +53,7 @@ func (l *Logger) Log(e Entry) {
 	select {
 	case l.entries <- e:
 	default:
+		droppedEntries.Inc()
 		l.logger.Warn("History buffer full, dropping entry", "title", e.Title)
 	}
 }
@@ -62,6 +73,7 @@ func (l *Logger) run() {
 
 	for entry := range l.entries {
 		if err := l.write(entry); err != nil {
+			writeFailures.Inc()
 			l.logger.Error("Failed to write history entry", "error", err)
 		}
 	}
@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	requests := NewCounter("test_requests_total", "Requests by \"code\".", "code")
+	idle := NewCounter("test_idle_total", "Never incremented.")
+	depth := NewGauge("test_queue_depth", "Queue depth.")
+	latency := NewHistogram("test_latency_seconds", "Latency.", []float64{0.5, 0.1}, "op")
+
+	requests.Inc("200")
+	requests.Add(2, "200")
+	requests.Inc("5\"0\n0")
+	requests.Add(-1, "200")
+	depth.Set(4)
+	depth.Dec()
+	latency.Observe(0.05, "get")
+	latency.Observe(0.3, "get")
+	latency.Observe(2, "get")
+
+	var b strings.Builder
+	if err := WriteText(&b); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+	got := b.String()
+
+	for _, want := range []string{
+		"# HELP test_requests_total Requests by \"code\".\n# TYPE test_requests_total counter\n",
+		"test_requests_total{code=\"200\"} 3\n",
+		"test_requests_total{code=\"5\\\"0\\n0\"} 1\n",
+		"# TYPE test_idle_total counter\ntest_idle_total 0\n",
+		"# TYPE test_queue_depth gauge\ntest_queue_depth 3\n",
+		"test_latency_seconds_bucket{op=\"get\",le=\"0.1\"} 1\n",
+		"test_latency_seconds_bucket{op=\"get\",le=\"0.5\"} 2\n",
+		"test_latency_seconds_bucket{op=\"get\",le=\"+Inf\"} 3\n",
+		"test_latency_seconds_sum{op=\"get\"} 2.35\n",
+		"test_latency_seconds_count{op=\"get\"} 3\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q\n%s", want, got)
+		}
+	}
+
+	if idle.Value() != 0 || requests.Value("200") != 3 || latency.Count("get") != 3 {
+		t.Error("Value/Count do not match the recorded samples")
+	}
+	if strings.Index(got, "test_idle_total") > strings.Index(got, "test_latency_seconds") {
+		t.Error("families should be sorted by name")
+	}
+}
+
+func TestRegisterTwicePanics(t *testing.T) {
+	NewGauge("test_duplicate", "First.")
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a name twice should panic")
+		}
+	}()
+	NewGauge("test_duplicate", "Second.")
+}
@@ -0,0 +1,192 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package player
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type AudioPreset string
+
+const (
+	AudioPresetFlat       AudioPreset = "flat"
+	AudioPresetDynaudnorm AudioPreset = "dynaudnorm"
+	AudioPresetLoudnorm   AudioPreset = "loudnorm"
+	AudioPresetBassBoost  AudioPreset = "bass_boost"
+	AudioPresetNight      AudioPreset = "night"
+
+	DefaultAudioPreset = AudioPresetDynaudnorm
+
+	MaxEqualizerGain = 12.0
+)
+
+// audioPresets maps each preset to its mpv filter chain. Filters mpv does not
+// implement itself are passed through to libavfilter.
+var audioPresets = map[AudioPreset]string{
+	AudioPresetFlat:       "",
+	AudioPresetDynaudnorm: "dynaudnorm",
+	AudioPresetLoudnorm:   "loudnorm=I=-16:TP=-1.5:LRA=11",
+	AudioPresetBassBoost:  "bass=g=6:f=110:w=0.6",
+	AudioPresetNight:      "acompressor=threshold=0.1:ratio=4:attack=20:release=250:makeup=2,dynaudnorm=f=250:g=15",
+}
+
+// EqualizerBands are the centre frequencies in Hz of the equalizer's octave
+// bands, lowest first.
+var EqualizerBands = []int{31, 62, 125, 250, 500, 1000, 2000, 4000, 8000, 16000}
+
+type audioConfig struct {
+	Preset    AudioPreset `json:"preset,omitempty"`
+	Equalizer []float64   `json:"equalizer,omitempty"`
+}
+
+func AudioPresets() []AudioPreset {
+	presets := make([]AudioPreset, 0, len(audioPresets))
+	for preset := range audioPresets {
+		presets = append(presets, preset)
+	}
+	slices.Sort(presets)
+	return presets
+}
+
+func ParseAudioPreset(s string) (AudioPreset, bool) {
+	preset := AudioPreset(s)
+	_, ok := audioPresets[preset]
+	return preset, ok
+}
+
+// ValidateEqualizer accepts one gain in dB per band, or no gains at all to
+// switch the equalizer off.
+func ValidateEqualizer(gains []float64) error {
+	if len(gains) == 0 {
+		return nil
+	}
+	if len(gains) != len(EqualizerBands) {
+		return fmt.Errorf("equalizer needs %d band gains, got %d", len(EqualizerBands), len(gains))
+	}
+	for _, gain := range gains {
+		if gain < -MaxEqualizerGain || gain > MaxEqualizerGain {
+			return fmt.Errorf("equalizer gains must be between %g and %g dB", -MaxEqualizerGain, MaxEqualizerGain)
+		}
+	}
+	return nil
+}
+
+// normalizeAudioConfig falls back to the defaults for anything invalid so a
+// hand-edited config cannot leave the room without sound.
+func normalizeAudioConfig(cfg audioConfig) (audioConfig, error) {
+	var errs []error
+	if cfg.Preset == "" {
+		cfg.Preset = DefaultAudioPreset
+	} else if _, ok := audioPresets[cfg.Preset]; !ok {
+		errs = append(errs, fmt.Errorf("unknown audio preset %q", cfg.Preset))
+		cfg.Preset = DefaultAudioPreset
+	}
+	if err := ValidateEqualizer(cfg.Equalizer); err != nil {
+		errs = append(errs, err)
+		cfg.Equalizer = nil
+	}
+	if !slices.ContainsFunc(cfg.Equalizer, func(g float64) bool { return g != 0 }) {
+		cfg.Equalizer = nil
+	}
+	return cfg, errors.Join(errs...)
+}
+
+// filterChain builds the value for mpv's af property: the preset's filters
+// followed by one peaking filter per non-zero equalizer band.
+func filterChain(cfg audioConfig) string {
+	var filters []string
+	if chain := audioPresets[cfg.Preset]; chain != "" {
+		filters = append(filters, chain)
+	}
+	for i, gain := range cfg.Equalizer {
+		if gain == 0 {
+			continue
+		}
+		filters = append(filters, fmt.Sprintf("equalizer=f=%d:t=o:w=1:g=%s",
+			EqualizerBands[i], strconv.FormatFloat(gain, 'f', -1, 64)))
+	}
+	return strings.Join(filters, ",")
+}
+
+func (m *Manager) SetAudioPreset(preset AudioPreset) error {
+	m.audioMu.Lock()
+	defer m.audioMu.Unlock()
+
+	next := m.audio
+	next.Preset = preset
+	return m.applyAudioLocked(next)
+}
+
+func (m *Manager) SetEqualizer(gains []float64) error {
+	if err := ValidateEqualizer(gains); err != nil {
+		return err
+	}
+
+	m.audioMu.Lock()
+	defer m.audioMu.Unlock()
+
+	next := m.audio
+	next.Equalizer = slices.Clone(gains)
+	return m.applyAudioLocked(next)
+}
+
+func (m *Manager) applyAudioLocked(next audioConfig) error {
+	next, err := normalizeAudioConfig(next)
+	if err != nil {
+		return err
+	}
+	if _, err := m.ipc.Exec("set_property", "af", filterChain(next)); err != nil {
+		return err
+	}
+
+	m.audio = next
+	m.State.SetAudio(next.Preset, next.Equalizer)
+	if err := savePlayerSetting(m.cfg.ConfigPath, "audio", next); err != nil {
+		m.logger.Warn("Failed to save audio settings", "error", err)
+	}
+	return nil
+}
+
+type AudioDevice struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// AudioDevices lists the outputs mpv can play on. The first entry is always
+// "auto", which follows the system default.
+func (m *Manager) AudioDevices() ([]AudioDevice, error) {
+	raw, err := m.ipc.Exec("get_property", "audio-device-list")
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var devices []AudioDevice
+	if err := json.Unmarshal(data, &devices); err != nil {
+		return nil, fmt.Errorf("failed to decode audio devices: %w", err)
+	}
+	return devices, nil
+}
+
+func (m *Manager) SetAudioDevice(name string) error {
+	m.audioMu.Lock()
+	defer m.audioMu.Unlock()
+
+	if _, err := m.ipc.Exec("set_property", "audio-device", name); err != nil {
+		return err
+	}
+
+	m.audioDevice = name
+	m.State.SetAudioDevice(name)
+	if err := savePlayerSetting(m.cfg.ConfigPath, "audio_device", name); err != nil {
+		m.logger.Warn("Failed to save audio device", "error", err)
+	}
+	return nil
+}
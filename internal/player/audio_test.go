@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package player
+
+import "testing"
+
+func TestFilterChain(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  audioConfig
+		want string
+	}{
+		{name: "flat", cfg: audioConfig{Preset: AudioPresetFlat}, want: ""},
+		{name: "default", cfg: audioConfig{Preset: DefaultAudioPreset}, want: "dynaudnorm"},
+		{
+			name: "equalizer only",
+			cfg:  audioConfig{Preset: AudioPresetFlat, Equalizer: []float64{3, 0, 0, 0, 0, 0, 0, 0, 0, -2.5}},
+			want: "equalizer=f=31:t=o:w=1:g=3,equalizer=f=16000:t=o:w=1:g=-2.5",
+		},
+		{
+			name: "preset then equalizer",
+			cfg:  audioConfig{Preset: AudioPresetLoudnorm, Equalizer: []float64{0, 4, 0, 0, 0, 0, 0, 0, 0, 0}},
+			want: "loudnorm=I=-16:TP=-1.5:LRA=11,equalizer=f=62:t=o:w=1:g=4",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filterChain(tt.cfg); got != tt.want {
+				t.Errorf("filterChain = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeAudioConfig(t *testing.T) {
+	cfg, err := normalizeAudioConfig(audioConfig{})
+	if err != nil || cfg.Preset != DefaultAudioPreset {
+		t.Errorf("empty config = %+v, %v; want default preset", cfg, err)
+	}
+
+	cfg, err = normalizeAudioConfig(audioConfig{Preset: "stadium", Equalizer: []float64{1}})
+	if err == nil {
+		t.Error("expected an error for an unknown preset and short equalizer")
+	}
+	if cfg.Preset != DefaultAudioPreset || cfg.Equalizer != nil {
+		t.Errorf("invalid config = %+v, want defaults", cfg)
+	}
+
+	cfg, _ = normalizeAudioConfig(audioConfig{Preset: AudioPresetNight, Equalizer: make([]float64, len(EqualizerBands))})
+	if cfg.Equalizer != nil {
+		t.Errorf("all-zero equalizer = %v, want nil", cfg.Equalizer)
+	}
+}
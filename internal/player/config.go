@@ -0,0 +1,209 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package player
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// settingsMu serializes writes to config.json, which audio and queue order
+// changes make from under different locks. It is taken before enqueueMu.
+var settingsMu sync.Mutex
+
+type appConfig struct {
+	Player playerConfig `json:"player"`
+}
+
+type playerConfig struct {
+	PersistQueue bool        `json:"persist_queue"`
+	Audio        audioConfig `json:"audio"`
+	AudioDevice  string      `json:"audio_device"`
+	QueueOrder   QueueOrder  `json:"queue_order"`
+}
+
+func loadPlayerConfig(path string) (playerConfig, error) {
+	var cfg appConfig
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return cfg.Player, nil
+		}
+		return playerConfig{}, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	if strings.TrimSpace(string(data)) == "" {
+		return cfg.Player, nil
+	}
+
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return playerConfig{}, fmt.Errorf("invalid config JSON at %s: %w", path, err)
+	}
+
+	return cfg.Player, nil
+}
+
+// savePlayerSetting rewrites one key of the player block in config.json,
+// leaving every other setting, and the order keys are in, as it was.
+func savePlayerSetting(path, key string, value any) error {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	return savePlayerSettingLocked(path, key, value)
+}
+
+// savePlayerSettingLocked is savePlayerSetting for a caller that holds
+// settingsMu.
+func savePlayerSettingLocked(path, key string, value any) error {
+	if path == "" {
+		return nil
+	}
+
+	var root []jsonMember
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("failed to read config: %w", err)
+	case strings.TrimSpace(string(data)) != "":
+		if root, err = decodeJSONObject(data); err != nil {
+			return fmt.Errorf("invalid config JSON at %s: %w", path, err)
+		}
+	}
+
+	var player []jsonMember
+	if raw, ok := lookupJSONMember(root, "player"); ok && string(raw) != "null" {
+		if player, err = decodeJSONObject(raw); err != nil {
+			return fmt.Errorf("invalid player config at %s: %w", path, err)
+		}
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	player = setJSONMember(player, key, raw)
+	root = setJSONMember(root, "player", encodeJSONObject(player))
+	var out bytes.Buffer
+	if err := json.Indent(&out, encodeJSONObject(root), "", "  "); err != nil {
+		return err
+	}
+	out.WriteByte('\n')
+
+	// config.json holds credentials, so keep whatever mode the owner chose.
+	dir := filepath.Dir(path)
+	mode := os.FileMode(0o600)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	} else if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create config dir: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	_, err = tmp.Write(out.Bytes())
+	if err == nil {
+		err = tmp.Chmod(mode)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to replace config: %w", err)
+	}
+	return nil
+}
+
+// jsonMember is one key of a JSON object. Objects are kept as lists of
+// members so that rewriting one key leaves the rest in the order the user
+// wrote them.
+type jsonMember struct {
+	key   string
+	value json.RawMessage
+}
+
+func decodeJSONObject(data []byte) ([]jsonMember, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil {
+		return nil, err
+	} else if tok != json.Delim('{') {
+		return nil, errors.New("not a JSON object")
+	}
+
+	var members []jsonMember
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		members = append(members, jsonMember{key: tok.(string), value: value})
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after JSON object")
+	}
+	return members, nil
+}
+
+// lookupJSONMember returns the value of key. Like json.Unmarshal, it takes
+// the last of repeated keys.
+func lookupJSONMember(members []jsonMember, key string) (json.RawMessage, bool) {
+	for i := len(members) - 1; i >= 0; i-- {
+		if members[i].key == key {
+			return members[i].value, true
+		}
+	}
+	return nil, false
+}
+
+// setJSONMember replaces the value of key where it is, or adds it at the
+// end.
+func setJSONMember(members []jsonMember, key string, value json.RawMessage) []jsonMember {
+	found := false
+	for i := range members {
+		if members[i].key == key {
+			members[i].value = value
+			found = true
+		}
+	}
+	if !found {
+		members = append(members, jsonMember{key: key, value: value})
+	}
+	return members
+}
+
+func encodeJSONObject(members []jsonMember) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, member := range members {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(member.key)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(member.value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
@@ -0,0 +1,145 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package player
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestSavePlayerSetting_KeepsOtherSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	original := `{"auth": {"enabled": true, "host_pin": "2468"}, "player": {"persist_queue": true}}`
+	if err := os.WriteFile(path, []byte(original), 0o640); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	audio := audioConfig{Preset: AudioPresetBassBoost, Equalizer: []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}}
+	if err := savePlayerSetting(path, "audio", audio); err != nil {
+		t.Fatalf("savePlayerSetting failed: %v", err)
+	}
+	if err := savePlayerSetting(path, "audio_device", "alsa/hdmi"); err != nil {
+		t.Fatalf("savePlayerSetting failed: %v", err)
+	}
+
+	cfg, err := loadPlayerConfig(path)
+	if err != nil {
+		t.Fatalf("loadPlayerConfig failed: %v", err)
+	}
+	if !cfg.PersistQueue {
+		t.Error("persist_queue was lost")
+	}
+	if cfg.AudioDevice != "alsa/hdmi" {
+		t.Errorf("audio_device = %q, want alsa/hdmi", cfg.AudioDevice)
+	}
+	if cfg.Audio.Preset != audio.Preset || !slices.Equal(cfg.Audio.Equalizer, audio.Equalizer) {
+		t.Errorf("audio = %+v, want %+v", cfg.Audio, audio)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	var root struct {
+		Auth struct {
+			HostPIN string `json:"host_pin"`
+		} `json:"auth"`
+	}
+	if err := json.Unmarshal(data, &root); err != nil || root.Auth.HostPIN != "2468" {
+		t.Errorf("auth block was not preserved: %s", data)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Mode().Perm() != 0o640 {
+		t.Errorf("mode = %v, want 0640", info.Mode().Perm())
+	}
+}
+
+func TestSavePlayerSetting_KeepsKeyOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	original := `{"subsonic": {"url": "http://music"}, "auth": {"host_pin": "2468"}, "player": {"queue_order": "append", "persist_queue": true}}`
+	if err := os.WriteFile(path, []byte(original), 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	if err := savePlayerSetting(path, "queue_order", QueueOrder("fair")); err != nil {
+		t.Fatalf("savePlayerSetting failed: %v", err)
+	}
+	if err := savePlayerSetting(path, "audio_device", "alsa/hdmi"); err != nil {
+		t.Fatalf("savePlayerSetting failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	want := `{
+  "subsonic": {
+    "url": "http://music"
+  },
+  "auth": {
+    "host_pin": "2468"
+  },
+  "player": {
+    "queue_order": "fair",
+    "persist_queue": true,
+    "audio_device": "alsa/hdmi"
+  }
+}
+`
+	if string(data) != want {
+		t.Errorf("config =\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestSavePlayerSetting_Concurrent(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Go(func() {
+			if err := savePlayerSetting(path, fmt.Sprintf("key_%d", i), i); err != nil {
+				t.Errorf("savePlayerSetting failed: %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	var root struct {
+		Player map[string]int `json:"player"`
+	}
+	if err := json.Unmarshal(data, &root); err != nil {
+		t.Fatalf("config is not valid JSON: %v\n%s", err, data)
+	}
+	if len(root.Player) != 8 {
+		t.Errorf("player = %v, want all 8 settings", root.Player)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("config dir holds %d files, want no leftover temp files", len(entries))
+	}
+}
+
+func TestDecodeJSONObject_Invalid(t *testing.T) {
+	for _, data := range []string{`[1]`, `{"a": 1`, `{"a": 1} {}`, `"player"`} {
+		if _, err := decodeJSONObject([]byte(data)); err == nil {
+			t.Errorf("decodeJSONObject(%s) succeeded, want an error", data)
+		}
+	}
+}
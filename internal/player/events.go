@@ -34,6 +34,10 @@ func (m *Manager) RegisterObservers() {
 		"playlist",
 		"media-title",
 		"playlist-pos",
+		"loop-file",
+		"loop-playlist",
+		"shuffle",
+		"audio-device",
 	}
 	for _, prop := range properties {
 		go func(p string) {
@@ -66,28 +70,68 @@ func (m *Manager) handleEvent(e Event) {
 		shouldBroadcast = m.handlePlaylist(e.Data)
 	case "playlist-pos":
 		shouldBroadcast = m.handlePlaylistPos(e.Data)
+	case "loop-file":
+		shouldBroadcast = m.handleLoop(e.Data, m.State.SetLoopFile)
+	case "loop-playlist":
+		shouldBroadcast = m.handleLoop(e.Data, m.State.SetLoopPlaylist)
+	case "shuffle":
+		shouldBroadcast = m.handleShuffle(e.Data)
+	case "audio-device":
+		shouldBroadcast = m.handleAudioDevice(e.Data)
 	}
 
 	if shouldBroadcast {
-		select {
-		case m.StateUpdates <- m.State.Snapshot():
-		default:
-		}
+		m.broadcastState()
+	}
+}
+
+// broadcastState sends the current state to StateUpdates. Requests still
+// being served after Stop can call it, so it does nothing once the channel
+// is closed.
+func (m *Manager) broadcastState() {
+	snap := m.State.Snapshot()
+
+	m.noticesMu.Lock()
+	defer m.noticesMu.Unlock()
+
+	if m.noticesClosed {
+		return
+	}
+	select {
+	case m.StateUpdates <- snap:
+	default:
 	}
 }
 
 func (m *Manager) handleIdleActive(data interface{}) bool {
 	if val, ok := data.(bool); ok {
+		ranOut := val && m.State.playlistRanOut()
 		m.State.SetIdle(val)
 		if val {
 			m.State.SetTimePos(0)
 			m.State.SetDuration(0)
 		}
+		if ranOut && !m.recovering.Load() {
+			m.signalQueueDrained()
+		}
 		return true
 	}
 	return false
 }
 
+func (m *Manager) signalQueueDrained() {
+	m.noticesMu.Lock()
+	defer m.noticesMu.Unlock()
+
+	if m.noticesClosed {
+		return
+	}
+	select {
+	case m.QueueDrained <- struct{}{}:
+	default:
+	}
+}
+
 func (m *Manager) handlePause(data interface{}) bool {
 	if val, ok := data.(bool); ok {
 		m.State.SetPaused(val)
@@ -99,6 +143,10 @@ func (m *Manager) handlePause(data interface{}) bool {
 func (m *Manager) handleTimePos(data interface{}) bool {
 	if val, ok := data.(float64); ok {
 		m.State.SetTimePos(val)
+		if m.scrobbles != nil {
+			item, duration := m.State.currentTrack()
+			m.scrobbles.progress(item, val, duration, time.Now())
+		}
 		return true
 	}
 	return false
@@ -107,6 +155,9 @@ func (m *Manager) handleTimePos(data interface{}) bool {
 func (m *Manager) handleDuration(data interface{}) bool {
 	if val, ok := data.(float64); ok {
 		m.State.SetDuration(val)
+		if val > 0 {
+			m.applyPendingSeek()
+		}
 		return true
 	}
 	return false
@@ -128,6 +179,38 @@ func (m *Manager) handleMute(data interface{}) bool {
 	return false
 }
 
+// handleLoop accepts every shape mpv reports loop properties in: false for
+// "no", "inf" or "force" as strings, or a remaining repeat count.
+func (m *Manager) handleLoop(data interface{}, set func(bool)) bool {
+	switch val := data.(type) {
+	case bool:
+		set(val)
+	case string:
+		set(val != "no")
+	case float64:
+		set(val > 0)
+	default:
+		return false
+	}
+	return true
+}
+
+func (m *Manager) handleShuffle(data interface{}) bool {
+	if val, ok := data.(bool); ok {
+		m.State.SetShuffle(val)
+		return true
+	}
+	return false
+}
+
+func (m *Manager) handleAudioDevice(data interface{}) bool {
+	if val, ok := data.(string); ok {
+		m.State.SetAudioDevice(val)
+		return true
+	}
+	return false
+}
+
 func (m *Manager) handlePlaylist(data interface{}) bool {
 	dataBytes, err := json.Marshal(data)
 	if err != nil {
@@ -139,7 +222,9 @@ func (m *Manager) handlePlaylist(data interface{}) bool {
 	}
 	m.State.SetPlaylist(entries)
 	m.State.PruneMetadata()
-	m.checkTempFiles(entries)
+	if !m.recovering.Load() {
+		m.checkTempFiles(entries)
+	}
 	return true
 }
 
@@ -150,6 +235,9 @@ func (m *Manager) handlePlaylistPos(data interface{}) bool {
 	}
 
 	item := m.State.SetPlaylistPos(idx)
+	if m.scrobbles != nil {
+		m.scrobbles.begin(item, time.Now())
+	}
 	if item == nil {
 		return idx >= 0
 	}
@@ -164,6 +252,10 @@ func (m *Manager) handlePlaylistPos(data interface{}) bool {
 	}
 	if item.Metadata != nil {
 		histEntry.Artist = item.Metadata.Artist
+		histEntry.RequestedBy = item.Metadata.RequesterName
+		if histEntry.RequestedBy == "" {
+			histEntry.RequestedBy = item.Metadata.RequesterID
+		}
 		histEntry.SourceURL = item.Metadata.WebpageURL
 		if histEntry.SourceURL == "" {
 			histEntry.SourceURL = item.Metadata.URL
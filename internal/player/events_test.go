@@ -0,0 +1,166 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package player
+
+import "testing"
+
+func TestManager_HandleIdleActive_SignalsDrainedQueue(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(m *Manager)
+		wantSent bool
+	}{
+		{
+			name:     "startup",
+			setup:    func(m *Manager) {},
+			wantSent: false,
+		},
+		{
+			name: "played to the end",
+			setup: func(m *Manager) {
+				m.State.SetIdle(false)
+				m.State.SetPlaylist([]MpvPlaylistEntry{{Filename: "a.mp3", ID: 1}})
+			},
+			wantSent: true,
+		},
+		{
+			name: "already idle",
+			setup: func(m *Manager) {
+				m.State.SetPlaylist([]MpvPlaylistEntry{{Filename: "a.mp3", ID: 1}})
+				m.State.SetIdle(true)
+			},
+			wantSent: false,
+		},
+		{
+			name: "recovering",
+			setup: func(m *Manager) {
+				m.State.SetIdle(false)
+				m.State.SetPlaylist([]MpvPlaylistEntry{{Filename: "a.mp3", ID: 1}})
+				m.recovering.Store(true)
+			},
+			wantSent: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t)
+			tt.setup(m)
+
+			m.handleIdleActive(true)
+
+			select {
+			case <-m.QueueDrained:
+				if !tt.wantSent {
+					t.Error("QueueDrained should not have been signalled")
+				}
+			default:
+				if tt.wantSent {
+					t.Error("QueueDrained should have been signalled")
+				}
+			}
+		})
+	}
+}
+
+func TestManager_HandleLoop(t *testing.T) {
+	tests := []struct {
+		data any
+		want bool
+	}{
+		{data: false, want: false},
+		{data: true, want: true},
+		{data: "inf", want: true},
+		{data: "force", want: true},
+		{data: "no", want: false},
+		{data: float64(3), want: true},
+	}
+
+	m := newTestManager(t)
+	for _, tt := range tests {
+		got := !tt.want
+		if !m.handleLoop(tt.data, func(v bool) { got = v }) {
+			t.Errorf("handleLoop(%v) rejected the value", tt.data)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("handleLoop(%v) = %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestManager_HandleAudioDevice(t *testing.T) {
+	m := newTestManager(t)
+
+	if !m.handleAudioDevice("alsa/hdmi") {
+		t.Fatal("handleAudioDevice rejected a device name")
+	}
+	if got := m.State.Snapshot().AudioDevice; got != "alsa/hdmi" {
+		t.Errorf("AudioDevice = %q, want %q", got, "alsa/hdmi")
+	}
+	if m.handleAudioDevice(42.0) {
+		t.Error("handleAudioDevice accepted a non-string value")
+	}
+}
+
+func TestFirstUpcomingAutoplay(t *testing.T) {
+	autoplay := map[string]bool{"radio1": true, "radio2": true, "played": true}
+	isAutoplay := func(url string) bool { return autoplay[url] }
+
+	tests := []struct {
+		name    string
+		entries []MpvPlaylistEntry
+		want    int
+	}{
+		{
+			name: "ahead of radio",
+			entries: []MpvPlaylistEntry{
+				{Filename: "played"}, {Filename: "song", Current: true}, {Filename: "request"},
+				{Filename: "radio1"}, {Filename: "radio2"}, {Filename: "new"},
+			},
+			want: 3,
+		},
+		{
+			name: "radio playing now",
+			entries: []MpvPlaylistEntry{
+				{Filename: "radio1", Current: true}, {Filename: "radio2"}, {Filename: "new"},
+			},
+			want: 1,
+		},
+		{
+			name:    "no radio upcoming",
+			entries: []MpvPlaylistEntry{{Filename: "played"}, {Filename: "song", Current: true}, {Filename: "new"}},
+			want:    -1,
+		},
+		{
+			name:    "idle",
+			entries: []MpvPlaylistEntry{{Filename: "radio1"}, {Filename: "new"}},
+			want:    -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := firstUpcomingAutoplay(tt.entries, isAutoplay); got != tt.want {
+				t.Errorf("firstUpcomingAutoplay = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManager_BroadcastAfterStop(t *testing.T) {
+	m := newTestManager(t)
+	serveFakePlaylistMpv(t, m.cfg.MpvSocket)
+	if err := m.ipc.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	m.State.SetPlaylist([]MpvPlaylistEntry{{Filename: "a.mp3", ID: 1}})
+	m.Stop()
+
+	// A merged vote from a connection still open during shutdown.
+	m.Vote(1)
+	m.broadcastState()
+	if _, ok := <-m.StateUpdates; ok {
+		t.Error("StateUpdates should stay closed")
+	}
+}
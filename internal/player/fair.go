@@ -0,0 +1,178 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package player
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+type QueueOrder string
+
+const (
+	// OrderAppend plays requests in the order they arrived.
+	OrderAppend QueueOrder = "append"
+	// OrderFair takes one upcoming track from each requester in turn.
+	OrderFair QueueOrder = "fair"
+)
+
+func ParseQueueOrder(s string) (QueueOrder, bool) {
+	switch order := QueueOrder(s); order {
+	case OrderAppend, OrderFair:
+		return order, true
+	}
+	return "", false
+}
+
+// fairSlot is an upcoming playlist entry as fair ordering sees it. Fixed
+// entries, pinned by a host or picked by autoplay, keep their position.
+type fairSlot struct {
+	id        int
+	requester string
+	fixed     bool
+}
+
+// fairOrder returns the entry IDs of slots in their fair order. Requesters
+// take turns in the order their first waiting track appears, and each
+// requester's own tracks keep their relative order.
+func fairOrder(slots []fairSlot) []int {
+	var requesters []string
+	waiting := make(map[string][]int)
+	movable := 0
+	for _, slot := range slots {
+		if slot.fixed {
+			continue
+		}
+		if _, ok := waiting[slot.requester]; !ok {
+			requesters = append(requesters, slot.requester)
+		}
+		waiting[slot.requester] = append(waiting[slot.requester], slot.id)
+		movable++
+	}
+
+	interleaved := make([]int, 0, movable)
+	for len(interleaved) < movable {
+		for _, requester := range requesters {
+			if ids := waiting[requester]; len(ids) > 0 {
+				interleaved = append(interleaved, ids[0])
+				waiting[requester] = ids[1:]
+			}
+		}
+	}
+
+	order := make([]int, len(slots))
+	next := 0
+	for i, slot := range slots {
+		if slot.fixed {
+			order[i] = slot.id
+			continue
+		}
+		order[i] = interleaved[next]
+		next++
+	}
+	return order
+}
+
+// SetQueueOrder switches between append and fair ordering and saves the
+// choice to config.json. Switching to fair reorders the waiting tracks
+// straight away; switching back leaves them where they are.
+func (m *Manager) SetQueueOrder(order QueueOrder) error {
+	m.enqueueMu.Lock()
+	m.queueOrder = order
+	m.State.SetQueueOrder(order)
+	m.broadcastState()
+	var err error
+	if order == OrderFair {
+		err = m.applyFairOrderLocked()
+	}
+	m.enqueueMu.Unlock()
+
+	m.saveQueueOrder()
+	return err
+}
+
+// saveQueueOrder writes the queue order to config.json without holding
+// enqueueMu for the file I/O. It reads the order under settingsMu, so that
+// of two quick switches the later one is what ends up saved.
+func (m *Manager) saveQueueOrder() {
+	if m.cfg.ConfigPath == "" {
+		return
+	}
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+
+	m.enqueueMu.Lock()
+	order := m.queueOrder
+	m.enqueueMu.Unlock()
+	if err := savePlayerSettingLocked(m.cfg.ConfigPath, "queue_order", order); err != nil {
+		m.logger.Warn("Failed to save queue order", "error", err)
+	}
+}
+
+// Move moves a playlist entry and pins it, so that fair ordering leaves it
+// where the host put it.
+func (m *Manager) Move(from, to int) error {
+	m.enqueueMu.Lock()
+	defer m.enqueueMu.Unlock()
+
+	id := m.State.EntryID(from)
+	if _, err := m.ipc.Exec("playlist-move", from, to); err != nil {
+		return err
+	}
+	if id != 0 {
+		m.State.Pin(id)
+		m.broadcastState()
+	}
+	return nil
+}
+
+// applyFairOrderLocked moves the upcoming entries into fair order. The
+// caller holds enqueueMu.
+func (m *Manager) applyFairOrderLocked() error {
+	entries, err := m.playlistEntries()
+	if err != nil {
+		return err
+	}
+	current := slices.IndexFunc(entries, func(e MpvPlaylistEntry) bool { return e.Current || e.Playing })
+	if current < 0 {
+		return nil
+	}
+
+	start := current + 1
+	upcoming := entries[start:]
+	order := fairOrder(m.State.fairSlots(upcoming))
+
+	ids := make([]int, len(upcoming))
+	for i, entry := range upcoming {
+		ids[i] = entry.ID
+	}
+	for pos, id := range order {
+		from := slices.Index(ids, id)
+		if from == pos {
+			continue
+		}
+		if _, err := m.ipc.Exec("playlist-move", start+from, start+pos); err != nil {
+			return fmt.Errorf("failed to reorder playlist: %w", err)
+		}
+		// Every earlier position is final, so from is always after pos.
+		ids = slices.Insert(slices.Delete(ids, from, from+1), pos, id)
+	}
+	return nil
+}
+
+func (m *Manager) playlistEntries() ([]MpvPlaylistEntry, error) {
+	raw, err := m.ipc.Exec("get_property", "playlist")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read playlist: %w", err)
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var entries []MpvPlaylistEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to decode playlist: %w", err)
+	}
+	return entries, nil
+}
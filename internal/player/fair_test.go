@@ -0,0 +1,162 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package player
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/reuski/skaldi/internal/resolver"
+)
+
+func TestFairOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		slots []fairSlot
+		want  []int
+	}{
+		{
+			name: "empty",
+			want: []int{},
+		},
+		{
+			name: "one_requester_keeps_order",
+			slots: []fairSlot{
+				{id: 1, requester: "a"}, {id: 2, requester: "a"}, {id: 3, requester: "a"},
+			},
+			want: []int{1, 2, 3},
+		},
+		{
+			name: "playlist_then_single",
+			slots: []fairSlot{
+				{id: 1, requester: "a"}, {id: 2, requester: "a"}, {id: 3, requester: "a"},
+				{id: 4, requester: "b"},
+			},
+			want: []int{1, 4, 2, 3},
+		},
+		{
+			name: "three_requesters",
+			slots: []fairSlot{
+				{id: 1, requester: "a"}, {id: 2, requester: "a"},
+				{id: 3, requester: "b"}, {id: 4, requester: "b"},
+				{id: 5, requester: "c"},
+			},
+			want: []int{1, 3, 5, 2, 4},
+		},
+		{
+			name: "fixed_slots_stay",
+			slots: []fairSlot{
+				{id: 1, requester: "a"}, {id: 2, requester: "a"},
+				{id: 3, requester: "b", fixed: true},
+				{id: 4, requester: "b"},
+				{id: 5, fixed: true},
+			},
+			want: []int{1, 4, 3, 2, 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fairOrder(tt.slots); !slices.Equal(got, tt.want) {
+				t.Errorf("fairOrder = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestState_FairSlots(t *testing.T) {
+	s := NewState()
+	s.StoreMetadata("a.mp3", resolver.Track{Title: "A", RequesterID: "anna"})
+	s.StoreMetadata("b.mp3", resolver.Track{Title: "B", Autoplay: true})
+	s.StoreMetadata("c.mp3", resolver.Track{Title: "C", RequesterID: "ben"})
+	entries := []MpvPlaylistEntry{
+		{Filename: "a.mp3", ID: 1},
+		{Filename: "b.mp3", ID: 2},
+		{Filename: "c.mp3", ID: 3},
+	}
+	s.SetIdle(false)
+	s.SetPlaylist(entries)
+	s.SetPlaylistPos(0)
+	s.Pin(3)
+
+	want := []fairSlot{
+		{id: 1, requester: "anna"},
+		{id: 2, fixed: true},
+		{id: 3, requester: "ben", fixed: true},
+	}
+	if got := s.fairSlots(entries); !slices.Equal(got, want) {
+		t.Errorf("fairSlots = %+v, want %+v", got, want)
+	}
+	if got := s.Snapshot().Upcoming[1]; !got.Pinned {
+		t.Errorf("Upcoming[1].Pinned = false, want true")
+	}
+
+	s.SetPlaylist(entries[:2])
+	s.SetPlaylist(entries)
+	if got := s.Snapshot().Upcoming[1]; got.Pinned {
+		t.Errorf("Pinned after removal = true, want false")
+	}
+}
+
+func TestManager_SetQueueOrderSavesOutsideEnqueueLock(t *testing.T) {
+	m := newTestManager(t)
+	m.cfg.ConfigPath = filepath.Join(t.TempDir(), "config.json")
+	serveFakePlaylistMpv(t, m.cfg.MpvSocket)
+	if err := m.ipc.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer m.ipc.Close()
+
+	// While config.json is busy, the switch still takes effect and tracks
+	// can still be queued.
+	settingsMu.Lock()
+	done := make(chan error, 1)
+	go func() { done <- m.SetQueueOrder(OrderFair) }()
+	for m.State.Snapshot().QueueOrder != OrderFair {
+		time.Sleep(time.Millisecond)
+	}
+	enqueued := make(chan error, 1)
+	go func() { enqueued <- m.Enqueue("https://example.com/a", false) }()
+	select {
+	case err := <-enqueued:
+		if err != nil {
+			t.Errorf("Enqueue failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("Enqueue waited for the config to be saved")
+	}
+	settingsMu.Unlock()
+
+	if err := <-done; err != nil {
+		t.Fatalf("SetQueueOrder failed: %v", err)
+	}
+	cfg, err := loadPlayerConfig(m.cfg.ConfigPath)
+	if err != nil {
+		t.Fatalf("loadPlayerConfig failed: %v", err)
+	}
+	if cfg.QueueOrder != OrderFair {
+		t.Errorf("saved queue_order = %q, want fair", cfg.QueueOrder)
+	}
+}
+
+func TestManager_QueueChangesAfterStop(t *testing.T) {
+	m := newTestManager(t)
+	serveFakePlaylistMpv(t, m.cfg.MpvSocket)
+	if err := m.ipc.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	m.State.SetPlaylist([]MpvPlaylistEntry{{Filename: "a.mp3", ID: 1}, {Filename: "b.mp3", ID: 2}})
+	m.Stop()
+
+	// Late HTTP and WebSocket requests and scheduled jobs may still reach
+	// the manager; they can fail, but must not panic.
+	_ = m.SetQueueOrder(OrderFair)
+	_ = m.SetQueueOrder(OrderAppend)
+	_ = m.Move(1, 0)
+	m.Vote(2)
+	if m.State.Snapshot().QueueOrder != OrderAppend {
+		t.Error("queue order should still be recorded")
+	}
+}
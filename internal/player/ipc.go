@@ -11,18 +11,31 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/reuski/skaldi/internal/metrics"
+)
+
+const errConnectionClosed = "connection closed"
+
+var (
+	ipcExecDuration = metrics.NewHistogram("skaldi_mpv_ipc_exec_duration_seconds",
+		"Time from sending an mpv IPC command to its reply.", metrics.LatencyBuckets, "command")
+	ipcExecTimeouts = metrics.NewCounter("skaldi_mpv_ipc_exec_timeouts_total",
+		"mpv IPC commands that got no reply in time.", "command")
 )
 
 type IPCClient struct {
 	socketPath string
 	conn       net.Conn
+	connMu     sync.Mutex
 	logger     *slog.Logger
 
 	nextReqID uint64
 	pending   map[uint64]chan Response
 	pendingMu sync.Mutex
 
-	Events chan Event
+	Events    chan Event
+	lastEvent atomic.Int64
 
 	quit chan struct{}
 	wg   sync.WaitGroup
@@ -56,6 +69,14 @@ func NewIPCClient(socketPath string, logger *slog.Logger) *IPCClient {
 }
 
 func (c *IPCClient) Connect() error {
+	c.connMu.Lock()
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+	c.connMu.Unlock()
+	c.wg.Wait()
+
 	var conn net.Conn
 	var err error
 
@@ -71,19 +92,38 @@ func (c *IPCClient) Connect() error {
 		return fmt.Errorf("failed to connect to mpv socket after retries: %w", err)
 	}
 
+	c.connMu.Lock()
 	c.conn = conn
+	c.connMu.Unlock()
 
 	c.wg.Add(1)
-	go c.readLoop()
+	go c.readLoop(conn)
 
 	return nil
 }
 
+func (c *IPCClient) Connected() bool {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	return c.conn != nil
+}
+
+// LastEvent returns when mpv last sent an event, or the zero time if it
+// never has.
+func (c *IPCClient) LastEvent() time.Time {
+	if nanos := c.lastEvent.Load(); nanos != 0 {
+		return time.Unix(0, nanos)
+	}
+	return time.Time{}
+}
+
 func (c *IPCClient) Close() {
 	close(c.quit)
+	c.connMu.Lock()
 	if c.conn != nil {
 		c.conn.Close()
 	}
+	c.connMu.Unlock()
 	c.wg.Wait()
 }
 
@@ -113,24 +153,46 @@ func (c *IPCClient) Exec(args ...interface{}) (interface{}, error) {
 
 	data = append(data, '\n')
 
-	if _, err := c.conn.Write(data); err != nil {
+	c.connMu.Lock()
+	conn := c.conn
+	c.connMu.Unlock()
+	if conn == nil {
+		return nil, fmt.Errorf("not connected to mpv")
+	}
+
+	var name string
+	if len(args) > 0 {
+		name = fmt.Sprint(args[0])
+	}
+	start := time.Now()
+	if _, err := conn.Write(data); err != nil {
 		return nil, fmt.Errorf("write failed: %w", err)
 	}
 
 	select {
 	case resp := <-respChan:
+		ipcExecDuration.Observe(time.Since(start).Seconds(), name)
 		if resp.Error != "success" && resp.Error != "" {
 			return nil, fmt.Errorf("mpv error: %s", resp.Error)
 		}
 		return resp.Data, nil
 	case <-time.After(5 * time.Second):
+		ipcExecTimeouts.Inc(name)
 		return nil, fmt.Errorf("timeout waiting for response")
 	}
 }
 
-func (c *IPCClient) readLoop() {
+func (c *IPCClient) readLoop(conn net.Conn) {
 	defer c.wg.Done()
-	scanner := bufio.NewScanner(c.conn)
+	defer c.failPending()
+	defer func() {
+		c.connMu.Lock()
+		if c.conn == conn {
+			c.conn = nil
+		}
+		c.connMu.Unlock()
+	}()
+	scanner := bufio.NewScanner(conn)
 
 	for scanner.Scan() {
 		line := scanner.Bytes()
@@ -148,10 +210,15 @@ func (c *IPCClient) readLoop() {
 		}
 
 		if msg.Event != "" {
-			c.Events <- Event{
+			c.lastEvent.Store(time.Now().UnixNano())
+			select {
+			case c.Events <- Event{
 				Event: msg.Event,
 				Name:  msg.Name,
 				Data:  msg.Data,
+			}:
+			case <-c.quit:
+				return
 			}
 		} else {
 			c.pendingMu.Lock()
@@ -170,3 +237,15 @@ func (c *IPCClient) readLoop() {
 
 	c.logger.Debug("IPC read loop exited")
 }
+
+func (c *IPCClient) failPending() {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+
+	for reqID, ch := range c.pending {
+		select {
+		case ch <- Response{RequestID: reqID, Error: errConnectionClosed}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package player
+
+import (
+	"bufio"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func serveFakeMpv(t *testing.T, socketPath string, respond bool) net.Listener {
+	t.Helper()
+
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					var cmd Command
+					if err := json.Unmarshal(scanner.Bytes(), &cmd); err != nil {
+						continue
+					}
+					if !respond {
+						return
+					}
+					data, _ := json.Marshal(Response{RequestID: cmd.RequestID, Error: "success"})
+					_, _ = conn.Write(append(data, '\n'))
+				}
+			}(conn)
+		}
+	}()
+
+	return ln
+}
+
+func TestIPCClient_Reconnect(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "mpv.sock")
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	c := NewIPCClient(socketPath, logger)
+
+	ln := serveFakeMpv(t, socketPath, true)
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if !c.Connected() {
+		t.Fatal("Connected should be true after Connect")
+	}
+	if _, err := c.Exec("get_property", "pause"); err != nil {
+		t.Fatalf("Exec failed: %v", err)
+	}
+
+	ln.Close()
+	os.Remove(socketPath)
+
+	ln = serveFakeMpv(t, socketPath, true)
+	defer ln.Close()
+	if err := c.Connect(); err != nil {
+		t.Fatalf("reconnect failed: %v", err)
+	}
+	if _, err := c.Exec("get_property", "pause"); err != nil {
+		t.Fatalf("Exec after reconnect failed: %v", err)
+	}
+	c.Close()
+}
+
+func TestIPCClient_ClosedConnectionFailsPending(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "mpv.sock")
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	c := NewIPCClient(socketPath, logger)
+
+	ln := serveFakeMpv(t, socketPath, false)
+	defer ln.Close()
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer c.Close()
+
+	start := time.Now()
+	_, err := c.Exec("get_property", "pause")
+	if err == nil || !strings.Contains(err.Error(), errConnectionClosed) {
+		t.Fatalf("Exec error = %v, want %q", err, errConnectionClosed)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("Exec took %v, want an immediate failure", time.Since(start))
+	}
+	if c.Connected() {
+		t.Error("Connected should be false once mpv closes the socket")
+	}
+}
+
+func TestIPCClient_ExecWithoutConnection(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	c := NewIPCClient(filepath.Join(t.TempDir(), "mpv.sock"), logger)
+
+	if _, err := c.Exec("get_property", "pause"); err == nil {
+		t.Fatal("Exec should fail before Connect")
+	}
+}
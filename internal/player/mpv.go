@@ -9,41 +9,113 @@ import (
 	"log/slog"
 	"os"
 	"os/exec"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/reuski/skaldi/internal/bootstrap"
 	"github.com/reuski/skaldi/internal/history"
+	"github.com/reuski/skaldi/internal/metrics"
+	"github.com/reuski/skaldi/internal/resolver"
 )
 
+var mpvRestarts = metrics.NewCounter("skaldi_mpv_restarts_total",
+	"Times mpv exited unexpectedly and was restarted.")
+
 type Manager struct {
-	cfg     *bootstrap.Config
-	logger  *slog.Logger
-	ipc     *IPCClient
-	history *history.Logger
+	cfg       *bootstrap.Config
+	playerCfg playerConfig
+	logger    *slog.Logger
+	ipc       *IPCClient
+	history   *history.Logger
+	resolver  *resolver.Resolver
+	scrobbles *scrobbler
 
 	cmd *exec.Cmd
 
 	State        *State
 	StateUpdates chan Snapshot
+	Notices      chan Notice
+	// QueueDrained receives a value each time playback runs off the end of
+	// the playlist.
+	QueueDrained chan struct{}
+
+	// noticesMu guards sending on StateUpdates, Notices and QueueDrained
+	// against Stop closing them.
+	noticesMu     sync.Mutex
+	noticesClosed bool
 
 	tempFiles   map[string]bool
 	tempFilesMu sync.Mutex
 
+	enqueueMu  sync.Mutex
+	queueOrder QueueOrder
+
+	audioMu     sync.Mutex
+	audio       audioConfig
+	audioDevice string
+
+	sleepMu sync.Mutex
+	sleep   *sleepTimer
+
 	stopping atomic.Bool
+
+	queueRestored atomic.Bool
+	recovering    atomic.Bool
+	lastCrashFile string
+	lastCrashAt   time.Time
+	saveMu        sync.Mutex
+	lastSaved     []byte
+	seekMu        sync.Mutex
+	pendingSeek   *pendingSeek
 }
 
 func NewManager(cfg *bootstrap.Config, logger *slog.Logger) *Manager {
-	return &Manager{
+	playerCfg, err := loadPlayerConfig(cfg.ConfigPath)
+	if err != nil {
+		logger.Warn("Ignoring player config", "error", err)
+	}
+	audio, err := normalizeAudioConfig(playerCfg.Audio)
+	if err != nil {
+		logger.Warn("Ignoring invalid audio settings", "error", err)
+	}
+	queueOrder := OrderAppend
+	if playerCfg.QueueOrder != "" {
+		if order, ok := ParseQueueOrder(string(playerCfg.QueueOrder)); ok {
+			queueOrder = order
+		} else {
+			logger.Warn("Ignoring unknown queue order", "queue_order", playerCfg.QueueOrder)
+		}
+	}
+
+	m := &Manager{
 		cfg:          cfg,
+		playerCfg:    playerCfg,
 		logger:       logger,
 		ipc:          NewIPCClient(cfg.MpvSocket, logger),
 		history:      history.New(cfg.DataDir, logger),
 		State:        NewState(),
 		StateUpdates: make(chan Snapshot, 100),
+		Notices:      make(chan Notice, 10),
+		QueueDrained: make(chan struct{}, 1),
 		tempFiles:    make(map[string]bool),
+		audio:        audio,
+		audioDevice:  playerCfg.AudioDevice,
+		queueOrder:   queueOrder,
 	}
+	m.State.SetAudio(audio.Preset, audio.Equalizer)
+	m.State.SetQueueOrder(queueOrder)
+	return m
+}
+
+func (m *Manager) SetResolver(r *resolver.Resolver) {
+	m.resolver = r
+	path := ""
+	if m.cfg.StateDir != "" {
+		path = m.cfg.ScrobbleQueuePath()
+	}
+	m.scrobbles = newScrobbler(r, m.logger, path)
 }
 
 func (m *Manager) RegisterTempFile(path string) {
@@ -101,63 +173,24 @@ func (m *Manager) StartMetadataGC(ctx context.Context) {
 	}()
 }
 
-const dailyClearRetry = 30 * time.Second
-
-func (m *Manager) StartDailyPlaylistClear(ctx context.Context) {
-	go func() {
-		var lastDate string
-		pendingClear := false
-
-		for {
-			now := time.Now()
-			today := now.Local().Format("2006-01-02")
-
-			if lastDate != "" && lastDate != today {
-				pendingClear = true
-			}
-			lastDate = today
-
-			var wait time.Duration
-			if pendingClear {
-				if m.clearIfIdle() {
-					pendingClear = false
-					wait = time.Until(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, 1))
-				} else {
-					wait = dailyClearRetry
-				}
-			} else {
-				wait = time.Until(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, 1))
-			}
-
-			if wait < time.Second {
-				wait = time.Second
-			}
-
-			select {
-			case <-ctx.Done():
-				return
-			case <-time.After(wait):
-			}
-		}
-	}()
-}
-
-func (m *Manager) clearIfIdle() bool {
+// ClearIfIdle empties the playlist and recent history, but only once nothing
+// is playing or waiting to play. It reports whether it cleared.
+func (m *Manager) ClearIfIdle() bool {
 	snap := m.State.Snapshot()
 
 	if snap.Status != StatusIdle {
-		m.logger.Debug("Skipping daily playlist clear: still playing")
+		m.logger.Debug("Skipping playlist clear: still playing")
 		return false
 	}
 
 	if len(snap.Upcoming) > 0 || snap.NowPlaying != nil {
-		m.logger.Debug("Skipping daily playlist clear: upcoming tracks remain")
+		m.logger.Debug("Skipping playlist clear: upcoming tracks remain")
 		return false
 	}
 
-	m.logger.Debug("Clearing daily playlist (idle, empty queue)")
+	m.logger.Debug("Clearing playlist (idle, empty queue)")
 	if _, err := m.ipc.Exec("playlist-clear"); err != nil {
-		m.logger.Error("Failed to clear playlist for daily reset", "error", err)
+		m.logger.Error("Failed to clear playlist", "error", err)
 	}
 	m.State.mu.Lock()
 	m.State.recentPlayed = nil
@@ -170,8 +203,12 @@ func (m *Manager) Run(ctx context.Context) error {
 	defer m.CleanupTempFiles()
 	m.StartEventLoop(ctx)
 	m.StartMetadataGC(ctx)
-	m.StartDailyPlaylistClear(ctx)
+	m.StartQueuePersistence(ctx)
+	if m.scrobbles != nil {
+		m.scrobbles.start(ctx)
+	}
 
+	var recovery *crashRecovery
 	for {
 		if err := ctx.Err(); err != nil {
 			return err
@@ -193,6 +230,13 @@ func (m *Manager) Run(ctx context.Context) error {
 			}
 		}
 
+		if !m.queueRestored.Load() {
+			m.restoreQueue(ctx)
+		} else if recovery != nil {
+			m.recoverQueue(ctx, *recovery)
+			recovery = nil
+		}
+
 		if err := m.cmd.Wait(); err != nil {
 			if !m.stopping.Load() {
 				m.logger.Warn("mpv exited unexpectedly", "error", err)
@@ -202,6 +246,13 @@ func (m *Manager) Run(ctx context.Context) error {
 		if m.stopping.Load() {
 			return nil
 		}
+		if ctx.Err() == nil {
+			mpvRestarts.Inc()
+		}
+		if ctx.Err() == nil && recovery == nil {
+			r := m.captureRecovery()
+			recovery = &r
+		}
 
 		select {
 		case <-ctx.Done():
@@ -213,6 +264,8 @@ func (m *Manager) Run(ctx context.Context) error {
 }
 
 func (m *Manager) Stop() {
+	m.CancelSleep()
+	m.saveQueue()
 	m.stopping.Store(true)
 	if m.ipc != nil {
 		_, _ = m.ipc.Exec("quit")
@@ -221,7 +274,15 @@ func (m *Manager) Stop() {
 	if m.history != nil {
 		m.history.Close()
 	}
+	if m.scrobbles != nil {
+		m.scrobbles.close()
+	}
+	m.noticesMu.Lock()
+	m.noticesClosed = true
 	close(m.StateUpdates)
+	close(m.Notices)
+	close(m.QueueDrained)
+	m.noticesMu.Unlock()
 }
 
 func (m *Manager) start(ctx context.Context) error {
@@ -232,16 +293,24 @@ func (m *Manager) start(ctx context.Context) error {
 	shimPath := m.cfg.ShimPath()
 	jsRuntime := fmt.Sprintf("js-runtimes=bun:%s", m.cfg.BunPath())
 
+	m.audioMu.Lock()
+	audioFilters := filterChain(m.audio)
+	audioDevice := m.audioDevice
+	m.audioMu.Unlock()
+
 	args := []string{
 		"--idle=yes",
 		"--no-video",
 		"--no-terminal",
 		fmt.Sprintf("--input-ipc-server=%s", m.cfg.MpvSocket),
 		"--ytdl-format=bestaudio/best",
-		"--af=dynaudnorm",
+		"--af=" + audioFilters,
 		fmt.Sprintf("--script-opts=ytdl_hook-ytdl_path=%s", shimPath),
 		fmt.Sprintf("--ytdl-raw-options=%s", jsRuntime),
 	}
+	if audioDevice != "" {
+		args = append(args, "--audio-device="+audioDevice)
+	}
 
 	cmd := exec.CommandContext(ctx, "mpv", args...)
 	cmd.Stdout = os.Stdout
@@ -294,7 +363,101 @@ func (m *Manager) Exec(args ...any) (any, error) {
 	return m.ipc.Exec(args...)
 }
 
+func (m *Manager) IPCConnected() bool {
+	return m.ipc.Connected()
+}
+
+func (m *Manager) LastEventAt() time.Time {
+	return m.ipc.LastEvent()
+}
+
 func (m *Manager) PlayIndex(targetIdx int) error {
 	_, err := m.ipc.Exec("playlist-play-index", targetIdx)
 	return err
 }
+
+// Enqueue appends url to the playlist, starting playback if mpv is idle.
+// Requested tracks are moved ahead of any autoplay tracks still waiting to
+// play, so listeners never queue behind the radio, and then into their fair
+// turn when fair ordering is on.
+func (m *Manager) Enqueue(url string, autoplay bool) error {
+	m.enqueueMu.Lock()
+	defer m.enqueueMu.Unlock()
+
+	if _, err := m.ipc.Exec("loadfile", url, "append-play"); err != nil {
+		return err
+	}
+	if autoplay {
+		return nil
+	}
+
+	entries, err := m.playlistEntries()
+	if err != nil {
+		return err
+	}
+	if target := firstUpcomingAutoplay(entries, m.State.IsAutoplay); target >= 0 {
+		if _, err := m.ipc.Exec("playlist-move", len(entries)-1, target); err != nil {
+			return err
+		}
+	}
+	if m.queueOrder == OrderFair {
+		return m.applyFairOrderLocked()
+	}
+	return nil
+}
+
+// firstUpcomingAutoplay returns the index of the first autoplay entry after
+// the current one, or -1. The last entry is the one just appended and is
+// never a candidate.
+func firstUpcomingAutoplay(entries []MpvPlaylistEntry, isAutoplay func(string) bool) int {
+	current := slices.IndexFunc(entries, func(e MpvPlaylistEntry) bool { return e.Current || e.Playing })
+	if current < 0 {
+		return -1
+	}
+	for i := current + 1; i < len(entries)-1; i++ {
+		if isAutoplay(entries[i].Filename) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Vote merges a repeat request into the playlist entry with the given ID.
+func (m *Manager) Vote(id int) {
+	m.State.AddVote(id)
+	m.broadcastState()
+}
+
+func (m *Manager) SetRepeat(mode RepeatMode) error {
+	loopFile, loopPlaylist := "no", "no"
+	switch mode {
+	case RepeatOne:
+		loopFile = "inf"
+	case RepeatAll:
+		loopPlaylist = "inf"
+	case RepeatOff:
+	default:
+		return fmt.Errorf("invalid repeat mode: %s", mode)
+	}
+
+	if _, err := m.ipc.Exec("set_property", "loop-file", loopFile); err != nil {
+		return err
+	}
+	_, err := m.ipc.Exec("set_property", "loop-playlist", loopPlaylist)
+	return err
+}
+
+// SetShuffle reorders the playlist and records the mode in mpv's shuffle
+// option, which is what clients observe. Unshuffling restores the order from
+// before the last shuffle.
+func (m *Manager) SetShuffle(shuffle bool) error {
+	command := "playlist-unshuffle"
+	if shuffle {
+		command = "playlist-shuffle"
+	}
+	if _, err := m.ipc.Exec(command); err != nil {
+		return err
+	}
+	_, err := m.ipc.Exec("set_property", "shuffle", shuffle)
+	return err
+}
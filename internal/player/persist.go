@@ -0,0 +1,380 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package player
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/reuski/skaldi/internal/resolver"
+)
+
+const (
+	queueSaveInterval     = 5 * time.Second
+	restoreResolveTimeout = 10 * time.Second
+	restoreResolveWorkers = 4
+)
+
+type savedQueue struct {
+	Position int          `json:"position"`
+	TimePos  float64      `json:"time_pos"`
+	Entries  []savedEntry `json:"entries"`
+	Recent   []QueueItem  `json:"recent,omitempty"`
+}
+
+type savedEntry struct {
+	Filename string          `json:"filename"`
+	Track    *resolver.Track `json:"track,omitempty"`
+}
+
+// pendingSeek is where to resume a restored entry once it has loaded. It
+// names the entry by filename, as restoring moves it around the playlist.
+type pendingSeek struct {
+	filename string
+	time     float64
+}
+
+func (s *State) savedQueue() savedQueue {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	saved := savedQueue{
+		Position: -1,
+		Entries:  make([]savedEntry, 0, len(s.playlist)),
+	}
+
+	for _, entry := range s.playlist {
+		item := savedEntry{Filename: entry.Filename}
+		if track, ok := s.metadata[entry.Filename]; ok {
+			item.Track = &track
+		}
+		saved.Entries = append(saved.Entries, item)
+	}
+
+	if !s.idleActive && s.playlistPos >= 0 && s.playlistPos < len(s.playlist) {
+		saved.Position = s.playlistPos
+		saved.TimePos = s.timePos
+	}
+
+	recent := s.recentPlayed
+	if s.idleActive && s.currentItem != nil {
+		recent = appendRecent(append([]QueueItem(nil), recent...), *s.currentItem)
+	}
+	for _, item := range recent {
+		// Playlist entry IDs are only meaningful to the mpv process that
+		// assigned them.
+		item.ID = 0
+		item.Index = -1
+		saved.Recent = append(saved.Recent, item)
+	}
+
+	return saved
+}
+
+// forDisk returns q as it is saved to disk. Tracks from sources with opaque
+// queue URLs keep only those, as their stream URLs may carry credentials,
+// and are resolved again when the queue is restored.
+func (q savedQueue) forDisk() savedQueue {
+	out := q
+	out.Entries = make([]savedEntry, len(q.Entries))
+	for i, entry := range q.Entries {
+		if entry.Track != nil && resolver.IsSourceURL(entry.Track.WebpageURL) {
+			track := *entry.Track
+			track.URL = ""
+			entry = savedEntry{Filename: track.WebpageURL, Track: &track}
+		}
+		out.Entries[i] = entry
+	}
+	out.Recent = make([]QueueItem, len(q.Recent))
+	for i, item := range q.Recent {
+		if item.Metadata != nil && resolver.IsSourceURL(item.Metadata.WebpageURL) {
+			track := *item.Metadata
+			track.URL = ""
+			item.Filename = track.WebpageURL
+			item.Metadata = &track
+		}
+		out.Recent[i] = item
+	}
+	return out
+}
+
+func loadSavedQueue(path string) (savedQueue, bool, error) {
+	var saved savedQueue
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return saved, false, nil
+		}
+		return saved, false, fmt.Errorf("failed to read saved queue: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return savedQueue{}, false, fmt.Errorf("invalid saved queue at %s: %w", path, err)
+	}
+	return saved, true, nil
+}
+
+func writeSavedQueue(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create state dir: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write saved queue: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to replace saved queue: %w", err)
+	}
+	return nil
+}
+
+func (m *Manager) persistQueueEnabled() bool {
+	return m.playerCfg.PersistQueue && m.cfg.StateDir != ""
+}
+
+func (m *Manager) StartQueuePersistence(ctx context.Context) {
+	if !m.persistQueueEnabled() {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(queueSaveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.saveQueue()
+			}
+		}
+	}()
+}
+
+func (m *Manager) saveQueue() {
+	if !m.persistQueueEnabled() || !m.queueRestored.Load() || m.recovering.Load() {
+		return
+	}
+
+	m.saveMu.Lock()
+	defer m.saveMu.Unlock()
+
+	data, err := json.Marshal(m.State.savedQueue().forDisk())
+	if err != nil {
+		m.logger.Error("Failed to encode queue state", "error", err)
+		return
+	}
+	if bytes.Equal(data, m.lastSaved) {
+		return
+	}
+
+	if err := writeSavedQueue(m.cfg.QueueStatePath(), data); err != nil {
+		m.logger.Error("Failed to save queue state", "error", err)
+		return
+	}
+	m.lastSaved = data
+}
+
+func (m *Manager) restoreQueue(ctx context.Context) {
+	defer m.queueRestored.Store(true)
+
+	if !m.persistQueueEnabled() {
+		return
+	}
+
+	saved, ok, err := loadSavedQueue(m.cfg.QueueStatePath())
+	if err != nil {
+		m.logger.Warn("Ignoring saved queue", "error", err)
+		return
+	}
+	if !ok {
+		return
+	}
+
+	loaded, dropped := m.replayQueue(ctx, saved, true)
+	if loaded > 0 || dropped > 0 {
+		m.logger.Info("Restored saved queue", "tracks", loaded, "dropped", dropped)
+	}
+}
+
+// replayQueue loads a saved queue into mpv. The entry to resume is loaded
+// and played first, so a long queue whose entries have to be resolved again
+// does not hold up playback. The rest are refreshed concurrently and then
+// put around it in their saved order.
+func (m *Manager) replayQueue(ctx context.Context, saved savedQueue, refresh bool) (loaded, dropped int) {
+	m.State.SetRecentPlayed(saved.Recent)
+
+	prepare := func(entry savedEntry) (savedEntry, bool) {
+		if !refresh {
+			return entry, entry.Filename != ""
+		}
+		return m.refreshSavedEntry(ctx, entry)
+	}
+
+	// Resume at the saved position, or at the first entry after it that
+	// can still be played.
+	resumeFrom, resumed, next := 0, -1, 0
+	if saved.Position >= 0 {
+		resumeFrom, next = saved.Position, saved.Position
+		for i := saved.Position; i < len(saved.Entries) && resumed < 0; i++ {
+			if ctx.Err() != nil {
+				return loaded, dropped
+			}
+			next = i + 1
+			entry, ok := prepare(saved.Entries[i])
+			if !ok || !m.loadSavedEntry(entry) {
+				dropped++
+				continue
+			}
+			resumed = i
+			loaded++
+			if i == saved.Position && saved.TimePos > 0 {
+				m.seekMu.Lock()
+				m.pendingSeek = &pendingSeek{filename: entry.Filename, time: saved.TimePos}
+				m.seekMu.Unlock()
+			}
+			if err := m.PlayIndex(0); err != nil {
+				m.logger.Warn("Failed to resume restored queue", "error", err)
+			}
+		}
+	}
+
+	var rest []int
+	for i := range saved.Entries {
+		if i < resumeFrom || i >= next {
+			rest = append(rest, i)
+		}
+	}
+	entries := make([]savedEntry, len(rest))
+	ok := make([]bool, len(rest))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, restoreResolveWorkers)
+	for j, i := range rest {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			entries[j], ok[j] = prepare(saved.Entries[i])
+		}()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return loaded, dropped
+	}
+
+	m.enqueueMu.Lock()
+	defer m.enqueueMu.Unlock()
+
+	// Listeners may have queued tracks while the rest was refreshed.
+	length := loaded
+	if resumed >= 0 {
+		if current, err := m.playlistEntries(); err == nil {
+			length = len(current)
+		}
+	}
+	before := 0
+	for j, i := range rest {
+		if !ok[j] || !m.loadSavedEntry(entries[j]) {
+			dropped++
+			continue
+		}
+		loaded++
+		length++
+		if resumed < 0 || i > resumed {
+			continue
+		}
+		if _, err := m.ipc.Exec("playlist-move", length-1, before); err != nil {
+			m.logger.Warn("Failed to restore queue order", "url", entries[j].Filename, "error", err)
+		}
+		before++
+	}
+	return loaded, dropped
+}
+
+// loadSavedEntry appends entry to the playlist, reporting whether it was
+// added.
+func (m *Manager) loadSavedEntry(entry savedEntry) bool {
+	if entry.Track != nil {
+		m.State.StorePinnedMetadata(entry.Filename, *entry.Track)
+	}
+	if _, err := m.ipc.Exec("loadfile", entry.Filename, "append"); err != nil {
+		m.State.UnpinMetadata(entry.Filename)
+		m.logger.Warn("Failed to restore queue entry", "url", entry.Filename, "error", err)
+		return false
+	}
+	return true
+}
+
+func (m *Manager) refreshSavedEntry(ctx context.Context, entry savedEntry) (savedEntry, bool) {
+	if entry.Filename == "" {
+		return entry, false
+	}
+
+	if entry.Track != nil {
+		if resolver.IsSourceURL(entry.Track.WebpageURL) {
+			// Saved queues keep only the source's queue URL, as stream
+			// URLs may carry credentials.
+			if m.resolver == nil {
+				m.logger.Warn("Dropping queue entry without its source", "url", entry.Track.WebpageURL)
+				return entry, false
+			}
+			rCtx, cancel := context.WithTimeout(ctx, restoreResolveTimeout)
+			tracks, err := m.resolver.Resolve(rCtx, entry.Track.WebpageURL)
+			cancel()
+			if err != nil || len(tracks) == 0 || tracks[0].PlayableURL() == "" {
+				m.logger.Warn("Dropping stale queue entry", "url", entry.Track.WebpageURL, "error", err)
+				return entry, false
+			}
+			track := tracks[0]
+			return savedEntry{Filename: track.PlayableURL(), Track: &track}, true
+		}
+	}
+
+	if !strings.Contains(entry.Filename, "://") {
+		if _, err := os.Stat(entry.Filename); err != nil {
+			m.logger.Warn("Dropping stale queue entry", "path", entry.Filename, "error", err)
+			return entry, false
+		}
+	}
+
+	return entry, true
+}
+
+// applyPendingSeek seeks to the saved position once the restored entry has
+// loaded. If another track loads first, as when a listener skipped ahead,
+// the seek is dropped.
+func (m *Manager) applyPendingSeek() {
+	m.seekMu.Lock()
+	defer m.seekMu.Unlock()
+
+	if m.pendingSeek == nil {
+		return
+	}
+	item, _ := m.State.currentTrack()
+	if item == nil {
+		return
+	}
+
+	pending := m.pendingSeek
+	m.pendingSeek = nil
+	if item.Filename != pending.filename {
+		return
+	}
+	go func() {
+		if _, err := m.ipc.Exec("seek", pending.time, "absolute"); err != nil {
+			m.logger.Warn("Failed to seek to saved position", "time", pending.time, "error", err)
+		}
+	}()
+}
@@ -0,0 +1,327 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package player
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/reuski/skaldi/internal/bootstrap"
+	"github.com/reuski/skaldi/internal/resolver"
+)
+
+func TestState_SavedQueue(t *testing.T) {
+	s := NewState()
+	s.StoreMetadata("https://example.com/a", resolver.Track{Title: "A"})
+	s.SetPlaylist([]MpvPlaylistEntry{
+		{Filename: "https://example.com/a", ID: 1},
+		{Filename: "https://example.com/b", ID: 2},
+	})
+	s.SetPlaylistPos(0)
+	s.SetPlaylistPos(1)
+	s.SetTimePos(42)
+
+	saved := s.savedQueue()
+
+	if saved.Position != 1 {
+		t.Errorf("Position = %d, want 1", saved.Position)
+	}
+	if saved.TimePos != 42 {
+		t.Errorf("TimePos = %v, want 42", saved.TimePos)
+	}
+	if len(saved.Entries) != 2 {
+		t.Fatalf("len(Entries) = %d, want 2", len(saved.Entries))
+	}
+	if saved.Entries[0].Track == nil || saved.Entries[0].Track.Title != "A" {
+		t.Errorf("Entries[0].Track = %+v, want title A", saved.Entries[0].Track)
+	}
+	if saved.Entries[1].Track != nil {
+		t.Errorf("Entries[1].Track = %+v, want nil", saved.Entries[1].Track)
+	}
+	if len(saved.Recent) != 1 {
+		t.Fatalf("len(Recent) = %d, want 1", len(saved.Recent))
+	}
+	if saved.Recent[0].ID != 0 || saved.Recent[0].Index != -1 {
+		t.Errorf("Recent[0] = %+v, want ID 0 and Index -1", saved.Recent[0])
+	}
+}
+
+func TestState_SavedQueue_IdleHasNoPosition(t *testing.T) {
+	s := NewState()
+	s.SetPlaylist([]MpvPlaylistEntry{{Filename: "a.mp3", ID: 1}})
+	s.SetPlaylistPos(0)
+	s.SetTimePos(10)
+	s.SetIdle(true)
+
+	saved := s.savedQueue()
+
+	if saved.Position != -1 {
+		t.Errorf("Position = %d, want -1", saved.Position)
+	}
+	if saved.TimePos != 0 {
+		t.Errorf("TimePos = %v, want 0", saved.TimePos)
+	}
+	if len(saved.Recent) != 1 || saved.Recent[0].Filename != "a.mp3" {
+		t.Errorf("Recent = %+v, want the idle item", saved.Recent)
+	}
+}
+
+func TestState_PinnedMetadataSurvivesPrune(t *testing.T) {
+	s := NewState()
+	s.StorePinnedMetadata("a.mp3", resolver.Track{Title: "A"})
+	s.StorePinnedMetadata("b.mp3", resolver.Track{Title: "B"})
+
+	s.SetPlaylist([]MpvPlaylistEntry{{Filename: "a.mp3"}})
+	s.PruneMetadata()
+
+	s.mu.RLock()
+	_, hasB := s.metadata["b.mp3"]
+	s.mu.RUnlock()
+	if !hasB {
+		t.Fatal("b.mp3 should stay pinned until it reaches the playlist")
+	}
+
+	s.SetPlaylist([]MpvPlaylistEntry{{Filename: "a.mp3"}, {Filename: "b.mp3"}})
+	s.SetPlaylist([]MpvPlaylistEntry{{Filename: "a.mp3"}})
+	s.PruneMetadata()
+
+	s.mu.RLock()
+	_, hasB = s.metadata["b.mp3"]
+	s.mu.RUnlock()
+	if hasB {
+		t.Error("b.mp3 should be pruned once it has left the playlist")
+	}
+}
+
+func TestSavedQueue_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "queue.json")
+
+	if _, ok, err := loadSavedQueue(path); err != nil || ok {
+		t.Fatalf("loadSavedQueue(missing) = ok %v, err %v; want false, nil", ok, err)
+	}
+
+	want := savedQueue{
+		Position: 0,
+		TimePos:  12.5,
+		Entries:  []savedEntry{{Filename: "https://example.com/a", Track: &resolver.Track{Title: "A"}}},
+	}
+	data, err := json.Marshal(want)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if err := writeSavedQueue(path, data); err != nil {
+		t.Fatalf("writeSavedQueue failed: %v", err)
+	}
+
+	got, ok, err := loadSavedQueue(path)
+	if err != nil || !ok {
+		t.Fatalf("loadSavedQueue = ok %v, err %v; want true, nil", ok, err)
+	}
+	if got.TimePos != 12.5 || len(got.Entries) != 1 || got.Entries[0].Track.Title != "A" {
+		t.Errorf("loadSavedQueue = %+v, want %+v", got, want)
+	}
+}
+
+func TestManager_RefreshSavedEntry(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "song.flac")
+	if err := os.WriteFile(existing, []byte("x"), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	m := NewManager(&bootstrap.Config{MpvSocket: filepath.Join(dir, "mpv.sock")}, logger)
+
+	tests := []struct {
+		name  string
+		entry savedEntry
+		want  bool
+	}{
+		{"remote_url", savedEntry{Filename: "https://www.youtube.com/watch?v=abc"}, true},
+		{"existing_file", savedEntry{Filename: existing}, true},
+		{"missing_file", savedEntry{Filename: filepath.Join(dir, "gone.mp3")}, false},
+		{"empty", savedEntry{}, false},
+		{"source_without_resolver", savedEntry{Filename: "skaldi+subsonic://personal/s1", Track: &resolver.Track{WebpageURL: "skaldi+subsonic://personal/s1"}}, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, ok := m.refreshSavedEntry(context.Background(), tc.entry); ok != tc.want {
+				t.Errorf("refreshSavedEntry ok = %v, want %v", ok, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadPlayerConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"player":{"persist_queue":true}}`), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	cfg, err := loadPlayerConfig(path)
+	if err != nil {
+		t.Fatalf("loadPlayerConfig failed: %v", err)
+	}
+	if !cfg.PersistQueue {
+		t.Error("PersistQueue = false, want true")
+	}
+}
+
+func TestSavedQueue_ForDisk(t *testing.T) {
+	stream := "https://music.example/rest/stream.view?id=s1&u=alice&t=secret&s=salt"
+	opaque := "skaldi+subsonic://personal/s1"
+	q := savedQueue{
+		Entries: []savedEntry{
+			{Filename: stream, Track: &resolver.Track{ID: "s1", URL: stream, WebpageURL: opaque, Source: resolver.SourceSubsonic}},
+			{Filename: "https://www.youtube.com/watch?v=1", Track: &resolver.Track{WebpageURL: "https://www.youtube.com/watch?v=1"}},
+		},
+		Recent: []QueueItem{{Filename: stream, Metadata: &resolver.Track{URL: stream, WebpageURL: opaque}}},
+	}
+
+	data, err := json.Marshal(q.forDisk())
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Errorf("saved queue leaks the stream URL: %s", data)
+	}
+	disk := q.forDisk()
+	if disk.Entries[0].Filename != opaque || disk.Recent[0].Filename != opaque {
+		t.Errorf("saved entries = %+v, %+v, want the opaque URL", disk.Entries[0], disk.Recent[0])
+	}
+	if disk.Entries[1].Filename != "https://www.youtube.com/watch?v=1" {
+		t.Errorf("Entries[1] = %+v, want it unchanged", disk.Entries[1])
+	}
+	if q.Entries[0].Filename != stream || q.Entries[0].Track.URL != stream {
+		t.Error("forDisk should not change the queue kept for crash recovery")
+	}
+}
+
+func TestWriteSavedQueue_Private(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.json")
+	if err := writeSavedQueue(path, []byte(`{}`)); err != nil {
+		t.Fatalf("writeSavedQueue failed: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("mode = %o, want 600", perm)
+	}
+}
+
+// fakePlaylistMpv answers loadfile, playlist-move and get_property playlist
+// like mpv, and records every command.
+type fakePlaylistMpv struct {
+	mu       sync.Mutex
+	playlist []string
+	commands []string
+}
+
+func (f *fakePlaylistMpv) handle(args []interface{}) interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var words []string
+	for _, arg := range args {
+		b, _ := json.Marshal(arg)
+		words = append(words, strings.Trim(string(b), `"`))
+	}
+	f.commands = append(f.commands, strings.Join(words, " "))
+
+	switch words[0] {
+	case "loadfile":
+		f.playlist = append(f.playlist, words[1])
+	case "playlist-move":
+		from, to := int(args[1].(float64)), int(args[2].(float64))
+		entry := f.playlist[from]
+		f.playlist = slices.Insert(slices.Delete(f.playlist, from, from+1), to, entry)
+	case "get_property":
+		entries := make([]MpvPlaylistEntry, len(f.playlist))
+		for i, filename := range f.playlist {
+			entries[i] = MpvPlaylistEntry{Filename: filename, ID: i + 1}
+		}
+		return entries
+	}
+	return nil
+}
+
+func serveFakePlaylistMpv(t *testing.T, socketPath string) *fakePlaylistMpv {
+	t.Helper()
+	fake := &fakePlaylistMpv{}
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					var cmd Command
+					if err := json.Unmarshal(scanner.Bytes(), &cmd); err != nil {
+						continue
+					}
+					data, _ := json.Marshal(Response{RequestID: cmd.RequestID, Error: "success", Data: fake.handle(cmd.Command)})
+					_, _ = conn.Write(append(data, '\n'))
+				}
+			}(conn)
+		}
+	}()
+	return fake
+}
+
+func TestManager_ReplayQueueResumesFirst(t *testing.T) {
+	m := newTestManager(t)
+	fake := serveFakePlaylistMpv(t, m.cfg.MpvSocket)
+	if err := m.ipc.Connect(); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer m.ipc.Close()
+
+	saved := savedQueue{
+		Position: 2,
+		TimePos:  30,
+		Entries: []savedEntry{
+			{Filename: "https://example.com/a"},
+			{Filename: "https://example.com/b"},
+			{Filename: "https://example.com/c"},
+			{Filename: "https://example.com/d"},
+		},
+	}
+	loaded, dropped := m.replayQueue(context.Background(), saved, false)
+	if loaded != 4 || dropped != 0 {
+		t.Fatalf("replayQueue = %d loaded, %d dropped; want 4, 0", loaded, dropped)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.commands) < 2 || fake.commands[0] != "loadfile https://example.com/c append" || fake.commands[1] != "playlist-play-index 0" {
+		t.Errorf("commands = %q, want the current entry loaded and played first", fake.commands)
+	}
+	want := []string{"https://example.com/a", "https://example.com/b", "https://example.com/c", "https://example.com/d"}
+	if !slices.Equal(fake.playlist, want) {
+		t.Errorf("playlist = %q, want the saved order", fake.playlist)
+	}
+	if m.pendingSeek == nil || m.pendingSeek.filename != "https://example.com/c" || m.pendingSeek.time != 30 {
+		t.Errorf("pendingSeek = %+v, want c at 30s", m.pendingSeek)
+	}
+}
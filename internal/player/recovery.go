@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package player
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	NoticePlaybackRecovered = "playback_recovered"
+
+	crashLoopWindow = 2 * time.Minute
+)
+
+type Notice struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+type crashRecovery struct {
+	queue   savedQueue
+	volume  float64
+	muted   bool
+	paused  bool
+	repeat  RepeatMode
+	shuffle bool
+}
+
+func (m *Manager) captureRecovery() crashRecovery {
+	m.recovering.Store(true)
+
+	snap := m.State.Snapshot()
+	r := crashRecovery{
+		queue:   m.State.savedQueue(),
+		volume:  snap.Volume,
+		muted:   snap.Muted,
+		paused:  snap.Status == StatusPaused,
+		repeat:  snap.Repeat,
+		shuffle: snap.Shuffle,
+	}
+
+	if pos := r.queue.Position; pos >= 0 {
+		current := r.queue.Entries[pos].Filename
+		now := time.Now()
+		if current == m.lastCrashFile && now.Sub(m.lastCrashAt) < crashLoopWindow {
+			m.logger.Warn("Skipping track that keeps crashing mpv", "url", current)
+			r.queue.Position = pos + 1
+			r.queue.TimePos = 0
+			if r.queue.Position >= len(r.queue.Entries) {
+				r.queue.Position = -1
+			}
+		}
+		m.lastCrashFile = current
+		m.lastCrashAt = now
+	}
+
+	m.State.ResetPlayback()
+	return r
+}
+
+func (m *Manager) recoverQueue(ctx context.Context, r crashRecovery) {
+	defer m.recovering.Store(false)
+
+	if _, err := m.ipc.Exec("set_property", "volume", r.volume); err != nil {
+		m.logger.Warn("Failed to restore volume after mpv restart", "error", err)
+	}
+	if r.muted {
+		_, _ = m.ipc.Exec("set_property", "mute", true)
+	}
+	if r.paused {
+		_, _ = m.ipc.Exec("set_property", "pause", true)
+	}
+	if r.repeat != RepeatOff {
+		if err := m.SetRepeat(r.repeat); err != nil {
+			m.logger.Warn("Failed to restore repeat mode after mpv restart", "error", err)
+		}
+	}
+	if r.shuffle {
+		// The saved queue is already in shuffled order; only the flag is lost.
+		_, _ = m.ipc.Exec("set_property", "shuffle", true)
+	}
+
+	loaded, dropped := m.replayQueue(ctx, r.queue, false)
+	m.logger.Info("Recovered queue after mpv restart", "tracks", loaded, "dropped", dropped)
+
+	m.notify(Notice{
+		Kind:    NoticePlaybackRecovered,
+		Message: fmt.Sprintf("Playback recovered after a player restart (%d tracks restored)", loaded),
+	})
+}
+
+func (m *Manager) notify(n Notice) {
+	m.noticesMu.Lock()
+	defer m.noticesMu.Unlock()
+
+	if m.noticesClosed {
+		return
+	}
+	select {
+	case m.Notices <- n:
+	default:
+	}
+}
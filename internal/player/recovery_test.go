@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package player
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/reuski/skaldi/internal/bootstrap"
+)
+
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	return NewManager(&bootstrap.Config{MpvSocket: filepath.Join(t.TempDir(), "mpv.sock")}, logger)
+}
+
+func TestManager_CaptureRecovery(t *testing.T) {
+	m := newTestManager(t)
+	m.State.SetPlaylist([]MpvPlaylistEntry{
+		{Filename: "a.mp3", ID: 1},
+		{Filename: "b.mp3", ID: 2},
+	})
+	m.State.SetPlaylistPos(1)
+	m.State.SetTimePos(30)
+	m.State.SetVolume(40)
+	m.State.SetLoopPlaylist(true)
+
+	r := m.captureRecovery()
+
+	if !m.recovering.Load() {
+		t.Error("recovering should be set until the queue is replayed")
+	}
+	if r.queue.Position != 1 || r.queue.TimePos != 30 {
+		t.Errorf("queue position = %d@%v, want 1@30", r.queue.Position, r.queue.TimePos)
+	}
+	if len(r.queue.Entries) != 2 {
+		t.Errorf("len(Entries) = %d, want 2", len(r.queue.Entries))
+	}
+	if r.volume != 40 {
+		t.Errorf("volume = %v, want 40", r.volume)
+	}
+	if r.repeat != RepeatAll {
+		t.Errorf("repeat = %q, want %q", r.repeat, RepeatAll)
+	}
+
+	snap := m.State.Snapshot()
+	if len(snap.Queue) != 0 || snap.Status != StatusIdle {
+		t.Errorf("state after capture = %d items, %s; want empty and idle", len(snap.Queue), snap.Status)
+	}
+}
+
+func TestManager_CaptureRecovery_SkipsRepeatedCrash(t *testing.T) {
+	m := newTestManager(t)
+	entries := []MpvPlaylistEntry{
+		{Filename: "a.mp3", ID: 1},
+		{Filename: "b.mp3", ID: 2},
+	}
+
+	m.State.SetPlaylist(entries)
+	m.State.SetPlaylistPos(0)
+	m.State.SetTimePos(12)
+	first := m.captureRecovery()
+	if first.queue.Position != 0 {
+		t.Fatalf("first crash position = %d, want 0", first.queue.Position)
+	}
+
+	m.State.SetPlaylist(entries)
+	m.State.SetIdle(false)
+	m.State.SetPlaylistPos(0)
+	m.State.SetTimePos(12)
+	second := m.captureRecovery()
+	if second.queue.Position != 1 || second.queue.TimePos != 0 {
+		t.Errorf("second crash position = %d@%v, want 1@0", second.queue.Position, second.queue.TimePos)
+	}
+}
+
+func TestManager_NotifyAfterStop(t *testing.T) {
+	m := newTestManager(t)
+
+	m.notify(Notice{Kind: NoticePlaybackRecovered})
+	if n := <-m.Notices; n.Kind != NoticePlaybackRecovered {
+		t.Errorf("Kind = %q, want %q", n.Kind, NoticePlaybackRecovered)
+	}
+
+	m.Stop()
+	m.notify(Notice{Kind: NoticePlaybackRecovered})
+}
@@ -0,0 +1,342 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package player
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/reuski/skaldi/internal/metrics"
+	"github.com/reuski/skaldi/internal/resolver"
+)
+
+const (
+	// scrobbleThreshold caps how long a track must play to count. Shorter
+	// tracks count once half of them has played.
+	scrobbleThreshold = 4 * time.Minute
+	// scrobbleMaxStep is the largest time-pos advance counted as listening;
+	// bigger jumps are seeks.
+	scrobbleMaxStep = 2.0
+	// scrobbleEndSlack is how close to its end a track counts as played
+	// through.
+	scrobbleEndSlack = 2.0
+
+	scrobbleTimeout       = 10 * time.Second
+	scrobbleRetryInterval = time.Minute
+	maxPendingScrobbles   = 1000
+)
+
+var pendingScrobbles = metrics.NewGauge("skaldi_scrobbles_pending",
+	"Finished plays waiting to be submitted to their source.")
+
+type pendingScrobble struct {
+	Track    resolver.Track `json:"track"`
+	PlayedAt time.Time      `json:"played_at"`
+}
+
+// scrobbler reports plays of tracks from sources that keep play counts.
+// Submissions that fail are kept on disk and retried, oldest first.
+type scrobbler struct {
+	resolver *resolver.Resolver
+	logger   *slog.Logger
+	path     string
+
+	mu      sync.Mutex
+	play    *scrobblePlay
+	started bool
+	closed  bool
+
+	submissions chan pendingScrobble
+	pending     []pendingScrobble
+	dirty       bool
+	quit        chan struct{}
+	done        chan struct{}
+}
+
+type scrobblePlay struct {
+	itemID    int
+	track     resolver.Track
+	scrobble  bool
+	startedAt time.Time
+	played    float64
+	lastPos   float64
+	submitted bool
+}
+
+func newScrobbler(r *resolver.Resolver, logger *slog.Logger, path string) *scrobbler {
+	return &scrobbler{
+		resolver:    r,
+		logger:      logger,
+		path:        path,
+		submissions: make(chan pendingScrobble, 100),
+		quit:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// begin starts a play of item unless it is already the one playing. A nil
+// item ends the current play.
+func (s *scrobbler) begin(item *QueueItem, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if item == nil || item.Metadata == nil {
+		s.play = nil
+		return
+	}
+	if s.play != nil && s.play.itemID == item.ID {
+		return
+	}
+	s.startLocked(item, 0, now)
+}
+
+// progress counts playback of item up to pos, of a track duration seconds
+// long, and submits the play once enough of it has been heard. A jump back
+// to the start begins a new play, as when a track repeats.
+func (s *scrobbler) progress(item *QueueItem, pos, duration float64, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if item == nil || item.Metadata == nil {
+		return
+	}
+	play := s.play
+	if play == nil || play.itemID != item.ID || (pos < play.lastPos-scrobbleMaxStep && pos < scrobbleMaxStep) {
+		s.startLocked(item, pos, now)
+		return
+	}
+	if !play.scrobble || play.submitted {
+		play.lastPos = pos
+		return
+	}
+
+	if step := pos - play.lastPos; step > 0 && step <= scrobbleMaxStep {
+		play.played += step
+	}
+	play.lastPos = pos
+
+	if duration <= 0 {
+		duration = play.track.Duration
+	}
+	threshold := scrobbleThreshold.Seconds()
+	if duration > 0 {
+		threshold = min(threshold, duration/2)
+	}
+	playedThrough := duration > 0 && play.played > 0 && pos >= duration-scrobbleEndSlack
+	if play.played < threshold && !playedThrough {
+		return
+	}
+
+	play.submitted = true
+	select {
+	case s.submissions <- pendingScrobble{Track: play.track, PlayedAt: play.startedAt}:
+	default:
+		s.logger.Warn("Scrobble buffer full, dropping play", "title", play.track.Title)
+	}
+}
+
+func (s *scrobbler) startLocked(item *QueueItem, pos float64, now time.Time) {
+	s.play = &scrobblePlay{
+		itemID:    item.ID,
+		track:     *item.Metadata,
+		scrobble:  s.resolver.CanScrobble(*item.Metadata),
+		startedAt: now,
+		lastPos:   pos,
+	}
+	if s.play.scrobble {
+		go s.nowPlaying(s.play.track, now)
+	}
+}
+
+func (s *scrobbler) nowPlaying(track resolver.Track, startedAt time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), scrobbleTimeout)
+	defer cancel()
+
+	if err := s.resolver.Scrobble(ctx, track, startedAt, false); err != nil {
+		s.logger.Warn("Failed to report now playing", "title", track.Title, "error", err)
+	}
+}
+
+func (s *scrobbler) start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started || s.closed {
+		return
+	}
+	s.started = true
+	go s.run(ctx)
+}
+
+// run submits finished plays until ctx is done or the scrobbler is closed,
+// then saves whatever is still pending.
+func (s *scrobbler) run(ctx context.Context) {
+	defer close(s.done)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	pending, err := loadPendingScrobbles(s.path)
+	if err != nil {
+		s.logger.Warn("Ignoring saved scrobbles", "error", err)
+	}
+	s.pending = pending
+	pendingScrobbles.Set(float64(len(pending)))
+	s.flush(ctx)
+
+	ticker := time.NewTicker(scrobbleRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case p := <-s.submissions:
+					s.enqueue(p)
+				default:
+					s.save()
+					return
+				}
+			}
+		case p := <-s.submissions:
+			s.enqueue(p)
+			s.flush(ctx)
+		case <-ticker.C:
+			s.flush(ctx)
+		}
+	}
+}
+
+func (s *scrobbler) enqueue(p pendingScrobble) {
+	s.pending = append(s.pending, p)
+	s.dirty = true
+	if over := len(s.pending) - maxPendingScrobbles; over > 0 {
+		s.logger.Warn("Too many pending scrobbles, dropping the oldest", "dropped", over)
+		s.pending = s.pending[over:]
+	}
+}
+
+// flush submits pending plays in order. A failure holds back the rest of
+// that library's plays so none are lost or reordered while its server is
+// down, but plays for other libraries still go out. Plays whose source is no
+// longer configured are dropped.
+func (s *scrobbler) flush(ctx context.Context) {
+	var kept []pendingScrobble
+	blocked := make(map[string]bool)
+	for _, p := range s.pending {
+		target := s.resolver.ScrobbleTarget(p.Track)
+		if blocked[target] || ctx.Err() != nil {
+			kept = append(kept, p)
+			continue
+		}
+		submitCtx, cancel := context.WithTimeout(ctx, scrobbleTimeout)
+		err := s.resolver.Scrobble(submitCtx, p.Track, p.PlayedAt, true)
+		cancel()
+		if errors.Is(err, resolver.ErrNotScrobbled) {
+			s.logger.Warn("Dropping scrobble for a source that is gone", "title", p.Track.Title, "error", err)
+		} else if err != nil {
+			s.logger.Warn("Failed to submit scrobble, will retry", "title", p.Track.Title, "source", target, "pending", len(s.pending), "error", err)
+			blocked[target] = true
+			kept = append(kept, p)
+			continue
+		}
+		s.dirty = true
+	}
+	s.pending = kept
+	if s.dirty {
+		s.save()
+	}
+}
+
+func (s *scrobbler) save() {
+	s.dirty = false
+	pendingScrobbles.Set(float64(len(s.pending)))
+	if s.path == "" {
+		return
+	}
+	if err := writePendingScrobbles(s.path, s.pending); err != nil {
+		s.logger.Error("Failed to save pending scrobbles", "error", err)
+	}
+}
+
+// close stops run and waits for it to save what is still pending.
+func (s *scrobbler) close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	started := s.started
+	s.mu.Unlock()
+
+	close(s.quit)
+	if started {
+		<-s.done
+	}
+}
+
+func loadPendingScrobbles(path string) ([]pendingScrobble, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read pending scrobbles: %w", err)
+	}
+
+	var pending []pendingScrobble
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return nil, fmt.Errorf("invalid pending scrobbles at %s: %w", path, err)
+	}
+	return pending, nil
+}
+
+func writePendingScrobbles(path string, pending []pendingScrobble) error {
+	if len(pending) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove pending scrobbles: %w", err)
+		}
+		return nil
+	}
+
+	// Submitting needs only the track's identity; its stream URL may carry
+	// credentials.
+	saved := make([]pendingScrobble, len(pending))
+	for i, p := range pending {
+		p.Track.URL = ""
+		saved[i] = p
+	}
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return fmt.Errorf("failed to encode pending scrobbles: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create state dir: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write pending scrobbles: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to replace pending scrobbles: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,304 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package player
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/reuski/skaldi/internal/resolver"
+)
+
+type scrobbleCall struct {
+	id         string
+	submission bool
+}
+
+type fakeScrobbleSource struct {
+	name  string
+	mu    sync.Mutex
+	calls []scrobbleCall
+	fail  bool
+}
+
+func (s *fakeScrobbleSource) Name() string {
+	if s.name == "" {
+		return "fake"
+	}
+	return s.name
+}
+
+func (s *fakeScrobbleSource) Options() resolver.SourceOptions {
+	return resolver.SourceOptions{Bucket: resolver.SearchBucket(s.Name()), Scheme: "skaldi+" + s.Name()}
+}
+
+func (s *fakeScrobbleSource) Search(ctx context.Context, query string, limit int) ([]resolver.Track, error) {
+	return nil, nil
+}
+
+func (s *fakeScrobbleSource) Resolve(ctx context.Context, rawURL string) ([]resolver.Track, error) {
+	return nil, nil
+}
+
+func (s *fakeScrobbleSource) Scrobble(ctx context.Context, track resolver.Track, playedAt time.Time, submission bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail {
+		return errors.New("server down")
+	}
+	s.calls = append(s.calls, scrobbleCall{id: track.ID, submission: submission})
+	return nil
+}
+
+func (s *fakeScrobbleSource) setFail(fail bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fail = fail
+}
+
+func (s *fakeScrobbleSource) submissions() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ids []string
+	for _, call := range s.calls {
+		if call.submission {
+			ids = append(ids, call.id)
+		}
+	}
+	return ids
+}
+
+func newTestScrobbler(t *testing.T, path string) (*scrobbler, *fakeScrobbleSource) {
+	t.Helper()
+	r, err := resolver.New(nil)
+	if err != nil {
+		t.Fatalf("resolver.New failed: %v", err)
+	}
+	src := &fakeScrobbleSource{}
+	r.Register(src)
+	return newScrobbler(r, slog.New(slog.NewTextHandler(io.Discard, nil)), path), src
+}
+
+func scrobbleItem(id int, trackID string, duration float64) *QueueItem {
+	return &QueueItem{ID: id, Metadata: &resolver.Track{
+		ID:         trackID,
+		Duration:   duration,
+		WebpageURL: "skaldi+fake://" + trackID,
+		Source:     "fake",
+	}}
+}
+
+// play feeds time-pos updates from start to end, one second apart.
+func play(s *scrobbler, item *QueueItem, start, end, duration float64) {
+	for pos := start; pos <= end; pos++ {
+		s.progress(item, pos, duration, time.Now())
+	}
+}
+
+func TestScrobblerThreshold(t *testing.T) {
+	tests := []struct {
+		name   string
+		run    func(s *scrobbler, item *QueueItem)
+		length float64
+		want   bool
+	}{
+		{
+			name:   "half of a short track",
+			length: 200,
+			run:    func(s *scrobbler, item *QueueItem) { play(s, item, 0, 100, 200) },
+			want:   true,
+		},
+		{
+			name:   "less than half",
+			length: 200,
+			run:    func(s *scrobbler, item *QueueItem) { play(s, item, 0, 90, 200) },
+			want:   false,
+		},
+		{
+			name:   "four minutes of a long track",
+			length: 1200,
+			run:    func(s *scrobbler, item *QueueItem) { play(s, item, 0, 240, 1200) },
+			want:   true,
+		},
+		{
+			name:   "seeking does not count",
+			length: 200,
+			run: func(s *scrobbler, item *QueueItem) {
+				play(s, item, 0, 10, 200)
+				play(s, item, 150, 170, 200)
+			},
+			want: false,
+		},
+		{
+			name:   "played to the end",
+			length: 200,
+			run: func(s *scrobbler, item *QueueItem) {
+				play(s, item, 0, 10, 200)
+				play(s, item, 180, 199, 200)
+			},
+			want: true,
+		},
+		{
+			name:   "length from metadata",
+			length: 60,
+			run:    func(s *scrobbler, item *QueueItem) { play(s, item, 0, 30, 0) },
+			want:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestScrobbler(t, "")
+			item := scrobbleItem(1, "t1", tt.length)
+			s.begin(item, time.Now())
+			tt.run(s, item)
+
+			got := len(s.submissions) == 1
+			if got != tt.want {
+				t.Errorf("submitted = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScrobblerPlays(t *testing.T) {
+	s, src := newTestScrobbler(t, "")
+	first := scrobbleItem(1, "t1", 100)
+
+	s.begin(first, time.Now())
+	s.begin(first, time.Now())
+	play(s, first, 0, 100, 100)
+	if len(s.submissions) != 1 {
+		t.Fatalf("submissions = %d, want 1 per play", len(s.submissions))
+	}
+
+	// A repeat starts over from the beginning.
+	play(s, first, 0, 60, 100)
+	if len(s.submissions) != 2 {
+		t.Fatalf("submissions = %d, want the repeat counted", len(s.submissions))
+	}
+
+	s.begin(scrobbleItem(2, "t2", 100), time.Now())
+	s.begin(nil, time.Now())
+	if s.play != nil {
+		t.Error("play should end when nothing is playing")
+	}
+
+	other := &QueueItem{ID: 3, Metadata: &resolver.Track{ID: "yt", Source: resolver.SourceYouTube, WebpageURL: "https://www.youtube.com/watch?v=yt"}}
+	s.begin(other, time.Now())
+	play(s, other, 0, 100, 100)
+	if len(s.submissions) != 2 {
+		t.Errorf("submissions = %d, want none for a source without play counts", len(s.submissions))
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		src.mu.Lock()
+		calls := len(src.calls)
+		src.mu.Unlock()
+		if calls == 3 || time.Now().After(deadline) {
+			if calls != 3 {
+				t.Errorf("now playing calls = %d, want 3", calls)
+			}
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestScrobblerRetriesFromDisk(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scrobbles.json")
+	s, src := newTestScrobbler(t, path)
+	src.setFail(true)
+
+	s.enqueue(pendingScrobble{Track: *scrobbleItem(1, "t1", 100).Metadata, PlayedAt: time.Now()})
+	s.enqueue(pendingScrobble{Track: *scrobbleItem(2, "t2", 100).Metadata, PlayedAt: time.Now()})
+	s.enqueue(pendingScrobble{Track: resolver.Track{ID: "gone", Source: resolver.SourceSubsonic, WebpageURL: "skaldi+subsonic://gone/1"}, PlayedAt: time.Now()})
+	s.flush(context.Background())
+
+	saved, err := loadPendingScrobbles(path)
+	if err != nil {
+		t.Fatalf("loadPendingScrobbles failed: %v", err)
+	}
+	if len(saved) != 2 {
+		t.Fatalf("saved = %d, want both plays kept while the server is down", len(saved))
+	}
+
+	// A restart picks the saved plays up again.
+	restarted, src := newTestScrobbler(t, path)
+	restarted.start(context.Background())
+	restarted.close()
+
+	if got := src.submissions(); len(got) != 2 || got[0] != "t1" || got[1] != "t2" {
+		t.Errorf("submitted = %v, want t1 and t2 in order", got)
+	}
+	saved, err = loadPendingScrobbles(path)
+	if err != nil {
+		t.Fatalf("loadPendingScrobbles failed: %v", err)
+	}
+	if len(saved) != 0 {
+		t.Errorf("saved = %+v, want none left", saved)
+	}
+}
+
+func TestScrobblerFlushPerLibrary(t *testing.T) {
+	s, down := newTestScrobbler(t, "")
+	up := &fakeScrobbleSource{name: "other"}
+	s.resolver.Register(up)
+	down.setFail(true)
+
+	otherItem := func(trackID string) resolver.Track {
+		return resolver.Track{ID: trackID, WebpageURL: "skaldi+other://" + trackID, Source: "other"}
+	}
+	s.enqueue(pendingScrobble{Track: *scrobbleItem(1, "t1", 100).Metadata, PlayedAt: time.Now()})
+	s.enqueue(pendingScrobble{Track: otherItem("o1"), PlayedAt: time.Now()})
+	s.enqueue(pendingScrobble{Track: *scrobbleItem(2, "t2", 100).Metadata, PlayedAt: time.Now()})
+	s.enqueue(pendingScrobble{Track: otherItem("o2"), PlayedAt: time.Now()})
+	s.flush(context.Background())
+
+	if got := up.submissions(); len(got) != 2 || got[0] != "o1" || got[1] != "o2" {
+		t.Errorf("other library submitted = %v, want o1 and o2 despite the failing one", got)
+	}
+	if len(s.pending) != 2 || s.pending[0].Track.ID != "t1" || s.pending[1].Track.ID != "t2" {
+		t.Fatalf("pending = %+v, want t1 and t2 kept in order", s.pending)
+	}
+
+	down.setFail(false)
+	s.flush(context.Background())
+	if got := down.submissions(); len(got) != 2 || got[0] != "t1" || got[1] != "t2" {
+		t.Errorf("submitted = %v, want t1 and t2 in order once the server is back", got)
+	}
+	if len(s.pending) != 0 {
+		t.Errorf("pending = %d, want none left", len(s.pending))
+	}
+}
+
+func TestWritePendingScrobbles_Private(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scrobbles.json")
+	track := resolver.Track{ID: "s1", URL: "https://music.example/rest/stream.view?id=s1&t=secret", WebpageURL: "skaldi+subsonic://personal/s1"}
+	if err := writePendingScrobbles(path, []pendingScrobble{{Track: track, PlayedAt: time.Now()}}); err != nil {
+		t.Fatalf("writePendingScrobbles failed: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("mode = %o, want 600", perm)
+	}
+	saved, err := loadPendingScrobbles(path)
+	if err != nil {
+		t.Fatalf("loadPendingScrobbles failed: %v", err)
+	}
+	if len(saved) != 1 || saved[0].Track.URL != "" || saved[0].Track.WebpageURL != track.WebpageURL {
+		t.Errorf("saved = %+v, want the track without its stream URL", saved)
+	}
+}
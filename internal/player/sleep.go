@@ -0,0 +1,222 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package player
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+const (
+	sleepTick = 250 * time.Millisecond
+	// sleepFade is how long the volume takes to fall to silence before the
+	// timer pauses playback.
+	sleepFade = 20 * time.Second
+)
+
+var ErrNothingPlaying = errors.New("nothing is playing")
+
+// SleepTimer is the part of a running sleep timer clients see.
+type SleepTimer struct {
+	// Remaining is the whole seconds left before playback pauses, or zero
+	// while that is not yet known, such as when an upcoming track has no
+	// duration.
+	Remaining float64 `json:"remaining,omitempty"`
+	// Tracks counts the tracks still to finish, including the current one,
+	// for a timer that stops after a number of tracks.
+	Tracks int `json:"tracks,omitempty"`
+}
+
+type sleepTimer struct {
+	deadline  time.Time
+	tracks    int
+	currentID int
+
+	fading   bool
+	fadeFrom float64
+	fadeLen  time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// SleepAfter pauses playback once d has passed, fading out over the last
+// seconds. It replaces any running timer.
+func (m *Manager) SleepAfter(d time.Duration) error {
+	return m.startSleep(&sleepTimer{deadline: time.Now().Add(d)})
+}
+
+// SleepAfterTracks pauses playback when n tracks, counting the current one,
+// have finished.
+func (m *Manager) SleepAfterTracks(n int) error {
+	return m.startSleep(&sleepTimer{tracks: n})
+}
+
+func (m *Manager) startSleep(t *sleepTimer) error {
+	snap := m.State.Snapshot()
+	if snap.NowPlaying == nil {
+		return ErrNothingPlaying
+	}
+	m.CancelSleep()
+
+	t.currentID = snap.NowPlaying.ID
+	t.stop = make(chan struct{})
+	t.done = make(chan struct{})
+
+	m.sleepMu.Lock()
+	m.sleep = t
+	m.sleepMu.Unlock()
+
+	go m.runSleepTimer(t)
+	return nil
+}
+
+// CancelSleep stops the running timer and puts back the volume it was fading
+// from. It reports whether a timer was running.
+func (m *Manager) CancelSleep() bool {
+	m.sleepMu.Lock()
+	t := m.sleep
+	m.sleep = nil
+	m.sleepMu.Unlock()
+
+	if t == nil {
+		return false
+	}
+	close(t.stop)
+	<-t.done
+	m.State.SetSleep(nil)
+	return true
+}
+
+func (m *Manager) runSleepTimer(t *sleepTimer) {
+	defer close(t.done)
+
+	ticker := time.NewTicker(sleepTick)
+	defer ticker.Stop()
+
+	for {
+		view, finished := m.sleepStep(t, time.Now())
+		if finished {
+			m.sleepMu.Lock()
+			current := m.sleep == t
+			if current {
+				m.sleep = nil
+			}
+			m.sleepMu.Unlock()
+			if current {
+				m.State.SetSleep(nil)
+				m.broadcastState()
+			}
+			return
+		}
+		m.State.SetSleep(view)
+		m.broadcastState()
+
+		select {
+		case <-t.stop:
+			m.restoreSleepVolume(t)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sleepStep advances the timer by one tick, fading or pausing as needed, and
+// reports whether the timer is done.
+func (m *Manager) sleepStep(t *sleepTimer, now time.Time) (*SleepTimer, bool) {
+	snap := m.State.Snapshot()
+	if snap.NowPlaying == nil {
+		// The queue ran out or was cleared, so there is nothing left to stop.
+		m.restoreSleepVolume(t)
+		return nil, true
+	}
+
+	if t.deadline.IsZero() && snap.NowPlaying.ID != t.currentID {
+		t.currentID = snap.NowPlaying.ID
+		t.tracks--
+		if t.tracks <= 0 {
+			m.sleepNow(t)
+			return nil, true
+		}
+	}
+
+	remaining, known := sleepRemaining(t, snap, now)
+	if known && remaining < sleepTick {
+		m.sleepNow(t)
+		return nil, true
+	}
+
+	switch {
+	case known && remaining <= sleepFade:
+		if !t.fading {
+			t.fading = true
+			t.fadeFrom = snap.Volume
+			t.fadeLen = remaining
+		}
+		volume := fadeVolume(t.fadeFrom, remaining, t.fadeLen)
+		if _, err := m.ipc.Exec("set_property", "volume", volume); err != nil {
+			m.logger.Debug("Failed to fade volume", "error", err)
+		}
+	case t.fading:
+		// A seek or skip moved the end further away than the fade.
+		m.restoreSleepVolume(t)
+	}
+
+	view := &SleepTimer{}
+	if known {
+		view.Remaining = math.Ceil(remaining.Seconds())
+	}
+	if t.deadline.IsZero() {
+		view.Tracks = t.tracks
+	}
+	return view, false
+}
+
+func (m *Manager) sleepNow(t *sleepTimer) {
+	if _, err := m.ipc.Exec("set_property", "pause", true); err != nil {
+		m.logger.Warn("Sleep timer failed to pause playback", "error", err)
+	}
+	m.restoreSleepVolume(t)
+	m.logger.Info("Sleep timer paused playback")
+}
+
+func (m *Manager) restoreSleepVolume(t *sleepTimer) {
+	if !t.fading {
+		return
+	}
+	t.fading = false
+	if _, err := m.ipc.Exec("set_property", "volume", t.fadeFrom); err != nil {
+		m.logger.Warn("Failed to restore volume after sleep fade", "error", err)
+	}
+}
+
+// sleepRemaining returns how long until the timer should pause playback. A
+// track-based timer only knows that once every track it waits on has a
+// duration.
+func sleepRemaining(t *sleepTimer, snap Snapshot, now time.Time) (time.Duration, bool) {
+	if !t.deadline.IsZero() {
+		return t.deadline.Sub(now), true
+	}
+	if snap.Duration <= 0 || t.tracks-1 > len(snap.Upcoming) {
+		return 0, false
+	}
+
+	seconds := snap.Duration - snap.CurrentTime
+	for _, item := range snap.Upcoming[:t.tracks-1] {
+		if item.Duration <= 0 {
+			return 0, false
+		}
+		seconds += item.Duration
+	}
+	return time.Duration(seconds * float64(time.Second)), true
+}
+
+// fadeVolume scales from linearly down to zero as remaining runs out over
+// the fade length.
+func fadeVolume(from float64, remaining, length time.Duration) float64 {
+	if length <= 0 || remaining <= 0 {
+		return 0
+	}
+	return from * min(float64(remaining)/float64(length), 1)
+}
@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package player
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSleepRemaining(t *testing.T) {
+	now := time.Now()
+	playing := Snapshot{
+		CurrentTime: 60,
+		Duration:    200,
+		Upcoming:    []QueueItem{{Duration: 180}, {Duration: 0}},
+	}
+
+	tests := []struct {
+		name      string
+		timer     sleepTimer
+		snap      Snapshot
+		want      time.Duration
+		wantKnown bool
+	}{
+		{name: "deadline", timer: sleepTimer{deadline: now.Add(time.Minute)}, snap: playing, want: time.Minute, wantKnown: true},
+		{name: "current_track", timer: sleepTimer{tracks: 1}, snap: playing, want: 140 * time.Second, wantKnown: true},
+		{name: "two_tracks", timer: sleepTimer{tracks: 2}, snap: playing, want: 320 * time.Second, wantKnown: true},
+		{name: "unknown_duration", timer: sleepTimer{tracks: 3}, snap: playing},
+		{name: "past_queue_end", timer: sleepTimer{tracks: 4}, snap: playing},
+		{name: "live_stream", timer: sleepTimer{tracks: 1}, snap: Snapshot{CurrentTime: 60}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, known := sleepRemaining(&tt.timer, tt.snap, now)
+			if known != tt.wantKnown || got != tt.want {
+				t.Errorf("sleepRemaining() = %v, %v, want %v, %v", got, known, tt.want, tt.wantKnown)
+			}
+		})
+	}
+}
+
+func TestFadeVolume(t *testing.T) {
+	tests := []struct {
+		remaining time.Duration
+		want      float64
+	}{
+		{remaining: 20 * time.Second, want: 80},
+		{remaining: 10 * time.Second, want: 40},
+		{remaining: 0, want: 0},
+		{remaining: 30 * time.Second, want: 80},
+	}
+
+	for _, tt := range tests {
+		if got := fadeVolume(80, tt.remaining, 20*time.Second); got != tt.want {
+			t.Errorf("fadeVolume(80, %v) = %v, want %v", tt.remaining, got, tt.want)
+		}
+	}
+}
+
+func TestManager_SleepAfter_NothingPlaying(t *testing.T) {
+	m := newTestManager(t)
+
+	if err := m.SleepAfter(time.Minute); !errors.Is(err, ErrNothingPlaying) {
+		t.Errorf("SleepAfter() error = %v, want %v", err, ErrNothingPlaying)
+	}
+	if m.CancelSleep() {
+		t.Error("CancelSleep reported a running timer")
+	}
+}
@@ -18,8 +18,27 @@ const (
 	StatusPaused  PlaybackStatus = "paused"
 
 	maxRecentPlayed = 3
+	// maxPlayedAge is how long a track is remembered as played for
+	// duplicate checks.
+	maxPlayedAge = 24 * time.Hour
 )
 
+type RepeatMode string
+
+const (
+	RepeatOff RepeatMode = "off"
+	RepeatOne RepeatMode = "one"
+	RepeatAll RepeatMode = "all"
+)
+
+func ParseRepeatMode(s string) (RepeatMode, bool) {
+	switch mode := RepeatMode(s); mode {
+	case RepeatOff, RepeatOne, RepeatAll:
+		return mode, true
+	}
+	return "", false
+}
+
 type QueueItem struct {
 	ID       int             `json:"id,omitempty"`
 	Index    int             `json:"index"`
@@ -27,6 +46,22 @@ type QueueItem struct {
 	Title    string          `json:"title,omitempty"`
 	Duration float64         `json:"duration,omitempty"`
 	Metadata *resolver.Track `json:"metadata,omitempty"`
+	// Votes counts the repeat requests merged into this item.
+	Votes int `json:"votes,omitempty"`
+	// Pinned items were placed by a host and are left alone by fair
+	// ordering.
+	Pinned bool `json:"pinned,omitempty"`
+}
+
+// DedupKey identifies the track an item plays, falling back to its filename
+// for items without metadata.
+func (item QueueItem) DedupKey() string {
+	if item.Metadata != nil {
+		if key := item.Metadata.DedupKey(); key != "" {
+			return key
+		}
+	}
+	return item.Filename
 }
 
 type Snapshot struct {
@@ -36,6 +71,13 @@ type Snapshot struct {
 	Duration    float64        `json:"duration"`
 	Volume      float64        `json:"volume"`
 	Muted       bool           `json:"muted"`
+	Repeat      RepeatMode     `json:"repeat"`
+	Shuffle     bool           `json:"shuffle"`
+	QueueOrder  QueueOrder     `json:"queue_order"`
+	AudioPreset AudioPreset    `json:"audio_preset"`
+	Equalizer   []float64      `json:"equalizer,omitempty"`
+	AudioDevice string         `json:"audio_device,omitempty"`
+	Sleep       *SleepTimer    `json:"sleep,omitempty"`
 	Queue       []QueueItem    `json:"queue"`
 	History     []QueueItem    `json:"history"`
 	Upcoming    []QueueItem    `json:"upcoming"`
@@ -49,6 +91,10 @@ type Delta struct {
 	Duration    *float64        `json:"duration,omitempty"`
 	Volume      *float64        `json:"volume,omitempty"`
 	Muted       *bool           `json:"muted,omitempty"`
+	Repeat      *RepeatMode     `json:"repeat,omitempty"`
+	Shuffle     *bool           `json:"shuffle,omitempty"`
+	QueueOrder  *QueueOrder     `json:"queue_order,omitempty"`
+	Sleep       *SleepTimer     `json:"sleep,omitempty"`
 	Status      *PlaybackStatus `json:"status,omitempty"`
 }
 
@@ -62,6 +108,14 @@ type State struct {
 	duration    float64
 	volume      float64
 	muted       bool
+	loopFile    bool
+	loopList    bool
+	shuffle     bool
+	queueOrder  QueueOrder
+	audioPreset AudioPreset
+	equalizer   []float64
+	audioDevice string
+	sleep       *SleepTimer
 	playlist    []MpvPlaylistEntry
 	playlistPos int
 
@@ -69,6 +123,10 @@ type State struct {
 	recentPlayed []QueueItem
 	metadata     map[string]resolver.Track
 	metaAddedAt  map[string]time.Time
+	metaPinned   map[string]struct{}
+	votes        map[int]int
+	pinned       map[int]struct{}
+	playedAt     map[string]time.Time
 }
 
 type MpvPlaylistEntry struct {
@@ -82,6 +140,10 @@ func NewState() *State {
 	return &State{
 		metadata:    make(map[string]resolver.Track),
 		metaAddedAt: make(map[string]time.Time),
+		metaPinned:  make(map[string]struct{}),
+		votes:       make(map[int]int),
+		pinned:      make(map[int]struct{}),
+		playedAt:    make(map[string]time.Time),
 		playlist:    []MpvPlaylistEntry{},
 		volume:      100,
 		playlistPos: -1,
@@ -100,6 +162,30 @@ func (s *State) StoreMetadata(url string, track resolver.Track) {
 	s.version++
 }
 
+func (s *State) StorePinnedMetadata(url string, track resolver.Track) {
+	s.mu.Lock()
+	s.metaPinned[url] = struct{}{}
+	s.mu.Unlock()
+	s.StoreMetadata(url, track)
+}
+
+func (s *State) UnpinMetadata(url string) {
+	s.mu.Lock()
+	delete(s.metaPinned, url)
+	s.mu.Unlock()
+}
+
+func (s *State) SetRecentPlayed(items []QueueItem) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.recentPlayed = nil
+	for _, item := range items {
+		s.recentPlayed = appendRecent(s.recentPlayed, item)
+	}
+	s.version++
+}
+
 func (s *State) Snapshot() Snapshot {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -148,6 +234,13 @@ func (s *State) Snapshot() Snapshot {
 		Duration:    s.duration,
 		Volume:      s.volume,
 		Muted:       s.muted,
+		Repeat:      s.repeatLocked(),
+		Shuffle:     s.shuffle,
+		QueueOrder:  s.queueOrder,
+		AudioPreset: s.audioPreset,
+		Equalizer:   slices.Clone(s.equalizer),
+		AudioDevice: s.audioDevice,
+		Sleep:       copySleep(s.sleep),
 		Queue:       queue,
 		History:     history,
 		Upcoming:    upcoming,
@@ -213,9 +306,107 @@ func (s *State) SetMuted(muted bool) {
 	s.mu.Unlock()
 }
 
+func (s *State) SetLoopFile(loop bool) {
+	s.mu.Lock()
+	if s.loopFile != loop {
+		s.loopFile = loop
+		s.version++
+	}
+	s.mu.Unlock()
+}
+
+func (s *State) SetLoopPlaylist(loop bool) {
+	s.mu.Lock()
+	if s.loopList != loop {
+		s.loopList = loop
+		s.version++
+	}
+	s.mu.Unlock()
+}
+
+func (s *State) SetShuffle(shuffle bool) {
+	s.mu.Lock()
+	if s.shuffle != shuffle {
+		s.shuffle = shuffle
+		s.version++
+	}
+	s.mu.Unlock()
+}
+
+func (s *State) SetQueueOrder(order QueueOrder) {
+	s.mu.Lock()
+	if s.queueOrder != order {
+		s.queueOrder = order
+		s.version++
+	}
+	s.mu.Unlock()
+}
+
+func (s *State) SetAudio(preset AudioPreset, equalizer []float64) {
+	s.mu.Lock()
+	if s.audioPreset != preset || !slices.Equal(s.equalizer, equalizer) {
+		s.audioPreset = preset
+		s.equalizer = slices.Clone(equalizer)
+		s.version++
+	}
+	s.mu.Unlock()
+}
+
+func (s *State) SetAudioDevice(name string) {
+	s.mu.Lock()
+	if s.audioDevice != name {
+		s.audioDevice = name
+		s.version++
+	}
+	s.mu.Unlock()
+}
+
+func (s *State) SetSleep(timer *SleepTimer) {
+	s.mu.Lock()
+	if !sameSleepPtr(s.sleep, timer) {
+		s.sleep = copySleep(timer)
+		s.version++
+	}
+	s.mu.Unlock()
+}
+
+// repeatLocked folds mpv's two loop properties into one mode. Looping the
+// file wins because mpv checks it before advancing the playlist.
+func (s *State) repeatLocked() RepeatMode {
+	switch {
+	case s.loopFile:
+		return RepeatOne
+	case s.loopList:
+		return RepeatAll
+	default:
+		return RepeatOff
+	}
+}
+
 func (s *State) SetPlaylist(entries []MpvPlaylistEntry) {
 	s.mu.Lock()
 	s.playlist = entries
+	inPlaylist := make(map[int]struct{}, len(entries))
+	for _, entry := range entries {
+		delete(s.metaPinned, entry.Filename)
+		inPlaylist[entry.ID] = struct{}{}
+	}
+	for id := range s.votes {
+		if _, ok := inPlaylist[id]; !ok {
+			delete(s.votes, id)
+		}
+	}
+	for id := range s.pinned {
+		if _, ok := inPlaylist[id]; !ok {
+			delete(s.pinned, id)
+		}
+	}
+	// Follow the playing entry if it was moved.
+	if s.currentItem != nil && s.currentItem.ID != 0 {
+		if idx := slices.IndexFunc(entries, func(e MpvPlaylistEntry) bool { return e.ID == s.currentItem.ID }); idx >= 0 {
+			s.playlistPos = idx
+		}
+	}
 	s.currentItem = s.playlistItemLocked(s.playlistPos)
 	s.version++
 	s.mu.Unlock()
@@ -232,16 +423,144 @@ func (s *State) SetPlaylistPos(pos int) *QueueItem {
 		return s.copyCurrentItemLocked()
 	}
 
+	item := s.playlistItemLocked(pos)
+	// The playing entry was moved, not replaced.
+	if item != nil && s.currentItem != nil && item.ID != 0 && item.ID == s.currentItem.ID {
+		s.playlistPos = pos
+		s.currentItem = item
+		s.version++
+		return s.copyCurrentItemLocked()
+	}
+
 	if s.currentItem != nil {
 		s.recentPlayed = appendRecent(s.recentPlayed, *s.currentItem)
 	}
 
 	s.playlistPos = pos
-	s.currentItem = s.playlistItemLocked(pos)
+	s.currentItem = item
+	if s.currentItem != nil {
+		s.markPlayedLocked(s.currentItem.DedupKey(), time.Now())
+	}
 	s.version++
 	return s.copyCurrentItemLocked()
 }
 
+func (s *State) markPlayedLocked(key string, now time.Time) {
+	for k, at := range s.playedAt {
+		if now.Sub(at) > maxPlayedAge {
+			delete(s.playedAt, k)
+		}
+	}
+	s.playedAt[key] = now
+}
+
+// PlayedWithin reports whether the track with the given dedup key started
+// playing less than window ago.
+func (s *State) PlayedWithin(key string, window time.Duration) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	at, ok := s.playedAt[key]
+	return ok && time.Since(at) < window
+}
+
+// AddVote records another request for the playlist entry with the given
+// mpv ID.
+func (s *State) AddVote(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.votes[id]++
+	if s.playlistPos >= 0 {
+		s.currentItem = s.playlistItemLocked(s.playlistPos)
+	}
+	s.version++
+}
+
+// Pin marks the playlist entry with the given mpv ID as placed by a host.
+func (s *State) Pin(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.pinned[id]; ok {
+		return
+	}
+	s.pinned[id] = struct{}{}
+	if s.playlistPos >= 0 {
+		s.currentItem = s.playlistItemLocked(s.playlistPos)
+	}
+	s.version++
+}
+
+// EntryID returns the mpv ID of the playlist entry at index, or 0.
+func (s *State) EntryID(index int) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if index < 0 || index >= len(s.playlist) {
+		return 0
+	}
+	return s.playlist[index].ID
+}
+
+func (s *State) fairSlots(entries []MpvPlaylistEntry) []fairSlot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	slots := make([]fairSlot, len(entries))
+	for i, entry := range entries {
+		track := s.metadata[entry.Filename]
+		_, pinned := s.pinned[entry.ID]
+		slots[i] = fairSlot{
+			id:        entry.ID,
+			requester: track.RequesterID,
+			fixed:     pinned || track.Autoplay,
+		}
+	}
+	return slots
+}
+
+func (s *State) ResetPlayback() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.idleActive = true
+	s.paused = false
+	s.timePos = 0
+	s.duration = 0
+	s.playlist = []MpvPlaylistEntry{}
+	s.playlistPos = -1
+	s.currentItem = nil
+	s.version++
+}
+
+// IsAutoplay reports whether the track queued under url was picked by
+// autoplay rather than requested.
+func (s *State) IsAutoplay(url string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.metadata[url].Autoplay
+}
+
+// playlistRanOut reports whether going idle now means playback reached the
+// end of the playlist, as opposed to mpv starting up or being cleared.
+func (s *State) playlistRanOut() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return !s.idleActive && len(s.playlist) > 0
+}
+
+func (s *State) PlaylistPos() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.playlistPos
+}
+
+// currentTrack returns the playing item and the length mpv reports for it.
+func (s *State) currentTrack() (*QueueItem, float64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.copyCurrentItemLocked(), s.duration
+}
+
 func (s *State) copyCurrentItemLocked() *QueueItem {
 	if s.currentItem == nil {
 		return nil
@@ -264,6 +583,9 @@ func (s *State) PruneMetadataBefore(cutoff time.Time) {
 	}
 
 	for key := range s.metadata {
+		if _, ok := s.metaPinned[key]; ok {
+			continue
+		}
 		if _, ok := inPlaylist[key]; !ok {
 			if cutoff.IsZero() || s.metaAddedAt[key].Before(cutoff) {
 				delete(s.metadata, key)
@@ -283,7 +605,9 @@ func (s *State) playlistItemLocked(index int) *QueueItem {
 		ID:       entry.ID,
 		Index:    index,
 		Filename: entry.Filename,
+		Votes:    s.votes[entry.ID],
 	}
+	_, item.Pinned = s.pinned[entry.ID]
 
 	if track, ok := s.metadata[entry.Filename]; ok {
 		item.Title = track.Title
@@ -349,6 +673,8 @@ func sameQueueItem(a, b QueueItem) bool {
 		a.Filename == b.Filename &&
 		a.Title == b.Title &&
 		a.Duration == b.Duration &&
+		a.Votes == b.Votes &&
+		a.Pinned == b.Pinned &&
 		sameTrackPtr(a.Metadata, b.Metadata)
 }
 
@@ -363,6 +689,25 @@ func sameTrackPtr(a, b *resolver.Track) bool {
 	}
 }
 
+func copySleep(timer *SleepTimer) *SleepTimer {
+	if timer == nil {
+		return nil
+	}
+	cp := *timer
+	return &cp
+}
+
+func sameSleepPtr(a, b *SleepTimer) bool {
+	switch {
+	case a == nil && b == nil:
+		return true
+	case a == nil || b == nil:
+		return false
+	default:
+		return *a == *b
+	}
+}
+
 func sameQueueItemPtr(a, b *QueueItem) bool {
 	switch {
 	case a == nil && b == nil:
@@ -384,6 +729,13 @@ func SnapshotsEqual(a, b Snapshot) bool {
 		a.Duration == b.Duration &&
 		a.Volume == b.Volume &&
 		a.Muted == b.Muted &&
+		a.Repeat == b.Repeat &&
+		a.Shuffle == b.Shuffle &&
+		a.QueueOrder == b.QueueOrder &&
+		a.AudioPreset == b.AudioPreset &&
+		slices.Equal(a.Equalizer, b.Equalizer) &&
+		a.AudioDevice == b.AudioDevice &&
+		sameSleepPtr(a.Sleep, b.Sleep) &&
 		a.CurrentIdx == b.CurrentIdx &&
 		!queueChanged(a.Queue, b.Queue) &&
 		!queueChanged(a.History, b.History) &&
@@ -397,7 +749,14 @@ func ComputeDelta(prev, curr Snapshot) *Delta {
 	}
 
 	idleTransition := prev.Status != curr.Status && (prev.Status == StatusIdle || curr.Status == StatusIdle)
-	if idleTransition ||
+	// Audio settings change rarely enough to go out as a full snapshot.
+	audioChanged := prev.AudioPreset != curr.AudioPreset ||
+		!slices.Equal(prev.Equalizer, curr.Equalizer) ||
+		prev.AudioDevice != curr.AudioDevice
+	// A delta cannot clear a field, so starting or ending a sleep timer sends
+	// a full snapshot.
+	sleepToggled := (prev.Sleep == nil) != (curr.Sleep == nil)
+	if idleTransition || audioChanged || sleepToggled ||
 		prev.CurrentIdx != curr.CurrentIdx ||
 		queueChanged(prev.Queue, curr.Queue) ||
 		queueChanged(prev.History, curr.History) ||
@@ -425,6 +784,22 @@ func ComputeDelta(prev, curr Snapshot) *Delta {
 		delta.Muted = &curr.Muted
 		changed = true
 	}
+	if curr.Repeat != prev.Repeat {
+		delta.Repeat = &curr.Repeat
+		changed = true
+	}
+	if curr.Shuffle != prev.Shuffle {
+		delta.Shuffle = &curr.Shuffle
+		changed = true
+	}
+	if curr.QueueOrder != prev.QueueOrder {
+		delta.QueueOrder = &curr.QueueOrder
+		changed = true
+	}
+	if !sameSleepPtr(curr.Sleep, prev.Sleep) {
+		delta.Sleep = curr.Sleep
+		changed = true
+	}
 	if curr.Status != prev.Status {
 		delta.Status = &curr.Status
 		changed = true
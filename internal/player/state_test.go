@@ -540,3 +540,148 @@ func TestState_Snapshot_ReindexesRecentHistory(t *testing.T) {
 		t.Fatalf("History[0].Index = %d, want 2", snap.History[0].Index)
 	}
 }
+
+func TestState_Snapshot_RepeatMode(t *testing.T) {
+	tests := []struct {
+		name         string
+		loopFile     bool
+		loopPlaylist bool
+		want         RepeatMode
+	}{
+		{name: "off", want: RepeatOff},
+		{name: "one", loopFile: true, want: RepeatOne},
+		{name: "all", loopPlaylist: true, want: RepeatAll},
+		{name: "file loop wins", loopFile: true, loopPlaylist: true, want: RepeatOne},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewState()
+			s.SetLoopFile(tt.loopFile)
+			s.SetLoopPlaylist(tt.loopPlaylist)
+
+			if got := s.Snapshot().Repeat; got != tt.want {
+				t.Errorf("Repeat = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputeDelta_RepeatAndShuffle(t *testing.T) {
+	s := NewState()
+	s.SetIdle(false)
+	s.SetPlaylist([]MpvPlaylistEntry{{Filename: "track1.mp3", ID: 1}})
+	s.SetPlaylistPos(0)
+	prev := s.Snapshot()
+
+	s.SetLoopFile(true)
+	s.SetShuffle(true)
+	s.SetQueueOrder(OrderFair)
+	curr := s.Snapshot()
+
+	delta := ComputeDelta(prev, curr)
+	if delta == nil {
+		t.Fatal("ComputeDelta should return a delta for mode changes")
+	}
+	if delta.Repeat == nil || *delta.Repeat != RepeatOne {
+		t.Errorf("delta.Repeat = %v, want %q", delta.Repeat, RepeatOne)
+	}
+	if delta.Shuffle == nil || !*delta.Shuffle {
+		t.Errorf("delta.Shuffle = %v, want true", delta.Shuffle)
+	}
+	if delta.QueueOrder == nil || *delta.QueueOrder != OrderFair {
+		t.Errorf("delta.QueueOrder = %v, want %q", delta.QueueOrder, OrderFair)
+	}
+	if SnapshotsEqual(prev, curr) {
+		t.Error("SnapshotsEqual should report the mode change")
+	}
+}
+
+func TestComputeDelta_AudioChangeReturnsFullSnapshot(t *testing.T) {
+	s := NewState()
+	s.SetIdle(false)
+	s.SetPlaylist([]MpvPlaylistEntry{{Filename: "track1.mp3", ID: 1}})
+	s.SetPlaylistPos(0)
+	s.SetAudio(DefaultAudioPreset, nil)
+	prev := s.Snapshot()
+
+	s.SetAudio(AudioPresetNight, []float64{1, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	curr := s.Snapshot()
+
+	if curr.Version == prev.Version {
+		t.Error("Version should have incremented")
+	}
+	if delta := ComputeDelta(prev, curr); delta != nil {
+		t.Error("ComputeDelta should return nil when audio settings change")
+	}
+	if curr.AudioPreset != AudioPresetNight || len(curr.Equalizer) != len(EqualizerBands) {
+		t.Errorf("snapshot audio = %q %v", curr.AudioPreset, curr.Equalizer)
+	}
+}
+
+func TestComputeDelta_SleepTimer(t *testing.T) {
+	s := NewState()
+	s.SetIdle(false)
+	s.SetPlaylist([]MpvPlaylistEntry{{Filename: "track1.mp3", ID: 1}})
+	s.SetPlaylistPos(0)
+	none := s.Snapshot()
+
+	s.SetSleep(&SleepTimer{Remaining: 60})
+	started := s.Snapshot()
+	if delta := ComputeDelta(none, started); delta != nil {
+		t.Error("ComputeDelta should return nil when a sleep timer starts")
+	}
+
+	s.SetSleep(&SleepTimer{Remaining: 59})
+	ticked := s.Snapshot()
+	delta := ComputeDelta(started, ticked)
+	if delta == nil || delta.Sleep == nil || delta.Sleep.Remaining != 59 {
+		t.Errorf("delta.Sleep = %+v, want 59 seconds remaining", delta)
+	}
+
+	s.SetSleep(nil)
+	if delta := ComputeDelta(ticked, s.Snapshot()); delta != nil {
+		t.Error("ComputeDelta should return nil when a sleep timer ends")
+	}
+}
+
+func TestState_AddVote(t *testing.T) {
+	s := NewState()
+	s.SetIdle(false)
+	s.SetPlaylist([]MpvPlaylistEntry{{Filename: "a.mp3", ID: 1}, {Filename: "b.mp3", ID: 2}})
+	s.SetPlaylistPos(0)
+	prev := s.Snapshot()
+
+	s.AddVote(2)
+	s.AddVote(2)
+	curr := s.Snapshot()
+
+	if got := curr.Upcoming[0].Votes; got != 2 {
+		t.Errorf("Votes = %d, want 2", got)
+	}
+	if SnapshotsEqual(prev, curr) {
+		t.Error("SnapshotsEqual should report the vote")
+	}
+
+	s.SetPlaylist([]MpvPlaylistEntry{{Filename: "a.mp3", ID: 1}})
+	s.SetPlaylist([]MpvPlaylistEntry{{Filename: "a.mp3", ID: 1}, {Filename: "b.mp3", ID: 2}})
+	if got := s.Snapshot().Upcoming[0].Votes; got != 0 {
+		t.Errorf("Votes after removal = %d, want 0", got)
+	}
+}
+
+func TestState_SetPlaylistPosFollowsMovedEntry(t *testing.T) {
+	s := NewState()
+	s.SetPlaylist([]MpvPlaylistEntry{{Filename: "c.mp3", ID: 3}})
+	s.SetPlaylistPos(0)
+
+	s.SetPlaylist([]MpvPlaylistEntry{{Filename: "a.mp3", ID: 1}, {Filename: "c.mp3", ID: 3}})
+	item := s.SetPlaylistPos(1)
+
+	if item == nil || item.ID != 3 {
+		t.Fatalf("current = %+v, want the moved entry", item)
+	}
+	if recent := s.savedQueue().Recent; len(recent) != 0 {
+		t.Errorf("recent = %+v, want none for a moved entry", recent)
+	}
+}
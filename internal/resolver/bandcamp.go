@@ -0,0 +1,141 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/reuski/skaldi/internal/bootstrap"
+)
+
+const bandcampSearchURL = "https://bandcamp.com/api/bcsearch_public_api/1/autocomplete_elastic"
+
+// bandcampSource searches Bandcamp tracks. yt-dlp has no Bandcamp search, so
+// this asks the search API behind bandcamp.com's search box and leaves
+// playback to yt-dlp's Bandcamp extractor.
+type bandcampSource struct {
+	cfg       *bootstrap.Config
+	client    *http.Client
+	searchURL string
+}
+
+type bandcampSearchRequest struct {
+	SearchText   string `json:"search_text"`
+	SearchFilter string `json:"search_filter"`
+	FullPage     bool   `json:"full_page"`
+	FanID        *int   `json:"fan_id"`
+}
+
+type bandcampSearchResponse struct {
+	Auto struct {
+		Results []bandcampResult `json:"results"`
+	} `json:"auto"`
+}
+
+type bandcampResult struct {
+	Type        string `json:"type"`
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	BandName    string `json:"band_name"`
+	ItemURLPath string `json:"item_url_path"`
+	Img         string `json:"img"`
+}
+
+// bandcampConfig turns on Bandcamp search. The API it uses is not
+// documented and may change, so it is off unless asked for. SearchURL
+// replaces the API endpoint, for a proxy or for tests.
+type bandcampConfig struct {
+	Enabled   bool   `json:"enabled"`
+	SearchURL string `json:"search_url"`
+}
+
+func normalizeBandcampConfig(cfg bandcampConfig) (bandcampConfig, error) {
+	if cfg.SearchURL == "" {
+		cfg.SearchURL = bandcampSearchURL
+		return cfg, nil
+	}
+	u, err := url.Parse(cfg.SearchURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return cfg, fmt.Errorf("bandcamp config: search_url must be an http or https URL")
+	}
+	return cfg, nil
+}
+
+func newBandcampSource(cfg *bootstrap.Config, searchURL string) *bandcampSource {
+	return &bandcampSource{
+		cfg:       cfg,
+		client:    &http.Client{Timeout: bandcampSearchTimeout},
+		searchURL: searchURL,
+	}
+}
+
+func (s *bandcampSource) Name() string { return SourceBandcamp }
+
+func (s *bandcampSource) Options() SourceOptions {
+	return SourceOptions{
+		Bucket:        SearchBucketBandcamp,
+		MinQueryRunes: minRemoteQueryRunes,
+		MergeInto:     SourceYouTube,
+		CacheTTL:      bandcampCacheTTL,
+		SearchTimeout: bandcampSearchTimeout,
+		DiskCacheTTL:  bandcampDiskCacheTTL,
+	}
+}
+
+func (s *bandcampSource) Search(ctx context.Context, query string, limit int) ([]Track, error) {
+	body, err := json.Marshal(bandcampSearchRequest{SearchText: query, SearchFilter: "t"})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.searchURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("bandcamp search failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bandcamp search failed: %s", resp.Status)
+	}
+
+	var result bandcampSearchResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid bandcamp search response: %w", err)
+	}
+
+	tracks := make([]Track, 0, len(result.Auto.Results))
+	for _, item := range result.Auto.Results {
+		if item.Type != "t" || item.ItemURLPath == "" {
+			continue
+		}
+		tracks = append(tracks, Track{
+			ID:         strconv.FormatInt(item.ID, 10),
+			Title:      item.Name,
+			Artist:     item.BandName,
+			Uploader:   item.BandName,
+			Thumbnail:  item.Img,
+			WebpageURL: item.ItemURLPath,
+			Source:     SourceBandcamp,
+		})
+	}
+	return rankTracks(query, dedupeTracks(tracks, limit), limit), nil
+}
+
+func (s *bandcampSource) Resolve(ctx context.Context, rawURL string) ([]Track, error) {
+	tracks, err := resolveWithYtDlp(ctx, s.cfg, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return withSource(tracks, SourceBandcamp), nil
+}
@@ -0,0 +1,100 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package resolver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/reuski/skaldi/internal/bootstrap"
+)
+
+func TestBandcampSearch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req bandcampSearchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+		if r.Method != http.MethodPost || req.SearchText != "song" || req.SearchFilter != "t" {
+			t.Errorf("request = %s %+v, want a track search for song", r.Method, req)
+		}
+		w.Write([]byte(`{"auto":{"results":[
+			{"type":"b","id":1,"name":"Song Band","item_url_path":"https://songband.bandcamp.com"},
+			{"type":"t","id":2,"name":"Song","band_name":"Band","item_url_path":"https://band.bandcamp.com/track/song","img":"https://f4.bcbits.com/img/2.jpg"},
+			{"type":"t","id":3,"name":"Missing URL","band_name":"Band"}
+		]}}`))
+	}))
+	defer srv.Close()
+
+	src := newBandcampSource(nil, srv.URL)
+
+	tracks, err := src.Search(context.Background(), "song", 5)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(tracks) != 1 {
+		t.Fatalf("tracks = %+v, want only the playable track", tracks)
+	}
+	want := Track{
+		ID:         "2",
+		Title:      "Song",
+		Artist:     "Band",
+		Uploader:   "Band",
+		Thumbnail:  "https://f4.bcbits.com/img/2.jpg",
+		WebpageURL: "https://band.bandcamp.com/track/song",
+		Source:     SourceBandcamp,
+	}
+	if tracks[0] != want {
+		t.Errorf("track = %+v, want %+v", tracks[0], want)
+	}
+	if hits := searchHitsFromTracks(tracks); hits[0].QueueURL != want.WebpageURL {
+		t.Errorf("queue_url = %q, want the track page for yt-dlp", hits[0].QueueURL)
+	}
+}
+
+func TestBandcampSearchFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	src := newBandcampSource(nil, srv.URL)
+	if _, err := src.Search(context.Background(), "song", 5); err == nil {
+		t.Fatal("Search should fail on an error status")
+	}
+}
+
+func TestNewRegistersBandcampWhenEnabled(t *testing.T) {
+	bandcampSource := func(r *Resolver) *bandcampSource {
+		for _, reg := range r.registered() {
+			if src, ok := reg.Source.(*bandcampSource); ok {
+				return src
+			}
+		}
+		return nil
+	}
+
+	cfg := &bootstrap.Config{CacheDir: t.TempDir(), ConfigPath: filepath.Join(t.TempDir(), "config.json")}
+	r, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if bandcampSource(r) != nil {
+		t.Error("Bandcamp search should be off by default")
+	}
+
+	if err := os.WriteFile(cfg.ConfigPath, []byte(`{"bandcamp": {"enabled": true, "search_url": "http://127.0.0.1:0/"}}`), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if r, err = New(cfg); err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if src := bandcampSource(r); src == nil || src.searchURL != "http://127.0.0.1:0/" {
+		t.Errorf("bandcamp source = %+v, want one using the configured search_url", src)
+	}
+}
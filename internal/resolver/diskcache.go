@@ -0,0 +1,311 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package resolver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/reuski/skaldi/internal/metrics"
+)
+
+const (
+	defaultDiskCacheMaxMB = 64
+
+	// diskCacheStaleFor is how long past its TTL an entry is still served
+	// while it is refreshed. Entries nobody has used for that long are
+	// evicted.
+	diskCacheStaleFor       = 7 * 24 * time.Hour
+	diskCacheRefreshTimeout = 30 * time.Second
+	diskCacheEvictInterval  = 10 * time.Minute
+
+	suggestionDiskCacheTTL = 24 * time.Hour
+	resolveDiskCacheTTL    = 24 * time.Hour
+)
+
+var (
+	diskCacheLookups = metrics.NewCounter("skaldi_disk_cache_lookups_total",
+		"Persistent cache lookups by result: hit, stale, or miss.", "cache", "result")
+	diskCacheBytes = metrics.NewGauge("skaldi_disk_cache_bytes",
+		"Size of the persistent search and resolve cache on disk.")
+)
+
+type diskCacheConfig struct {
+	Enabled bool `json:"enabled"`
+	// MaxMB caps the size of the cache on disk.
+	MaxMB int `json:"max_mb"`
+}
+
+func normalizeDiskCacheConfig(cfg diskCacheConfig) (diskCacheConfig, error) {
+	if cfg.MaxMB < 0 {
+		return cfg, fmt.Errorf("cache config: max_mb must be >= 0")
+	}
+	if cfg.MaxMB == 0 {
+		cfg.MaxMB = defaultDiskCacheMaxMB
+	}
+	return cfg, nil
+}
+
+type diskCacheEntry struct {
+	Key        string          `json:"key"`
+	FreshUntil time.Time       `json:"fresh_until"`
+	Value      json.RawMessage `json:"value"`
+}
+
+// diskCache keeps search results and resolved tracks across restarts, one
+// file per entry. A file's modification time is when it was last used, and
+// the least recently used files are evicted once the cache outgrows its
+// size cap.
+type diskCache struct {
+	dir      string
+	maxBytes int64
+	now      func() time.Time
+
+	mu         sync.Mutex
+	size       int64
+	refreshing map[string]bool
+	evict      chan struct{}
+}
+
+func newDiskCache(dir string, maxBytes int64) *diskCache {
+	return &diskCache{
+		dir:        dir,
+		maxBytes:   maxBytes,
+		now:        time.Now,
+		refreshing: make(map[string]bool),
+		evict:      make(chan struct{}, 1),
+	}
+}
+
+// cachedLoad returns the value c holds for key in the named cache while it
+// is younger than ttl, and otherwise loads and stores it. An entry past its
+// ttl is still returned at once while load runs again in the background;
+// refreshed, when set, is given the new value. Without a cache or a ttl it
+// just loads.
+func cachedLoad[T any](ctx context.Context, c *diskCache, name, key string, ttl time.Duration, load func(context.Context) (T, error), refreshed func(T)) (T, error) {
+	if c == nil || ttl <= 0 {
+		return load(ctx)
+	}
+	key = name + "|" + key
+
+	var value T
+	if entry, ok := c.get(key); ok && json.Unmarshal(entry.Value, &value) == nil {
+		if c.now().Before(entry.FreshUntil) {
+			diskCacheLookups.Inc(name, "hit")
+			return value, nil
+		}
+		diskCacheLookups.Inc(name, "stale")
+		if c.startRefresh(key) {
+			go refreshCached(context.WithoutCancel(ctx), c, key, ttl, load, refreshed)
+		}
+		return value, nil
+	}
+
+	diskCacheLookups.Inc(name, "miss")
+	value, err := load(ctx)
+	if err != nil {
+		return value, err
+	}
+	c.put(key, ttl, value)
+	return value, nil
+}
+
+// refreshCached loads a stale entry again. It runs on after the request
+// that found the entry stale is done, so it has its own timeout.
+func refreshCached[T any](ctx context.Context, c *diskCache, key string, ttl time.Duration, load func(context.Context) (T, error), refreshed func(T)) {
+	defer c.endRefresh(key)
+
+	ctx, cancel := context.WithTimeout(ctx, diskCacheRefreshTimeout)
+	defer cancel()
+	value, err := load(ctx)
+	if err != nil {
+		return
+	}
+	c.put(key, ttl, value)
+	if refreshed != nil {
+		refreshed(value)
+	}
+}
+
+func (c *diskCache) startRefresh(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.refreshing[key] {
+		return false
+	}
+	c.refreshing[key] = true
+	return true
+}
+
+func (c *diskCache) endRefresh(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.refreshing, key)
+}
+
+func (c *diskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// get returns the entry for key unless it is missing, unreadable, or past
+// its stale period, and marks it used.
+func (c *diskCache) get(key string) (diskCacheEntry, bool) {
+	path := c.path(key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return diskCacheEntry{}, false
+	}
+	var entry diskCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Key != key {
+		return diskCacheEntry{}, false
+	}
+	now := c.now()
+	if now.After(entry.FreshUntil.Add(diskCacheStaleFor)) {
+		return diskCacheEntry{}, false
+	}
+	os.Chtimes(path, now, now)
+	return entry, true
+}
+
+// put stores value under key. Failing to is not an error for the caller,
+// which already has the value.
+func (c *diskCache) put(key string, ttl time.Duration, value any) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	data, err := json.Marshal(diskCacheEntry{Key: key, FreshUntil: c.now().Add(ttl), Value: raw})
+	if err != nil {
+		return
+	}
+	replaced, err := writeDiskCacheFile(c.dir, c.path(key), data)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.size += int64(len(data)) - replaced
+	over := c.size > c.maxBytes
+	c.mu.Unlock()
+	if over {
+		select {
+		case c.evict <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// writeDiskCacheFile replaces path with data and returns the size of the
+// file it replaced, if any.
+func writeDiskCacheFile(dir, path string, data []byte) (int64, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(dir, "*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	var replaced int64
+	if err == nil {
+		if info, statErr := os.Stat(path); statErr == nil {
+			replaced = info.Size()
+		}
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	return replaced, nil
+}
+
+// Run evicts old entries now, every diskCacheEvictInterval, and whenever
+// the cache grows past its size cap, until ctx is done.
+func (c *diskCache) Run(ctx context.Context, logger *slog.Logger) {
+	ticker := time.NewTicker(diskCacheEvictInterval)
+	defer ticker.Stop()
+	for {
+		if err := c.evictOld(); err != nil {
+			logger.Warn("Failed to evict from the search cache", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-c.evict:
+		}
+	}
+}
+
+// evictOld removes entries unused for diskCacheStaleFor. If the cache is
+// still over its cap, it removes the least recently used ones until it is
+// back under 90% of the cap, so it does not evict again after every write.
+func (c *diskCache) evictOld() error {
+	dirEntries, err := os.ReadDir(c.dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to list search cache: %w", err)
+	}
+
+	type cacheFile struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	now := c.now()
+	files := make([]cacheFile, 0, len(dirEntries))
+	var size int64
+	for _, dirEntry := range dirEntries {
+		info, err := dirEntry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		path := filepath.Join(c.dir, dirEntry.Name())
+		// Leftover temporary files are only removed once old, as a write
+		// may still be under way.
+		if now.Sub(info.ModTime()) > diskCacheStaleFor || (strings.HasSuffix(path, ".tmp") && now.Sub(info.ModTime()) > time.Hour) {
+			os.Remove(path)
+			continue
+		}
+		files = append(files, cacheFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		size += info.Size()
+	}
+
+	if size > c.maxBytes {
+		sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+		target := c.maxBytes / 10 * 9
+		for _, file := range files {
+			if size <= target {
+				break
+			}
+			if err := os.Remove(file.path); err == nil || errors.Is(err, fs.ErrNotExist) {
+				size -= file.size
+			}
+		}
+	}
+
+	c.mu.Lock()
+	c.size = size
+	c.mu.Unlock()
+	diskCacheBytes.Set(float64(size))
+	return nil
+}
@@ -0,0 +1,209 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package resolver
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func newTestDiskCache(t *testing.T, dir string, maxBytes int64) (*diskCache, *fakeClock) {
+	t.Helper()
+	clock := &fakeClock{now: time.Now()}
+	c := newDiskCache(dir, maxBytes)
+	c.now = clock.Now
+	return c, clock
+}
+
+func TestCachedLoad(t *testing.T) {
+	dir := t.TempDir()
+	c, clock := newTestDiskCache(t, dir, 1<<20)
+
+	loads := 0
+	value := "first"
+	load := func(ctx context.Context) (string, error) {
+		loads++
+		return value, nil
+	}
+	get := func(c *diskCache, refreshed func(string)) string {
+		t.Helper()
+		got, err := cachedLoad(context.Background(), c, "test", "key", time.Hour, load, refreshed)
+		if err != nil {
+			t.Fatalf("cachedLoad failed: %v", err)
+		}
+		return got
+	}
+
+	if got := get(c, nil); got != "first" || loads != 1 {
+		t.Fatalf("miss = %q after %d loads", got, loads)
+	}
+	if got := get(c, nil); got != "first" || loads != 1 {
+		t.Fatalf("hit = %q after %d loads, want no new load", got, loads)
+	}
+
+	// A restart finds the entry on disk.
+	restarted := newDiskCache(dir, 1<<20)
+	restarted.now = clock.Now
+	if got := get(restarted, nil); got != "first" || loads != 1 {
+		t.Fatalf("after restart = %q after %d loads", got, loads)
+	}
+
+	// A stale entry is served at once and refreshed in the background.
+	clock.now = clock.now.Add(2 * time.Hour)
+	value = "second"
+	refreshed := make(chan string, 1)
+	if got := get(c, func(v string) { refreshed <- v }); got != "first" {
+		t.Fatalf("stale = %q, want the old value", got)
+	}
+	select {
+	case got := <-refreshed:
+		if got != "second" {
+			t.Errorf("refreshed = %q, want second", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stale entry was not refreshed")
+	}
+	if got := get(c, nil); got != "second" || loads != 2 {
+		t.Fatalf("after refresh = %q after %d loads", got, loads)
+	}
+
+	// Past its stale period an entry is loaded again before answering.
+	clock.now = clock.now.Add(diskCacheStaleFor + 2*time.Hour)
+	value = "third"
+	if got := get(c, nil); got != "third" || loads != 3 {
+		t.Fatalf("expired = %q after %d loads", got, loads)
+	}
+}
+
+func TestCachedLoadErrors(t *testing.T) {
+	c, _ := newTestDiskCache(t, t.TempDir(), 1<<20)
+	failing := func(ctx context.Context) ([]Track, error) { return nil, errors.New("yt-dlp failed") }
+	if _, err := cachedLoad(context.Background(), c, "test", "key", time.Hour, failing, nil); err == nil {
+		t.Fatal("cachedLoad should return the load error")
+	}
+	if _, ok := c.get("test|key"); ok {
+		t.Error("a failed load should not be cached")
+	}
+
+	loads := 0
+	counting := func(ctx context.Context) ([]Track, error) {
+		loads++
+		return []Track{}, nil
+	}
+	for range 2 {
+		cachedLoad(context.Background(), nil, "test", "key", time.Hour, counting, nil)
+		cachedLoad(context.Background(), c, "test", "other", 0, counting, nil)
+	}
+	if loads != 4 {
+		t.Errorf("loads = %d, want every load without a cache or ttl", loads)
+	}
+}
+
+func TestDiskCacheEvict(t *testing.T) {
+	dir := t.TempDir()
+	c, clock := newTestDiskCache(t, dir, 1<<20)
+
+	keys := []string{"old", "a", "b", "c"}
+	for i, key := range keys {
+		c.put(key, time.Hour, strings.Repeat("x", 400))
+		used := clock.now.Add(time.Duration(i-len(keys)) * time.Minute)
+		if key == "old" {
+			used = clock.now.Add(-diskCacheStaleFor - time.Hour)
+		}
+		if err := os.Chtimes(c.path(key), used, used); err != nil {
+			t.Fatalf("Chtimes failed: %v", err)
+		}
+	}
+	info, err := os.Stat(c.path("a"))
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	// Room for two entries, so evicting down to 90% leaves one.
+	c.maxBytes = 2*info.Size() + 10
+
+	if err := c.evictOld(); err != nil {
+		t.Fatalf("evictOld failed: %v", err)
+	}
+	var left []string
+	for _, key := range keys {
+		if _, err := os.Stat(c.path(key)); err == nil {
+			left = append(left, key)
+		}
+	}
+	if got := strings.Join(left, ","); got != "c" {
+		t.Errorf("left = %s, want only the most recently used entry", got)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(entries) != 1 || filepath.Join(dir, entries[0].Name()) != c.path("c") {
+		t.Errorf("cache dir holds %d files, want 1", len(entries))
+	}
+}
+
+func TestResolveUsesDiskCache(t *testing.T) {
+	r := newTestResolver(t)
+	if err := os.WriteFile(r.cfg.ConfigPath, []byte(`{"cache": {"enabled": true}}`), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	calls := filepath.Join(t.TempDir(), "calls")
+	writeExecutable(t, r.cfg.ShimPath(), `#!/bin/sh
+echo run >> "`+calls+`"
+printf '%s\n' '{"id":"vid-1","title":"Song","uploader":"Band","webpage_url":"https://www.youtube.com/watch?v=vid-1","ie_key":"Youtube"}'
+`)
+
+	for range 2 {
+		restarted, err := New(r.cfg)
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		if restarted.disk == nil {
+			t.Fatal("persistent cache should be enabled")
+		}
+		tracks, err := restarted.Resolve(context.Background(), "https://www.youtube.com/watch?v=vid-1")
+		if err != nil {
+			t.Fatalf("Resolve failed: %v", err)
+		}
+		if len(tracks) != 1 || tracks[0].Title != "Song" {
+			t.Fatalf("tracks = %+v", tracks)
+		}
+	}
+
+	data, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if n := strings.Count(string(data), "run"); n != 1 {
+		t.Errorf("yt-dlp ran %d times, want once across restarts", n)
+	}
+}
+
+func TestDiskCachePutOverwriteKeepsSize(t *testing.T) {
+	c, _ := newTestDiskCache(t, t.TempDir(), 1<<20)
+	c.put("key", time.Hour, "value")
+	info, err := os.Stat(c.path("key"))
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+
+	for range 5 {
+		c.put("key", time.Hour, "value")
+	}
+	c.mu.Lock()
+	size := c.size
+	c.mu.Unlock()
+	if size != info.Size() {
+		t.Errorf("size = %d after overwriting one entry, want %d", size, info.Size())
+	}
+}
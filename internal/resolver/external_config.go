@@ -3,6 +3,7 @@
 package resolver
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -15,46 +16,97 @@ import (
 var libraryIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
 
 type appConfig struct {
-	OpenSubsonic openSubsonicConfig `json:"opensubsonic"`
+	OpenSubsonic openSubsonicConfigs `json:"opensubsonic"`
+	Local        localLibraryConfig  `json:"local"`
+	Cache        diskCacheConfig     `json:"cache"`
+	Bandcamp     bandcampConfig      `json:"bandcamp"`
 }
 
 type openSubsonicConfig struct {
 	Enabled   bool   `json:"enabled"`
 	LibraryID string `json:"library_id"`
+	Label     string `json:"label"`
 	BaseURL   string `json:"base_url"`
 	Username  string `json:"username"`
 	Token     string `json:"token"`
 	TimeoutMS int    `json:"timeout_ms"`
 }
 
-func loadOpenSubsonicConfig(path string) (*openSubsonicConfig, error) {
+type openSubsonicConfigs []openSubsonicConfig
+
+// UnmarshalJSON accepts a list of libraries as well as the single library
+// object older configs have.
+func (c *openSubsonicConfigs) UnmarshalJSON(data []byte) error {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var single openSubsonicConfig
+		if err := json.Unmarshal(data, &single); err != nil {
+			return err
+		}
+		*c = openSubsonicConfigs{single}
+		return nil
+	}
+
+	var list []openSubsonicConfig
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*c = list
+	return nil
+}
+
+// readAppConfig reads the config file, reporting false when there is none.
+func readAppConfig(path string) (appConfig, bool, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			return nil, nil
+			return appConfig{}, false, nil
 		}
-		return nil, fmt.Errorf("failed to read config: %w", err)
+		return appConfig{}, false, fmt.Errorf("failed to read config: %w", err)
 	}
 
 	if strings.TrimSpace(string(data)) == "" {
-		return nil, nil
+		return appConfig{}, false, nil
 	}
 
 	var cfg appConfig
 	if err := json.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("invalid config JSON at %s: %w", path, err)
+		return appConfig{}, false, fmt.Errorf("invalid config JSON at %s: %w", path, err)
 	}
+	return cfg, true, nil
+}
 
-	if !cfg.OpenSubsonic.Enabled {
+// loadOpenSubsonicConfigs returns the enabled libraries that are valid,
+// along with a problem for each one left out.
+func loadOpenSubsonicConfigs(path string) ([]openSubsonicConfig, []error) {
+	cfg, ok, err := readAppConfig(path)
+	if err != nil {
+		return nil, []error{err}
+	}
+	if !ok {
 		return nil, nil
 	}
 
-	normalized, err := normalizeOpenSubsonicConfig(cfg.OpenSubsonic)
-	if err != nil {
-		return nil, err
+	var libraries []openSubsonicConfig
+	var problems []error
+	seen := make(map[string]struct{}, len(cfg.OpenSubsonic))
+	for i, library := range cfg.OpenSubsonic {
+		if !library.Enabled {
+			continue
+		}
+		normalized, err := normalizeOpenSubsonicConfig(library)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("library %d: %w", i+1, err))
+			continue
+		}
+		if _, ok := seen[normalized.LibraryID]; ok {
+			problems = append(problems, fmt.Errorf("library %d: library_id %q is already used", i+1, normalized.LibraryID))
+			continue
+		}
+		seen[normalized.LibraryID] = struct{}{}
+		libraries = append(libraries, normalized)
 	}
 
-	return &normalized, nil
+	return libraries, problems
 }
 
 func normalizeOpenSubsonicConfig(cfg openSubsonicConfig) (openSubsonicConfig, error) {
@@ -93,6 +145,51 @@ func normalizeOpenSubsonicConfig(cfg openSubsonicConfig) (openSubsonicConfig, er
 	if cfg.TimeoutMS == 0 {
 		cfg.TimeoutMS = 2500
 	}
+	if cfg.Label == "" {
+		cfg.Label = cfg.LibraryID
+	}
 
 	return cfg, nil
 }
+
+// loadLocalLibraryConfig returns the local library config, reporting false
+// when it is missing or disabled.
+func loadLocalLibraryConfig(path string) (localLibraryConfig, bool, error) {
+	cfg, ok, err := readAppConfig(path)
+	if err != nil || !ok || !cfg.Local.Enabled {
+		return localLibraryConfig{}, false, err
+	}
+	local, err := normalizeLocalLibraryConfig(cfg.Local)
+	if err != nil {
+		return localLibraryConfig{}, false, err
+	}
+	return local, true, nil
+}
+
+// loadDiskCacheConfig returns the persistent cache config, reporting false
+// when it is missing or disabled.
+func loadDiskCacheConfig(path string) (diskCacheConfig, bool, error) {
+	cfg, ok, err := readAppConfig(path)
+	if err != nil || !ok || !cfg.Cache.Enabled {
+		return diskCacheConfig{}, false, err
+	}
+	cache, err := normalizeDiskCacheConfig(cfg.Cache)
+	if err != nil {
+		return diskCacheConfig{}, false, err
+	}
+	return cache, true, nil
+}
+
+// loadBandcampConfig returns the Bandcamp search config, reporting false
+// when it is missing or disabled.
+func loadBandcampConfig(path string) (bandcampConfig, bool, error) {
+	cfg, ok, err := readAppConfig(path)
+	if err != nil || !ok || !cfg.Bandcamp.Enabled {
+		return bandcampConfig{}, false, err
+	}
+	bandcamp, err := normalizeBandcampConfig(cfg.Bandcamp)
+	if err != nil {
+		return bandcampConfig{}, false, err
+	}
+	return bandcamp, true, nil
+}
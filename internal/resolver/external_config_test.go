@@ -11,29 +11,29 @@ import (
 	"github.com/reuski/skaldi/internal/bootstrap"
 )
 
-func TestLoadOpenSubsonicConfig_MissingOrEmpty(t *testing.T) {
-	cfg, err := loadOpenSubsonicConfig(filepath.Join(t.TempDir(), "missing.json"))
-	if err != nil {
-		t.Fatalf("missing file error: %v", err)
+func TestLoadOpenSubsonicConfigs_MissingOrEmpty(t *testing.T) {
+	libraries, problems := loadOpenSubsonicConfigs(filepath.Join(t.TempDir(), "missing.json"))
+	if len(problems) != 0 {
+		t.Fatalf("missing file problems: %v", problems)
 	}
-	if cfg != nil {
-		t.Fatalf("missing file cfg = %#v, want nil", cfg)
+	if libraries != nil {
+		t.Fatalf("missing file libraries = %#v, want nil", libraries)
 	}
 
 	emptyPath := filepath.Join(t.TempDir(), "config.json")
 	if err := os.WriteFile(emptyPath, []byte("\n"), 0o644); err != nil {
 		t.Fatalf("WriteFile failed: %v", err)
 	}
-	cfg, err = loadOpenSubsonicConfig(emptyPath)
-	if err != nil {
-		t.Fatalf("empty file error: %v", err)
+	libraries, problems = loadOpenSubsonicConfigs(emptyPath)
+	if len(problems) != 0 {
+		t.Fatalf("empty file problems: %v", problems)
 	}
-	if cfg != nil {
-		t.Fatalf("empty file cfg = %#v, want nil", cfg)
+	if libraries != nil {
+		t.Fatalf("empty file libraries = %#v, want nil", libraries)
 	}
 }
 
-func TestLoadOpenSubsonicConfig_ValidEnabled(t *testing.T) {
+func TestLoadOpenSubsonicConfigs_SingleObject(t *testing.T) {
 	path := filepath.Join(t.TempDir(), "config.json")
 	data := []byte(`{
   "opensubsonic": {
@@ -48,20 +48,56 @@ func TestLoadOpenSubsonicConfig_ValidEnabled(t *testing.T) {
 		t.Fatalf("WriteFile failed: %v", err)
 	}
 
-	cfg, err := loadOpenSubsonicConfig(path)
-	if err != nil {
-		t.Fatalf("loadOpenSubsonicConfig failed: %v", err)
+	libraries, problems := loadOpenSubsonicConfigs(path)
+	if len(problems) != 0 {
+		t.Fatalf("loadOpenSubsonicConfigs problems: %v", problems)
+	}
+	if len(libraries) != 1 {
+		t.Fatalf("libraries = %d, want 1", len(libraries))
 	}
-	if cfg == nil {
-		t.Fatal("cfg is nil")
-	} else if cfg.BaseURL != "https://demo.example.com" {
+	cfg := libraries[0]
+	if cfg.BaseURL != "https://demo.example.com" {
 		t.Fatalf("BaseURL = %q, want https://demo.example.com", cfg.BaseURL)
-	} else if cfg.TimeoutMS != 2500 {
+	}
+	if cfg.TimeoutMS != 2500 {
 		t.Fatalf("TimeoutMS = %d, want 2500", cfg.TimeoutMS)
 	}
+	if cfg.Label != "personal" {
+		t.Fatalf("Label = %q, want the library ID", cfg.Label)
+	}
+}
+
+func TestLoadOpenSubsonicConfigs_List(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := []byte(`{
+  "opensubsonic": [
+    {"enabled": true, "library_id": "navidrome", "label": "Navidrome", "base_url": "https://navidrome.example.com", "username": "alice", "token": "secret"},
+    {"enabled": true, "library_id": "gonic", "base_url": "https://gonic.example.com", "username": "alice", "token": "secret"},
+    {"enabled": true, "library_id": "broken", "base_url": "https://broken.example.com"},
+    {"enabled": true, "library_id": "gonic", "base_url": "https://other.example.com", "username": "alice", "token": "secret"},
+    {"enabled": false, "library_id": "off"}
+  ]
+}`)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	libraries, problems := loadOpenSubsonicConfigs(path)
+	if len(libraries) != 2 {
+		t.Fatalf("libraries = %d, want 2", len(libraries))
+	}
+	if libraries[0].Label != "Navidrome" || libraries[1].LibraryID != "gonic" {
+		t.Errorf("libraries = %+v", libraries)
+	}
+	if len(problems) != 2 {
+		t.Fatalf("problems = %v, want invalid and duplicate entries", problems)
+	}
+	if !strings.Contains(problems[1].Error(), "already used") {
+		t.Errorf("problem = %q, want duplicate library_id", problems[1])
+	}
 }
 
-func TestLoadOpenSubsonicConfig_InvalidEnabled(t *testing.T) {
+func TestLoadOpenSubsonicConfigs_InvalidEnabled(t *testing.T) {
 	path := filepath.Join(t.TempDir(), "config.json")
 	data := []byte(`{
   "opensubsonic": {
@@ -74,9 +110,12 @@ func TestLoadOpenSubsonicConfig_InvalidEnabled(t *testing.T) {
 		t.Fatalf("WriteFile failed: %v", err)
 	}
 
-	cfg, err := loadOpenSubsonicConfig(path)
-	if err == nil {
-		t.Fatalf("expected error, got cfg=%#v", cfg)
+	libraries, problems := loadOpenSubsonicConfigs(path)
+	if len(problems) != 1 {
+		t.Fatalf("problems = %v, want 1 (libraries=%#v)", problems, libraries)
+	}
+	if len(libraries) != 0 {
+		t.Fatalf("libraries = %#v, want none", libraries)
 	}
 }
 
@@ -97,7 +136,7 @@ func TestResolverNew_DisablesInvalidOpenSubsonicConfig(t *testing.T) {
 	if err != nil {
 		t.Fatalf("New failed: %v", err)
 	}
-	if r.subsonic != nil {
+	if _, ok := r.source(SourceSubsonic); ok {
 		t.Fatal("subsonic client should be disabled")
 	}
 	warnings := r.Warnings()
@@ -108,3 +147,94 @@ func TestResolverNew_DisablesInvalidOpenSubsonicConfig(t *testing.T) {
 		t.Fatalf("warning = %q, want opensubsonic disabled", got)
 	}
 }
+
+func TestLoadLocalLibraryConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantOK  bool
+		wantErr bool
+	}{
+		{name: "missing", data: `{}`},
+		{name: "disabled", data: `{"local": {"enabled": false, "dirs": ["/srv/music"]}}`},
+		{name: "enabled", data: `{"local": {"enabled": true, "label": "FLAC", "dirs": ["/srv/music"]}}`, wantOK: true},
+		{name: "relative dir", data: `{"local": {"enabled": true, "dirs": ["music"]}}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+				t.Fatalf("WriteFile failed: %v", err)
+			}
+			cfg, ok, err := loadLocalLibraryConfig(path)
+			if (err != nil) != tt.wantErr || ok != tt.wantOK {
+				t.Fatalf("loadLocalLibraryConfig = %+v, %v, %v", cfg, ok, err)
+			}
+			if ok && (cfg.Label != "FLAC" || cfg.Dirs[0] != "/srv/music") {
+				t.Errorf("cfg = %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestLoadDiskCacheConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantOK  bool
+		wantMB  int
+		wantErr bool
+	}{
+		{name: "missing", data: `{}`},
+		{name: "disabled", data: `{"cache": {"enabled": false}}`},
+		{name: "default size", data: `{"cache": {"enabled": true}}`, wantOK: true, wantMB: defaultDiskCacheMaxMB},
+		{name: "size", data: `{"cache": {"enabled": true, "max_mb": 16}}`, wantOK: true, wantMB: 16},
+		{name: "negative size", data: `{"cache": {"enabled": true, "max_mb": -1}}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+				t.Fatalf("WriteFile failed: %v", err)
+			}
+			cfg, ok, err := loadDiskCacheConfig(path)
+			if (err != nil) != tt.wantErr || ok != tt.wantOK {
+				t.Fatalf("loadDiskCacheConfig = %+v, %v, %v", cfg, ok, err)
+			}
+			if ok && cfg.MaxMB != tt.wantMB {
+				t.Errorf("max_mb = %d, want %d", cfg.MaxMB, tt.wantMB)
+			}
+		})
+	}
+}
+
+func TestLoadBandcampConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantOK  bool
+		wantURL string
+		wantErr bool
+	}{
+		{name: "missing", data: `{}`},
+		{name: "disabled", data: `{"bandcamp": {"enabled": false}}`},
+		{name: "default url", data: `{"bandcamp": {"enabled": true}}`, wantOK: true, wantURL: bandcampSearchURL},
+		{name: "own url", data: `{"bandcamp": {"enabled": true, "search_url": "http://127.0.0.1:9000/search"}}`, wantOK: true, wantURL: "http://127.0.0.1:9000/search"},
+		{name: "bad url", data: `{"bandcamp": {"enabled": true, "search_url": "bandcamp.com"}}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+				t.Fatalf("WriteFile failed: %v", err)
+			}
+			cfg, ok, err := loadBandcampConfig(path)
+			if (err != nil) != tt.wantErr || ok != tt.wantOK {
+				t.Fatalf("loadBandcampConfig = %+v, %v, %v", cfg, ok, err)
+			}
+			if ok && cfg.SearchURL != tt.wantURL {
+				t.Errorf("search_url = %q, want %q", cfg.SearchURL, tt.wantURL)
+			}
+		})
+	}
+}
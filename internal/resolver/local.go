@@ -0,0 +1,486 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package resolver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	LocalURIScheme = "skaldi+local"
+
+	localCacheTTL             = 30 * time.Second
+	localSearchTimeout        = time.Second
+	localProbeTimeout         = 15 * time.Second
+	localProbeWorkers         = 4
+	defaultLocalRescanMinutes = 10
+)
+
+// localAudioExts are the file extensions indexed as tracks.
+var localAudioExts = map[string]bool{
+	".aac": true, ".aif": true, ".aiff": true, ".alac": true, ".ape": true,
+	".flac": true, ".m4a": true, ".mka": true, ".mp3": true, ".mpc": true,
+	".oga": true, ".ogg": true, ".opus": true, ".wav": true, ".wma": true,
+	".wv": true,
+}
+
+type localLibraryConfig struct {
+	Enabled bool     `json:"enabled"`
+	Label   string   `json:"label"`
+	Dirs    []string `json:"dirs"`
+	// RescanMinutes is how often the folders are checked for changes.
+	RescanMinutes int `json:"rescan_minutes"`
+}
+
+func normalizeLocalLibraryConfig(cfg localLibraryConfig) (localLibraryConfig, error) {
+	if len(cfg.Dirs) == 0 {
+		return cfg, fmt.Errorf("local library config: dirs is required when enabled")
+	}
+	dirs := make([]string, 0, len(cfg.Dirs))
+	for _, dir := range cfg.Dirs {
+		if !filepath.IsAbs(dir) {
+			return cfg, fmt.Errorf("local library config: dir %q must be an absolute path", dir)
+		}
+		dir = filepath.Clean(dir)
+		if !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	cfg.Dirs = dirs
+	if cfg.RescanMinutes < 0 {
+		return cfg, fmt.Errorf("local library config: rescan_minutes must be >= 0")
+	}
+	if cfg.RescanMinutes == 0 {
+		cfg.RescanMinutes = defaultLocalRescanMinutes
+	}
+	return cfg, nil
+}
+
+// localEntry is one indexed file. Size and ModTime tell a rescan whether
+// the file's tags need reading again.
+type localEntry struct {
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mod_time"`
+	Title    string    `json:"title,omitempty"`
+	Artist   string    `json:"artist,omitempty"`
+	Album    string    `json:"album,omitempty"`
+	Duration float64   `json:"duration,omitempty"`
+}
+
+type localTags struct {
+	Title    string
+	Artist   string
+	Album    string
+	Duration float64
+}
+
+// localSource searches audio files in folders on this machine. Their tags
+// are read with ffprobe into an index kept on disk, which is brought up to
+// date by rescanning the folders and probing only new or changed files.
+type localSource struct {
+	cfg       localLibraryConfig
+	indexPath string
+	logger    *slog.Logger
+	probe     func(ctx context.Context, path string) (localTags, error)
+
+	mu      sync.RWMutex
+	entries map[string]localEntry
+}
+
+func newLocalSource(cfg localLibraryConfig, indexPath, ffprobePath string) *localSource {
+	return &localSource{
+		cfg:       cfg,
+		indexPath: indexPath,
+		logger:    slog.New(slog.DiscardHandler),
+		probe: func(ctx context.Context, path string) (localTags, error) {
+			return ffprobeTags(ctx, ffprobePath, path)
+		},
+		entries: make(map[string]localEntry),
+	}
+}
+
+func (s *localSource) Name() string { return SourceLocal }
+
+func (s *localSource) Options() SourceOptions {
+	return SourceOptions{
+		Bucket:        SearchBucketLocal,
+		Label:         s.cfg.Label,
+		Scheme:        LocalURIScheme,
+		Typeahead:     true,
+		CacheTTL:      localCacheTTL,
+		SearchTimeout: localSearchTimeout,
+	}
+}
+
+// Search matches every word of the query against each file's title, artist,
+// album and name. Title matches rank first, then artist matches.
+func (s *localSource) Search(ctx context.Context, query string, limit int) ([]Track, error) {
+	words := strings.Fields(query)
+	if len(words) == 0 {
+		return nil, nil
+	}
+
+	type match struct {
+		entry localEntry
+		score int
+	}
+	var matches []match
+
+	s.mu.RLock()
+	for _, entry := range s.entries {
+		title := strings.ToLower(entry.Title)
+		artist := strings.ToLower(entry.Artist)
+		text := title + " " + artist + " " + strings.ToLower(entry.Album+" "+filepath.Base(entry.Path))
+		score := 0
+		for _, word := range words {
+			if !strings.Contains(text, word) {
+				score = -1
+				break
+			}
+			if strings.Contains(title, word) {
+				score += 2
+			} else if strings.Contains(artist, word) {
+				score++
+			}
+		}
+		if score >= 0 {
+			matches = append(matches, match{entry: entry, score: score})
+		}
+	}
+	s.mu.RUnlock()
+
+	slices.SortFunc(matches, func(a, b match) int {
+		if a.score != b.score {
+			return b.score - a.score
+		}
+		return strings.Compare(a.entry.Path, b.entry.Path)
+	})
+
+	tracks := make([]Track, 0, min(limit, len(matches)))
+	for _, m := range matches[:min(limit, len(matches))] {
+		tracks = append(tracks, m.entry.track())
+	}
+	return tracks, nil
+}
+
+// Resolve plays an indexed file straight from disk. Only files in the index,
+// and so inside the configured folders, can be queued.
+func (s *localSource) Resolve(ctx context.Context, rawURL string) ([]Track, error) {
+	path, ok := ParseLocalURI(rawURL)
+	if !ok {
+		return nil, fmt.Errorf("invalid local library uri: %s", rawURL)
+	}
+
+	s.mu.RLock()
+	entry, ok := s.entries[path]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("not in the local library: %s", path)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("local library file is gone: %w", err)
+	}
+
+	track := entry.track()
+	track.URL = path
+	track.Source = SourceLocal
+	return []Track{track}, nil
+}
+
+// Run loads the saved index and keeps it current until ctx is done.
+func (s *localSource) Run(ctx context.Context, logger *slog.Logger) {
+	s.logger = logger
+	if err := s.loadIndex(); err != nil {
+		s.logger.Warn("Ignoring saved local library index", "error", err)
+	}
+
+	ticker := time.NewTicker(time.Duration(s.cfg.RescanMinutes) * time.Minute)
+	defer ticker.Stop()
+	for {
+		if err := s.scan(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Error("Failed to scan local library", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *localSource) loadIndex() error {
+	data, err := os.ReadFile(s.indexPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to read local library index: %w", err)
+	}
+
+	var entries []localEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("invalid local library index at %s: %w", s.indexPath, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range entries {
+		if s.inDirs(entry.Path) {
+			s.entries[entry.Path] = entry
+		}
+	}
+	return nil
+}
+
+// scan walks the folders, reusing index entries for files whose size and
+// modification time are unchanged and probing the rest. Files that are no
+// longer there drop out of the index.
+func (s *localSource) scan(ctx context.Context) error {
+	s.mu.RLock()
+	previous := s.entries
+	s.mu.RUnlock()
+
+	found := make(map[string]localEntry, len(previous))
+	var toProbe []localEntry
+	for _, dir := range s.cfg.Dirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				s.logger.Warn("Skipping unreadable local library path", "path", path, "error", err)
+				return nil
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if strings.HasPrefix(d.Name(), ".") && path != dir {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() || !localAudioExts[strings.ToLower(filepath.Ext(path))] {
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			entry := localEntry{Path: path, Size: info.Size(), ModTime: info.ModTime().UTC()}
+			if old, ok := previous[path]; ok && old.Size == entry.Size && old.ModTime.Equal(entry.ModTime) {
+				found[path] = old
+				return nil
+			}
+			toProbe = append(toProbe, entry)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to scan %s: %w", dir, err)
+		}
+	}
+
+	probed := s.probeAll(ctx, toProbe)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, entry := range probed {
+		found[entry.Path] = entry
+	}
+
+	removed := 0
+	for path := range previous {
+		if _, ok := found[path]; !ok {
+			removed++
+		}
+	}
+
+	s.mu.Lock()
+	s.entries = found
+	s.mu.Unlock()
+
+	if len(probed) == 0 && removed == 0 {
+		return nil
+	}
+	s.logger.Info("Local library updated", "tracks", len(found), "probed", len(probed), "removed", removed)
+	return s.saveIndex(found)
+}
+
+// probeAll reads the tags of entries a few files at a time. Files ffprobe
+// cannot read are still indexed under their file name.
+func (s *localSource) probeAll(ctx context.Context, entries []localEntry) []localEntry {
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(localProbeWorkers, len(entries)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				probeCtx, cancel := context.WithTimeout(ctx, localProbeTimeout)
+				tags, err := s.probe(probeCtx, entries[i].Path)
+				cancel()
+				if err != nil && ctx.Err() == nil {
+					s.logger.Warn("Failed to read local file tags", "path", entries[i].Path, "error", err)
+				}
+				entries[i].Title = tags.Title
+				entries[i].Artist = tags.Artist
+				entries[i].Album = tags.Album
+				entries[i].Duration = tags.Duration
+			}
+		}()
+	}
+	for i := range entries {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return entries
+}
+
+func (s *localSource) saveIndex(entries map[string]localEntry) error {
+	list := make([]localEntry, 0, len(entries))
+	for _, entry := range entries {
+		list = append(list, entry)
+	}
+	slices.SortFunc(list, func(a, b localEntry) int { return strings.Compare(a.Path, b.Path) })
+
+	data, err := json.Marshal(list)
+	if err != nil {
+		return fmt.Errorf("failed to encode local library index: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.indexPath), 0o755); err != nil {
+		return fmt.Errorf("failed to create cache dir: %w", err)
+	}
+	tmp := s.indexPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write local library index: %w", err)
+	}
+	if err := os.Rename(tmp, s.indexPath); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to replace local library index: %w", err)
+	}
+	return nil
+}
+
+func (s *localSource) inDirs(path string) bool {
+	for _, dir := range s.cfg.Dirs {
+		if rel, err := filepath.Rel(dir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e localEntry) track() Track {
+	title := e.Title
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(e.Path), filepath.Ext(e.Path))
+	}
+	artist := e.Artist
+	if artist == "" {
+		artist = "Local"
+	}
+	return Track{
+		ID:         e.Path,
+		Title:      title,
+		Artist:     artist,
+		Duration:   e.Duration,
+		Uploader:   artist,
+		WebpageURL: BuildLocalURI(e.Path),
+		Source:     SourceLocal,
+	}
+}
+
+func BuildLocalURI(path string) string {
+	u := url.URL{Scheme: LocalURIScheme, Path: "/" + strings.TrimPrefix(filepath.ToSlash(path), "/")}
+	return u.String()
+}
+
+// ParseLocalURI returns the absolute file path a skaldi+local URI names.
+func ParseLocalURI(raw string) (string, bool) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != LocalURIScheme || u.Host != "" || u.Path == "" {
+		return "", false
+	}
+	path := filepath.FromSlash(u.Path)
+	if !filepath.IsAbs(path) {
+		path = filepath.FromSlash(strings.TrimPrefix(u.Path, "/"))
+	}
+	if !filepath.IsAbs(path) || filepath.Clean(path) != path {
+		return "", false
+	}
+	return path, true
+}
+
+type ffprobeOutput struct {
+	Format struct {
+		Duration string            `json:"duration"`
+		Tags     map[string]string `json:"tags"`
+	} `json:"format"`
+	Streams []struct {
+		Tags map[string]string `json:"tags"`
+	} `json:"streams"`
+}
+
+// ffprobeTags reads a file's title, artist, album and length. Tag names
+// differ in case between formats, and Ogg files keep theirs on the stream.
+func ffprobeTags(ctx context.Context, ffprobePath, path string) (localTags, error) {
+	cmd := exec.CommandContext(ctx, ffprobePath, "-v", "error", "-print_format", "json",
+		"-show_format", "-show_streams", "-select_streams", "a:0", "--", path)
+	out, err := cmd.Output()
+	if err != nil {
+		return localTags{}, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	return parseFFprobeTags(out)
+}
+
+func parseFFprobeTags(out []byte) (localTags, error) {
+	var probe ffprobeOutput
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return localTags{}, fmt.Errorf("invalid ffprobe output: %w", err)
+	}
+
+	tags := make(map[string]string)
+	for _, stream := range probe.Streams {
+		for key, value := range stream.Tags {
+			tags[strings.ToLower(key)] = strings.TrimSpace(value)
+		}
+	}
+	for key, value := range probe.Format.Tags {
+		if value = strings.TrimSpace(value); value != "" {
+			tags[strings.ToLower(key)] = value
+		}
+	}
+
+	result := localTags{
+		Title:  tags["title"],
+		Artist: tags["artist"],
+		Album:  tags["album"],
+	}
+	if result.Artist == "" {
+		result.Artist = tags["album_artist"]
+	}
+	if duration, err := strconv.ParseFloat(probe.Format.Duration, 64); err == nil && duration > 0 {
+		result.Duration = duration
+	}
+	return result, nil
+}
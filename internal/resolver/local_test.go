@@ -0,0 +1,237 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package resolver
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLocalURIRoundTrip(t *testing.T) {
+	path := "/srv/music/Some Band/01 #1 Song?.flac"
+	raw := BuildLocalURI(path)
+	if !strings.HasPrefix(raw, "skaldi+local:///srv/music/") {
+		t.Fatalf("BuildLocalURI = %q", raw)
+	}
+	got, ok := ParseLocalURI(raw)
+	if !ok || got != path {
+		t.Fatalf("ParseLocalURI(%q) = %q, %v, want %q", raw, got, ok, path)
+	}
+
+	for _, raw := range []string{
+		"",
+		"file:///srv/music/a.flac",
+		"skaldi+local://host/srv/music/a.flac",
+		"skaldi+local:///srv/music/../../etc/passwd",
+		"skaldi+local:relative.flac",
+	} {
+		if _, ok := ParseLocalURI(raw); ok {
+			t.Errorf("ParseLocalURI(%q) = ok, want not ok", raw)
+		}
+	}
+}
+
+func TestParseFFprobeTags(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want localTags
+	}{
+		{
+			name: "format tags",
+			out:  `{"format":{"duration":"241.5","tags":{"title":"Song","artist":"Band","album":"Record"}}}`,
+			want: localTags{Title: "Song", Artist: "Band", Album: "Record", Duration: 241.5},
+		},
+		{
+			name: "upper case stream tags",
+			out:  `{"streams":[{"tags":{"TITLE":"Song","ALBUM_ARTIST":"Band"}}],"format":{"duration":"60"}}`,
+			want: localTags{Title: "Song", Artist: "Band", Duration: 60},
+		},
+		{
+			name: "untagged",
+			out:  `{"format":{"duration":"N/A"}}`,
+			want: localTags{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseFFprobeTags([]byte(tt.out))
+			if err != nil {
+				t.Fatalf("parseFFprobeTags failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("tags = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeLocalLibraryConfig(t *testing.T) {
+	cfg, err := normalizeLocalLibraryConfig(localLibraryConfig{Enabled: true, Dirs: []string{"/srv/music/", "/srv/music"}})
+	if err != nil {
+		t.Fatalf("normalizeLocalLibraryConfig failed: %v", err)
+	}
+	if len(cfg.Dirs) != 1 || cfg.Dirs[0] != "/srv/music" || cfg.RescanMinutes != defaultLocalRescanMinutes {
+		t.Errorf("cfg = %+v", cfg)
+	}
+
+	invalid := []localLibraryConfig{
+		{Enabled: true},
+		{Enabled: true, Dirs: []string{"music"}},
+		{Enabled: true, Dirs: []string{"/srv/music"}, RescanMinutes: -1},
+	}
+	for _, cfg := range invalid {
+		if _, err := normalizeLocalLibraryConfig(cfg); err == nil {
+			t.Errorf("normalizeLocalLibraryConfig(%+v) should fail", cfg)
+		}
+	}
+}
+
+type fakeProbe struct {
+	mu    sync.Mutex
+	paths []string
+}
+
+func (p *fakeProbe) probe(ctx context.Context, path string) (localTags, error) {
+	p.mu.Lock()
+	p.paths = append(p.paths, path)
+	p.mu.Unlock()
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	title, artist, _ := strings.Cut(name, " - ")
+	return localTags{Title: title, Artist: artist, Duration: 180}, nil
+}
+
+func (p *fakeProbe) probed() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := len(p.paths)
+	p.paths = nil
+	return n
+}
+
+func newTestLocalSource(t *testing.T, dir, indexPath string) (*localSource, *fakeProbe) {
+	t.Helper()
+	cfg, err := normalizeLocalLibraryConfig(localLibraryConfig{Enabled: true, Dirs: []string{dir}})
+	if err != nil {
+		t.Fatalf("normalizeLocalLibraryConfig failed: %v", err)
+	}
+	probe := &fakeProbe{}
+	src := newLocalSource(cfg, indexPath, "ffprobe")
+	src.logger = slog.New(slog.DiscardHandler)
+	src.probe = probe.probe
+	return src, probe
+}
+
+func writeTestFile(t *testing.T, path string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("audio"), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+}
+
+func TestLocalScanAndSearch(t *testing.T) {
+	dir := t.TempDir()
+	indexPath := filepath.Join(t.TempDir(), "local_library.json")
+	writeTestFile(t, filepath.Join(dir, "Band", "Song - Band.flac"))
+	writeTestFile(t, filepath.Join(dir, "Band", "Other Song - Band.mp3"))
+	writeTestFile(t, filepath.Join(dir, "Band", "Song Band Cover - Someone.ogg"))
+	writeTestFile(t, filepath.Join(dir, "Band", "cover.jpg"))
+	writeTestFile(t, filepath.Join(dir, ".trash", "Song - Band.flac"))
+
+	src, probe := newTestLocalSource(t, dir, indexPath)
+	if err := src.scan(context.Background()); err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	if n := probe.probed(); n != 3 {
+		t.Fatalf("probed = %d, want the 3 audio files", n)
+	}
+
+	tracks, err := src.Search(context.Background(), "song band", 5)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	var titles []string
+	for _, track := range tracks {
+		titles = append(titles, track.Title)
+	}
+	if got := strings.Join(titles, ","); got != "Song Band Cover,Other Song,Song" {
+		t.Errorf("titles = %s, want title matches first", got)
+	}
+	if tracks[0].Source != SourceLocal || !strings.HasPrefix(tracks[0].WebpageURL, LocalURIScheme+":///") || tracks[0].URL != "" {
+		t.Errorf("track = %+v, want an opaque local URI", tracks[0])
+	}
+
+	// Only new and changed files are probed again, and removed ones drop out.
+	changed := filepath.Join(dir, "Band", "Song - Band.flac")
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(changed, later, later); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+	if err := os.Remove(filepath.Join(dir, "Band", "Other Song - Band.mp3")); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	writeTestFile(t, filepath.Join(dir, "New - Band.opus"))
+	if err := src.scan(context.Background()); err != nil {
+		t.Fatalf("rescan failed: %v", err)
+	}
+	if n := probe.probed(); n != 2 {
+		t.Errorf("probed = %d, want the changed and the new file", n)
+	}
+	if tracks, _ := src.Search(context.Background(), "other", 5); len(tracks) != 0 {
+		t.Errorf("removed file still found: %+v", tracks)
+	}
+
+	// A restart searches the saved index before its first scan.
+	restarted, probe := newTestLocalSource(t, dir, indexPath)
+	if err := restarted.loadIndex(); err != nil {
+		t.Fatalf("loadIndex failed: %v", err)
+	}
+	if tracks, _ := restarted.Search(context.Background(), "new", 5); len(tracks) != 1 {
+		t.Errorf("saved index tracks = %+v, want the new file", tracks)
+	}
+	if err := restarted.scan(context.Background()); err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	if n := probe.probed(); n != 0 {
+		t.Errorf("probed = %d after restart, want none", n)
+	}
+}
+
+func TestLocalResolve(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Song - Band.flac")
+	writeTestFile(t, path)
+
+	src, _ := newTestLocalSource(t, dir, filepath.Join(t.TempDir(), "index.json"))
+	if err := src.scan(context.Background()); err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+
+	tracks, err := src.Resolve(context.Background(), BuildLocalURI(path))
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if len(tracks) != 1 || tracks[0].URL != path || tracks[0].Title != "Song" || tracks[0].Artist != "Band" {
+		t.Errorf("tracks = %+v, want the file to play from disk", tracks)
+	}
+
+	outside := filepath.Join(t.TempDir(), "elsewhere.flac")
+	writeTestFile(t, outside)
+	if _, err := src.Resolve(context.Background(), BuildLocalURI(outside)); err == nil {
+		t.Error("Resolve should refuse files outside the library")
+	}
+
+	os.Remove(path)
+	if _, err := src.Resolve(context.Background(), BuildLocalURI(path)); err == nil {
+		t.Error("Resolve should fail for a file that is gone")
+	}
+}
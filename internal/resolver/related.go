@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/reuski/skaldi/internal/bootstrap"
+)
+
+// Related finds up to limit tracks in the spirit of seed, from the source
+// the seed came from: the YouTube mix playlist for YouTube and YouTube Music
+// tracks, and getSimilarSongs2 for OpenSubsonic tracks. The seed itself is
+// never returned.
+func (r *Resolver) Related(ctx context.Context, seed Track, limit int) ([]Track, error) {
+	if src, ok := r.sourceForTrack(seed); ok {
+		if related, ok := src.(RelatedSource); ok {
+			return related.Related(ctx, seed, limit)
+		}
+	}
+	return nil, fmt.Errorf("no related tracks for source %q", seed.Source)
+}
+
+func relatedFromMix(ctx context.Context, cfg *bootstrap.Config, seed Track, limit int) ([]Track, error) {
+	videoID := youtubeVideoID(seed)
+	if videoID == "" {
+		return nil, fmt.Errorf("no video id for %q", seed.Title)
+	}
+
+	mixURL := "https://www.youtube.com/watch?v=" + url.QueryEscape(videoID) + "&list=RD" + url.QueryEscape(videoID)
+	// The mix starts with the seed, so ask for one extra entry.
+	args := []string{"--dump-json", "--flat-playlist", "--no-download", "--no-warnings",
+		"--playlist-end", strconv.Itoa(limit + 1), mixURL}
+
+	cmd := exec.CommandContext(ctx, cfg.ShimPath(), args...)
+	start := time.Now()
+	out, err := cmd.Output()
+	observeYtDlp(ctx, "related", start, err != nil)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("yt-dlp failed: %w", err)
+	}
+
+	tracks, err := parseLines(out)
+	if err != nil {
+		return nil, err
+	}
+
+	related := make([]Track, 0, len(tracks))
+	for _, track := range tracks {
+		if track.ID == videoID || track.WebpageURL == "" {
+			continue
+		}
+		track.Source = seed.Source
+		related = append(related, track)
+	}
+	return trimTracks(related, limit), nil
+}
+
+// youtubeVideoID prefers the stored ID and falls back to parsing watch and
+// youtu.be URLs.
+func youtubeVideoID(track Track) string {
+	if track.ID != "" {
+		return track.ID
+	}
+
+	u, err := url.Parse(track.WebpageURL)
+	if err != nil {
+		return ""
+	}
+	if strings.TrimPrefix(u.Hostname(), "www.") == "youtu.be" {
+		return strings.Trim(u.Path, "/")
+	}
+	return u.Query().Get("v")
+}
@@ -0,0 +1,44 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package resolver
+
+import (
+	"context"
+	"testing"
+)
+
+func TestYoutubeVideoID(t *testing.T) {
+	tests := []struct {
+		name  string
+		track Track
+		want  string
+	}{
+		{name: "stored id", track: Track{ID: "abc", WebpageURL: "https://www.youtube.com/watch?v=xyz"}, want: "abc"},
+		{name: "watch url", track: Track{WebpageURL: "https://www.youtube.com/watch?v=xyz&t=30"}, want: "xyz"},
+		{name: "music url", track: Track{WebpageURL: "https://music.youtube.com/watch?v=xyz"}, want: "xyz"},
+		{name: "short url", track: Track{WebpageURL: "https://youtu.be/xyz"}, want: "xyz"},
+		{name: "no id", track: Track{WebpageURL: "https://example.com/a.mp3"}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := youtubeVideoID(tt.track); got != tt.want {
+				t.Errorf("youtubeVideoID = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRelated_UnsupportedSeed(t *testing.T) {
+	r, err := New(nil)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	if _, err := r.Related(context.Background(), Track{Title: "upload.mp3"}, 3); err == nil {
+		t.Error("Related should fail for a track without a source")
+	}
+	if _, err := r.Related(context.Background(), Track{Source: SourceSubsonic, WebpageURL: BuildSubsonicURI("lib", "1")}, 3); err == nil {
+		t.Error("Related should fail when OpenSubsonic is not configured")
+	}
+}
@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/reuski/skaldi/internal/bootstrap"
+)
+
+// soundCloudSource searches SoundCloud tracks with yt-dlp's scsearch. The
+// same songs are often on YouTube, so hits YouTube search also found are
+// merged into those.
+type soundCloudSource struct {
+	cfg *bootstrap.Config
+}
+
+func (s *soundCloudSource) Name() string { return SourceSoundCloud }
+
+func (s *soundCloudSource) Options() SourceOptions {
+	return SourceOptions{
+		Bucket:        SearchBucketSoundCloud,
+		MinQueryRunes: minRemoteQueryRunes,
+		MergeInto:     SourceYouTube,
+		CacheTTL:      soundCloudCacheTTL,
+		SearchTimeout: soundCloudSearchTimeout,
+		DiskCacheTTL:  soundCloudDiskCacheTTL,
+	}
+}
+
+func (s *soundCloudSource) Search(ctx context.Context, query string, limit int) ([]Track, error) {
+	searchKey := fmt.Sprintf("scsearch%d:%s", limit, query)
+	args := []string{"--dump-json", "--flat-playlist", "--no-download", "--no-warnings", searchKey}
+
+	cmd := exec.CommandContext(ctx, s.cfg.ShimPath(), args...)
+	start := time.Now()
+	out, err := cmd.Output()
+	observeYtDlp(ctx, string(SearchBucketSoundCloud), start, err != nil)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("yt-dlp failed: %w", err)
+	}
+
+	tracks, err := parseLines(out)
+	if err != nil {
+		if isNoTracksError(err) {
+			return []Track{}, nil
+		}
+		return nil, err
+	}
+	return rankTracks(query, dedupeTracks(withSource(tracks, SourceSoundCloud), limit), limit), nil
+}
+
+func (s *soundCloudSource) Resolve(ctx context.Context, rawURL string) ([]Track, error) {
+	tracks, err := resolveWithYtDlp(ctx, s.cfg, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return withSource(tracks, SourceSoundCloud), nil
+}
@@ -0,0 +1,347 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Source is somewhere tracks can be searched for and queued from. The
+// resolver fans searches out to every registered source and hands queue URLs
+// with a source's scheme to that source.
+type Source interface {
+	// Name is stored as Track.Source and SearchHit.Source.
+	Name() string
+	Options() SourceOptions
+	// Search returns up to limit tracks for a normalized query, best first.
+	Search(ctx context.Context, query string, limit int) ([]Track, error)
+	// Resolve turns a queue URL from one of the source's hits into playable
+	// tracks.
+	Resolve(ctx context.Context, rawURL string) ([]Track, error)
+}
+
+// RelatedSource is a Source that can suggest tracks for autoplay.
+type RelatedSource interface {
+	Source
+	Related(ctx context.Context, seed Track, limit int) ([]Track, error)
+}
+
+// BrowseSource is a Source whose hits can be opened to list what they hold,
+// such as an artist's albums or an album's tracks.
+type BrowseSource interface {
+	Source
+	// BrowseRoots are the places to start browsing without a search.
+	BrowseRoots() []Track
+	Browse(ctx context.Context, rawURL string) (Listing, error)
+}
+
+type Listing struct {
+	Title  string
+	Artist string
+	Tracks []Track
+}
+
+// BrowseResult is a Listing as sent to clients.
+type BrowseResult struct {
+	Title  string      `json:"title"`
+	Artist string      `json:"artist,omitempty"`
+	Hits   []SearchHit `json:"hits"`
+}
+
+// ScrobbleSource is a Source that keeps play counts, such as an OpenSubsonic
+// server.
+type ScrobbleSource interface {
+	Source
+	// Scrobble reports a play of track that started at playedAt. Without
+	// submission it only marks the track as now playing.
+	Scrobble(ctx context.Context, track Track, playedAt time.Time, submission bool) error
+}
+
+// BackgroundSource is a Source with work to do while Skaldi runs, such as
+// keeping an index up to date.
+type BackgroundSource interface {
+	Source
+	Run(ctx context.Context, logger *slog.Logger)
+}
+
+// URLOwner is a Source that shares its scheme with others, such as one of
+// several OpenSubsonic libraries, and claims only its own URLs.
+type URLOwner interface {
+	Source
+	OwnsURL(rawURL string) bool
+}
+
+type SourceOptions struct {
+	// Bucket is the search batch bucket the source's hits are streamed in.
+	// It identifies the source, as several sources may share a name.
+	Bucket SearchBucket
+	// Label is shown above the bucket's hits in place of the UI's own name
+	// for it.
+	Label string
+	// Scheme is the URI scheme of the opaque queue URLs the source hands
+	// out. It must start with sourceSchemePrefix, as skaldi+subsonic does.
+	// Hits without one are queued by their page URL, which mpv plays
+	// through yt-dlp.
+	Scheme string
+	// Typeahead searches the source while a query is still being typed.
+	Typeahead bool
+	// MinQueryRunes skips the source for shorter queries.
+	MinQueryRunes int
+	// MergeInto names a source whose results absorb this source's tracks
+	// with the same ID, filling in missing metadata.
+	MergeInto     string
+	CacheTTL      time.Duration
+	SearchTimeout time.Duration
+	// DiskCacheTTL keeps the source's results in the persistent cache, when
+	// one is configured, for this long before they are refreshed.
+	DiskCacheTTL time.Duration
+}
+
+type registeredSource struct {
+	Source
+	opts  SourceOptions
+	cache *searchCache[[]Track]
+}
+
+// Register adds a source to every later search. Sources are searched and
+// listed in the order they were registered; registering a bucket again
+// replaces the earlier source.
+func (r *Resolver) Register(src Source) {
+	opts := src.Options()
+	reg := &registeredSource{
+		Source: src,
+		opts:   opts,
+		cache:  newSearchCache[[]Track](opts.Bucket, opts.CacheTTL, searchCacheLimit),
+	}
+
+	r.sourcesMu.Lock()
+	defer r.sourcesMu.Unlock()
+	for i, existing := range r.sources {
+		if existing.opts.Bucket == opts.Bucket {
+			r.sources[i] = reg
+			return
+		}
+	}
+	r.sources = append(r.sources, reg)
+}
+
+func (r *Resolver) registered() []*registeredSource {
+	r.sourcesMu.RLock()
+	defer r.sourcesMu.RUnlock()
+	return append([]*registeredSource(nil), r.sources...)
+}
+
+// source returns the first source registered under name.
+func (r *Resolver) source(name string) (*registeredSource, bool) {
+	for _, src := range r.registered() {
+		if src.Name() == name {
+			return src, true
+		}
+	}
+	return nil, false
+}
+
+const sourceSchemePrefix = "skaldi+"
+
+var ErrNotBrowsable = errors.New("nothing to browse")
+
+var ErrNotScrobbled = errors.New("source does not keep play counts")
+
+// IsSourceURL reports whether rawURL is an opaque queue URL handed out by a
+// source, whether or not that source is still configured.
+func IsSourceURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && strings.HasPrefix(u.Scheme, sourceSchemePrefix)
+}
+
+// SourceForURL returns the source whose scheme rawURL uses. Such URLs are
+// opaque references that only their source can turn into a stream.
+func (r *Resolver) SourceForURL(rawURL string) (Source, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "" {
+		return nil, false
+	}
+	for _, src := range r.registered() {
+		if src.opts.Scheme == "" || src.opts.Scheme != u.Scheme {
+			continue
+		}
+		if owner, ok := src.Source.(URLOwner); ok && !owner.OwnsURL(rawURL) {
+			continue
+		}
+		return src.Source, true
+	}
+	return nil, false
+}
+
+// sourceForTrack returns the source a track came from: the owner of its
+// page URL when that is opaque, or else the first source of its name.
+func (r *Resolver) sourceForTrack(track Track) (Source, bool) {
+	if src, ok := r.SourceForURL(track.WebpageURL); ok {
+		return src, src.Name() == track.Source
+	}
+	src, ok := r.source(track.Source)
+	if !ok {
+		return nil, false
+	}
+	return src.Source, true
+}
+
+// HasRelated reports whether autoplay can find tracks related to ones from
+// the named source.
+func (r *Resolver) HasRelated(name string) bool {
+	src, ok := r.source(name)
+	if !ok {
+		return false
+	}
+	_, ok = src.Source.(RelatedSource)
+	return ok
+}
+
+// Start runs the background work of every registered source, and the
+// persistent cache's eviction, until ctx is done.
+func (r *Resolver) Start(ctx context.Context, logger *slog.Logger) {
+	if r.disk != nil {
+		go r.disk.Run(ctx, logger)
+	}
+	for _, src := range r.registered() {
+		if bg, ok := src.Source.(BackgroundSource); ok {
+			go bg.Run(ctx, logger)
+		}
+	}
+}
+
+// CanScrobble reports whether plays of track are reported to its source.
+func (r *Resolver) CanScrobble(track Track) bool {
+	src, ok := r.sourceForTrack(track)
+	if !ok {
+		return false
+	}
+	_, ok = src.(ScrobbleSource)
+	return ok
+}
+
+// ScrobbleTarget names the source plays of track are reported to, so that
+// plays for one library can be retried apart from the others.
+func (r *Resolver) ScrobbleTarget(track Track) string {
+	if src, ok := r.sourceForTrack(track); ok {
+		return string(src.Options().Bucket)
+	}
+	return track.Source
+}
+
+// Scrobble reports a play of track to the source it came from. It fails with
+// ErrNotScrobbled when that source is gone or keeps no play counts.
+func (r *Resolver) Scrobble(ctx context.Context, track Track, playedAt time.Time, submission bool) error {
+	if src, ok := r.sourceForTrack(track); ok {
+		if scrobbler, ok := src.(ScrobbleSource); ok {
+			return scrobbler.Scrobble(ctx, track, playedAt, submission)
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrNotScrobbled, track.Source)
+}
+
+// ResolveHit turns a search hit back into tracks to queue. Hits with an
+// opaque queue URL are resolved by their source; the rest are queued as
+// described by the hit.
+func (r *Resolver) ResolveHit(ctx context.Context, hit SearchHit) ([]Track, error) {
+	if hit.QueueURL == "" {
+		return nil, fmt.Errorf("queue_url is required")
+	}
+	if src, ok := r.SourceForURL(hit.QueueURL); ok {
+		if src.Name() != hit.Source {
+			return nil, fmt.Errorf("queue_url does not belong to source %s", hit.Source)
+		}
+		return src.Resolve(ctx, hit.QueueURL)
+	}
+	if _, ok := r.source(hit.Source); !ok {
+		return nil, fmt.Errorf("unsupported search hit source: %s", hit.Source)
+	}
+
+	webpageURL := hit.WebpageURL
+	if webpageURL == "" {
+		webpageURL = hit.QueueURL
+	}
+	return []Track{{
+		ID:         hit.ID,
+		Title:      hit.Title,
+		Artist:     hit.Artist,
+		Duration:   hit.Duration,
+		Uploader:   hit.Artist,
+		Thumbnail:  hit.Thumbnail,
+		URL:        hit.QueueURL,
+		WebpageURL: webpageURL,
+		Source:     hit.Source,
+	}}, nil
+}
+
+// Browse lists what rawURL holds, asking the source that owns it. An empty
+// rawURL lists every source's roots.
+func (r *Resolver) Browse(ctx context.Context, rawURL string) (BrowseResult, error) {
+	if rawURL == "" {
+		var roots []Track
+		for _, src := range r.registered() {
+			if browser, ok := src.Source.(BrowseSource); ok {
+				roots = append(roots, withSource(browser.BrowseRoots(), src.Name())...)
+			}
+		}
+		return BrowseResult{Title: "Browse", Hits: searchHitsFromTracks(roots)}, nil
+	}
+
+	src, ok := r.SourceForURL(rawURL)
+	if !ok {
+		return BrowseResult{}, fmt.Errorf("%w: %s", ErrNotBrowsable, rawURL)
+	}
+	browser, ok := src.(BrowseSource)
+	if !ok {
+		return BrowseResult{}, fmt.Errorf("%w: %s", ErrNotBrowsable, rawURL)
+	}
+	listing, err := browser.Browse(ctx, rawURL)
+	if err != nil {
+		return BrowseResult{}, err
+	}
+	return BrowseResult{
+		Title:  listing.Title,
+		Artist: listing.Artist,
+		Hits:   searchHitsFromTracks(withSource(listing.Tracks, src.Name())),
+	}, nil
+}
+
+func withSource(tracks []Track, name string) []Track {
+	for i := range tracks {
+		tracks[i].Source = name
+	}
+	return tracks
+}
+
+// searchSource runs one source's search through its cache, and through the
+// persistent cache when the source uses it. Queries shorter than the
+// source's minimum return no tracks without asking it.
+func (r *Resolver) searchSource(ctx context.Context, src *registeredSource, query string) ([]Track, error) {
+	if utf8.RuneCountInString(query) < src.opts.MinQueryRunes {
+		return []Track{}, nil
+	}
+	load := func(ctx context.Context) ([]Track, error) {
+		if src.opts.SearchTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, src.opts.SearchTimeout)
+			defer cancel()
+		}
+		tracks, err := src.Search(ctx, query, providerSearchLimit)
+		if err != nil {
+			return nil, err
+		}
+		return dedupeTracks(withSource(tracks, src.Name()), providerSearchLimit), nil
+	}
+	return src.cache.GetOrLoad(ctx, query, func(ctx context.Context) ([]Track, error) {
+		return cachedLoad(ctx, r.disk, string(src.opts.Bucket), query, src.opts.DiskCacheTTL, load, func(tracks []Track) {
+			src.cache.Set(query, tracks)
+		})
+	})
+}
@@ -0,0 +1,213 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package resolver
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeSource struct {
+	opts   SourceOptions
+	tracks []Track
+}
+
+func (s *fakeSource) Name() string { return "fake" }
+
+func (s *fakeSource) Options() SourceOptions { return s.opts }
+
+func (s *fakeSource) Search(ctx context.Context, query string, limit int) ([]Track, error) {
+	return s.tracks, nil
+}
+
+func (s *fakeSource) Resolve(ctx context.Context, rawURL string) ([]Track, error) {
+	id := strings.TrimPrefix(rawURL, "skaldi+fake://")
+	return []Track{{ID: id, URL: "https://fake.example/stream/" + id, WebpageURL: rawURL, Source: "fake"}}, nil
+}
+
+func TestRegisteredSourceSearch(t *testing.T) {
+	r := newTestResolver(t)
+	r.Register(&fakeSource{
+		opts: SourceOptions{Bucket: "fake", Scheme: "skaldi+fake", Typeahead: true},
+		tracks: []Track{
+			{ID: "1", Title: "Fake Song", WebpageURL: "skaldi+fake://1"},
+			{ID: "1", Title: "Fake Song", WebpageURL: "skaldi+fake://1"},
+		},
+	})
+
+	for _, intent := range []SearchIntent{SearchIntentTypeahead, SearchIntentResults} {
+		resultCh, err := r.Search(context.Background(), "fake song", intent)
+		if err != nil {
+			t.Fatalf("Search(%s) failed: %v", intent, err)
+		}
+		batch := lastBatchForBucket(collectSearchBatches(t, resultCh), "fake")
+		if !batch.Complete {
+			t.Fatalf("%s: fake batch should be complete", intent)
+		}
+		if len(batch.Hits) != 1 {
+			t.Fatalf("%s: fake hits = %d, want 1", intent, len(batch.Hits))
+		}
+		if batch.Hits[0].Source != "fake" {
+			t.Errorf("%s: source = %q, want fake", intent, batch.Hits[0].Source)
+		}
+	}
+}
+
+func TestRegisterReplacesSource(t *testing.T) {
+	r := newTestResolver(t)
+	before := len(r.registered())
+	r.Register(&fakeSource{opts: SourceOptions{Bucket: "fake"}})
+	r.Register(&fakeSource{opts: SourceOptions{Bucket: "fake", Scheme: "skaldi+fake"}})
+
+	if got := len(r.registered()); got != before+1 {
+		t.Fatalf("registered sources = %d, want %d", got, before+1)
+	}
+	if _, ok := r.SourceForURL("skaldi+fake://1"); !ok {
+		t.Fatal("SourceForURL should find the replacement source")
+	}
+}
+
+func TestSourceForURL(t *testing.T) {
+	r := newTestResolver(t)
+	r.Register(&fakeSource{opts: SourceOptions{Bucket: "fake", Scheme: "skaldi+fake"}})
+
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"skaldi+fake://1", true},
+		{"skaldi+subsonic://personal/1", false},
+		{"https://www.youtube.com/watch?v=1", false},
+		{"/tmp/upload.mp3", false},
+	}
+	for _, tt := range tests {
+		if _, ok := r.SourceForURL(tt.url); ok != tt.want {
+			t.Errorf("SourceForURL(%q) = %v, want %v", tt.url, ok, tt.want)
+		}
+	}
+}
+
+func TestResolveHit(t *testing.T) {
+	r := newTestResolver(t)
+	r.Register(&fakeSource{opts: SourceOptions{Bucket: "fake", Scheme: "skaldi+fake"}})
+
+	hit := SearchHit{
+		ID:         "vid-1",
+		Source:     SourceYouTube,
+		Title:      "Song",
+		Artist:     "Artist",
+		Duration:   123,
+		Thumbnail:  "https://img.example/vid-1.jpg",
+		WebpageURL: "https://www.youtube.com/watch?v=vid-1",
+		QueueURL:   "https://www.youtube.com/watch?v=vid-1",
+	}
+	tracks, err := r.ResolveHit(context.Background(), hit)
+	if err != nil {
+		t.Fatalf("ResolveHit failed: %v", err)
+	}
+	if len(tracks) != 1 {
+		t.Fatalf("len(tracks) = %d, want 1", len(tracks))
+	}
+	if tracks[0].Source != SourceYouTube || tracks[0].WebpageURL != hit.WebpageURL || tracks[0].Uploader != hit.Artist {
+		t.Errorf("track = %+v, want it built from the hit", tracks[0])
+	}
+
+	tracks, err = r.ResolveHit(context.Background(), SearchHit{Source: "fake", QueueURL: "skaldi+fake://7"})
+	if err != nil {
+		t.Fatalf("ResolveHit(fake) failed: %v", err)
+	}
+	if len(tracks) != 1 || tracks[0].URL != "https://fake.example/stream/7" {
+		t.Errorf("tracks = %+v, want the source's stream", tracks)
+	}
+
+	invalid := []SearchHit{
+		{Source: SourceYouTube},
+		{Source: "unsupported", QueueURL: "https://example.com"},
+		{Source: SourceYouTube, QueueURL: "skaldi+fake://7"},
+	}
+	for _, hit := range invalid {
+		if _, err := r.ResolveHit(context.Background(), hit); err == nil {
+			t.Errorf("ResolveHit(%+v) should fail", hit)
+		}
+	}
+}
+
+func TestResolverScrobble(t *testing.T) {
+	r := newTestResolver(t)
+	r.Register(&fakeSource{opts: SourceOptions{Bucket: "fake", Scheme: "skaldi+fake"}})
+
+	tracks := []Track{
+		{Source: "fake", WebpageURL: "skaldi+fake://1"},
+		{Source: SourceYouTube, WebpageURL: "https://www.youtube.com/watch?v=1"},
+		{Source: SourceSubsonic, WebpageURL: "skaldi+subsonic://gone/1"},
+	}
+	for _, track := range tracks {
+		if r.CanScrobble(track) {
+			t.Errorf("CanScrobble(%s) = true, want false", track.WebpageURL)
+		}
+		if err := r.Scrobble(context.Background(), track, time.Now(), true); !errors.Is(err, ErrNotScrobbled) {
+			t.Errorf("Scrobble(%s) error = %v, want ErrNotScrobbled", track.WebpageURL, err)
+		}
+	}
+
+	r.Register(newTestSubsonicSource(t))
+	if !r.CanScrobble(Track{Source: SourceSubsonic, WebpageURL: "skaldi+subsonic://personal/s1"}) {
+		t.Error("CanScrobble should accept tracks from a configured library")
+	}
+}
+
+func TestIsSourceURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"skaldi+subsonic://personal/1", true},
+		{"skaldi+fake://1", true},
+		{"https://www.youtube.com/watch?v=1", false},
+		{"/tmp/upload.mp3", false},
+	}
+	for _, tt := range tests {
+		if got := IsSourceURL(tt.url); got != tt.want {
+			t.Errorf("IsSourceURL(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestResolverBrowse(t *testing.T) {
+	r := newTestResolver(t)
+	r.Register(&fakeSource{opts: SourceOptions{Bucket: "fake", Scheme: "skaldi+fake"}})
+
+	roots, err := r.Browse(context.Background(), "")
+	if err != nil {
+		t.Fatalf("Browse roots failed: %v", err)
+	}
+	if len(roots.Hits) != 0 {
+		t.Errorf("roots = %+v, want none without a browsable source", roots.Hits)
+	}
+
+	for _, rawURL := range []string{"skaldi+fake://1", "https://www.youtube.com/watch?v=1"} {
+		if _, err := r.Browse(context.Background(), rawURL); !errors.Is(err, ErrNotBrowsable) {
+			t.Errorf("Browse(%q) error = %v, want ErrNotBrowsable", rawURL, err)
+		}
+	}
+
+	r.Register(newTestSubsonicSource(t))
+	roots, err = r.Browse(context.Background(), "")
+	if err != nil {
+		t.Fatalf("Browse roots failed: %v", err)
+	}
+	if len(roots.Hits) != 1 || roots.Hits[0].Source != SourceSubsonic || roots.Hits[0].Kind != KindFolder {
+		t.Fatalf("roots = %+v, want the library's playlists", roots.Hits)
+	}
+
+	artist, err := r.Browse(context.Background(), "skaldi+subsonic://personal/artist/ar-1")
+	if err != nil {
+		t.Fatalf("Browse artist failed: %v", err)
+	}
+	if artist.Title != "The Band" || len(artist.Hits) != 2 || artist.Hits[0].QueueURL != "skaldi+subsonic://personal/album/al-1" {
+		t.Errorf("artist = %+v", artist)
+	}
+}
@@ -12,10 +12,16 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
 	"time"
 )
 
+const (
+	subsonicArtistHits = 1
+	subsonicAlbumHits  = 2
+)
+
 type SubsonicClient struct {
 	cfg        openSubsonicConfig
 	httpClient *http.Client
@@ -34,6 +40,10 @@ func (c *SubsonicClient) LibraryID() string {
 	return c.cfg.LibraryID
 }
 
+func (c *SubsonicClient) Label() string {
+	return c.cfg.Label
+}
+
 type subsonicSearchResponse struct {
 	SubsonicResponse struct {
 		Status string `json:"status"`
@@ -41,7 +51,9 @@ type subsonicSearchResponse struct {
 			Message string `json:"message"`
 		} `json:"error,omitempty"`
 		SearchResult3 struct {
-			Song []subsonicSong `json:"song"`
+			Artist []subsonicArtist `json:"artist"`
+			Album  []subsonicAlbum  `json:"album"`
+			Song   []subsonicSong   `json:"song"`
 		} `json:"searchResult3"`
 	} `json:"subsonic-response"`
 }
@@ -54,10 +66,73 @@ type subsonicGetSongResponse struct {
 	} `json:"subsonic-response"`
 }
 
+type subsonicPingResponse struct {
+	SubsonicResponse struct {
+		Status string       `json:"status"`
+		Error  *subsonicErr `json:"error,omitempty"`
+	} `json:"subsonic-response"`
+}
+
+type subsonicSimilarSongsResponse struct {
+	SubsonicResponse struct {
+		Status        string       `json:"status"`
+		Error         *subsonicErr `json:"error,omitempty"`
+		SimilarSongs2 struct {
+			Song []subsonicSong `json:"song"`
+		} `json:"similarSongs2"`
+	} `json:"subsonic-response"`
+}
+
+type subsonicArtistResponse struct {
+	SubsonicResponse struct {
+		Status string          `json:"status"`
+		Error  *subsonicErr    `json:"error,omitempty"`
+		Artist *subsonicArtist `json:"artist,omitempty"`
+	} `json:"subsonic-response"`
+}
+
+type subsonicAlbumResponse struct {
+	SubsonicResponse struct {
+		Status string         `json:"status"`
+		Error  *subsonicErr   `json:"error,omitempty"`
+		Album  *subsonicAlbum `json:"album,omitempty"`
+	} `json:"subsonic-response"`
+}
+
+type subsonicPlaylistsResponse struct {
+	SubsonicResponse struct {
+		Status    string       `json:"status"`
+		Error     *subsonicErr `json:"error,omitempty"`
+		Playlists struct {
+			Playlist []subsonicPlaylist `json:"playlist"`
+		} `json:"playlists"`
+	} `json:"subsonic-response"`
+}
+
+type subsonicPlaylistResponse struct {
+	SubsonicResponse struct {
+		Status   string            `json:"status"`
+		Error    *subsonicErr      `json:"error,omitempty"`
+		Playlist *subsonicPlaylist `json:"playlist,omitempty"`
+	} `json:"subsonic-response"`
+}
+
 type subsonicErr struct {
 	Message string `json:"message"`
 }
 
+// subsonicStatusErr turns a failed response into an error, using fallback
+// when the server gave no message.
+func subsonicStatusErr(status string, e *subsonicErr, fallback string) error {
+	if status == "ok" {
+		return nil
+	}
+	if e != nil && e.Message != "" {
+		return fmt.Errorf("opensubsonic: %s", e.Message)
+	}
+	return fmt.Errorf("opensubsonic: %s", fallback)
+}
+
 type subsonicSong struct {
 	ID       string `json:"id"`
 	Title    string `json:"title"`
@@ -65,6 +140,28 @@ type subsonicSong struct {
 	Duration int    `json:"duration"`
 }
 
+type subsonicAlbum struct {
+	ID       string         `json:"id"`
+	Name     string         `json:"name"`
+	Artist   string         `json:"artist"`
+	Duration int            `json:"duration"`
+	Song     []subsonicSong `json:"song"`
+}
+
+type subsonicArtist struct {
+	ID    string          `json:"id"`
+	Name  string          `json:"name"`
+	Album []subsonicAlbum `json:"album"`
+}
+
+type subsonicPlaylist struct {
+	ID       string         `json:"id"`
+	Name     string         `json:"name"`
+	Owner    string         `json:"owner"`
+	Duration int            `json:"duration"`
+	Entry    []subsonicSong `json:"entry"`
+}
+
 func (c *SubsonicClient) Search(ctx context.Context, query string, limit int) ([]Track, error) {
 	if limit <= 0 {
 		limit = 5
@@ -75,8 +172,8 @@ func (c *SubsonicClient) Search(ctx context.Context, query string, limit int) ([
 		return nil, err
 	}
 	params.Set("query", query)
-	params.Set("artistCount", "0")
-	params.Set("albumCount", "0")
+	params.Set("artistCount", strconv.Itoa(subsonicArtistHits))
+	params.Set("albumCount", strconv.Itoa(subsonicAlbumHits))
 	params.Set("songCount", strconv.Itoa(limit))
 	params.Set("songOffset", "0")
 
@@ -92,11 +189,100 @@ func (c *SubsonicClient) Search(ctx context.Context, query string, limit int) ([
 		return nil, fmt.Errorf("opensubsonic: %s", msg)
 	}
 
-	tracks := make([]Track, 0, len(resp.SubsonicResponse.SearchResult3.Song))
-	for _, song := range resp.SubsonicResponse.SearchResult3.Song {
+	// The best song comes first, then the artists and albums, so that a
+	// short typeahead list still shows some of each.
+	result := resp.SubsonicResponse.SearchResult3
+	tracks := make([]Track, 0, len(result.Song)+len(result.Album)+len(result.Artist))
+	for _, song := range result.Song {
 		tracks = append(tracks, c.songToTrack(song))
 	}
-	return tracks, nil
+	collections := make([]Track, 0, len(result.Artist)+len(result.Album))
+	for _, artist := range result.Artist {
+		collections = append(collections, c.artistToTrack(artist))
+	}
+	for _, album := range result.Album {
+		collections = append(collections, c.albumToTrack(album))
+	}
+	at := min(1, len(tracks))
+	return slices.Insert(tracks, at, collections...), nil
+}
+
+func (c *SubsonicClient) GetArtist(ctx context.Context, artistID string) (subsonicArtist, error) {
+	params, err := c.authParams()
+	if err != nil {
+		return subsonicArtist{}, err
+	}
+	params.Set("id", artistID)
+
+	var resp subsonicArtistResponse
+	if err := c.getJSON(ctx, "getArtist.view", params, &resp); err != nil {
+		return subsonicArtist{}, err
+	}
+	if err := subsonicStatusErr(resp.SubsonicResponse.Status, resp.SubsonicResponse.Error, "getArtist failed"); err != nil {
+		return subsonicArtist{}, err
+	}
+	if resp.SubsonicResponse.Artist == nil {
+		return subsonicArtist{}, fmt.Errorf("opensubsonic: artist not found")
+	}
+	return *resp.SubsonicResponse.Artist, nil
+}
+
+// GetAlbum returns an album with its songs in track order.
+func (c *SubsonicClient) GetAlbum(ctx context.Context, albumID string) (subsonicAlbum, error) {
+	params, err := c.authParams()
+	if err != nil {
+		return subsonicAlbum{}, err
+	}
+	params.Set("id", albumID)
+
+	var resp subsonicAlbumResponse
+	if err := c.getJSON(ctx, "getAlbum.view", params, &resp); err != nil {
+		return subsonicAlbum{}, err
+	}
+	if err := subsonicStatusErr(resp.SubsonicResponse.Status, resp.SubsonicResponse.Error, "getAlbum failed"); err != nil {
+		return subsonicAlbum{}, err
+	}
+	if resp.SubsonicResponse.Album == nil {
+		return subsonicAlbum{}, fmt.Errorf("opensubsonic: album not found")
+	}
+	return *resp.SubsonicResponse.Album, nil
+}
+
+// GetPlaylists lists the playlists the user can see, without their songs.
+func (c *SubsonicClient) GetPlaylists(ctx context.Context) ([]subsonicPlaylist, error) {
+	params, err := c.authParams()
+	if err != nil {
+		return nil, err
+	}
+
+	var resp subsonicPlaylistsResponse
+	if err := c.getJSON(ctx, "getPlaylists.view", params, &resp); err != nil {
+		return nil, err
+	}
+	if err := subsonicStatusErr(resp.SubsonicResponse.Status, resp.SubsonicResponse.Error, "getPlaylists failed"); err != nil {
+		return nil, err
+	}
+	return resp.SubsonicResponse.Playlists.Playlist, nil
+}
+
+func (c *SubsonicClient) GetPlaylist(ctx context.Context, playlistID string) (subsonicPlaylist, error) {
+	params, err := c.authParams()
+	if err != nil {
+		return subsonicPlaylist{}, err
+	}
+	params.Set("id", playlistID)
+
+	var resp subsonicPlaylistResponse
+	if err := c.getJSON(ctx, "getPlaylist.view", params, &resp); err != nil {
+		return subsonicPlaylist{}, err
+	}
+	if err := subsonicStatusErr(resp.SubsonicResponse.Status, resp.SubsonicResponse.Error, "getPlaylist failed"); err != nil {
+		return subsonicPlaylist{}, err
+	}
+	if resp.SubsonicResponse.Playlist == nil {
+		return subsonicPlaylist{}, fmt.Errorf("opensubsonic: playlist not found")
+	}
+	return *resp.SubsonicResponse.Playlist, nil
 }
 
 func (c *SubsonicClient) GetTrack(ctx context.Context, trackID string) (Track, error) {
@@ -124,6 +310,76 @@ func (c *SubsonicClient) GetTrack(ctx context.Context, trackID string) (Track, e
 	return c.songToTrack(*resp.SubsonicResponse.Song), nil
 }
 
+// SimilarSongs returns tracks the server considers similar to trackID, usually
+// from the same and related artists.
+func (c *SubsonicClient) SimilarSongs(ctx context.Context, trackID string, limit int) ([]Track, error) {
+	params, err := c.authParams()
+	if err != nil {
+		return nil, err
+	}
+	params.Set("id", trackID)
+	params.Set("count", strconv.Itoa(limit))
+
+	var resp subsonicSimilarSongsResponse
+	if err := c.getJSON(ctx, "getSimilarSongs2.view", params, &resp); err != nil {
+		return nil, err
+	}
+	if resp.SubsonicResponse.Status != "ok" {
+		msg := "getSimilarSongs2 failed"
+		if resp.SubsonicResponse.Error != nil && resp.SubsonicResponse.Error.Message != "" {
+			msg = resp.SubsonicResponse.Error.Message
+		}
+		return nil, fmt.Errorf("opensubsonic: %s", msg)
+	}
+
+	tracks := make([]Track, 0, len(resp.SubsonicResponse.SimilarSongs2.Song))
+	for _, song := range resp.SubsonicResponse.SimilarSongs2.Song {
+		if song.ID == trackID {
+			continue
+		}
+		tracks = append(tracks, c.songToTrack(song))
+	}
+	return tracks, nil
+}
+
+func (c *SubsonicClient) Ping(ctx context.Context) error {
+	params, err := c.authParams()
+	if err != nil {
+		return err
+	}
+
+	var resp subsonicPingResponse
+	if err := c.getJSON(ctx, "ping.view", params, &resp); err != nil {
+		return err
+	}
+	if resp.SubsonicResponse.Status != "ok" {
+		msg := "ping failed"
+		if resp.SubsonicResponse.Error != nil && resp.SubsonicResponse.Error.Message != "" {
+			msg = resp.SubsonicResponse.Error.Message
+		}
+		return fmt.Errorf("opensubsonic: %s", msg)
+	}
+	return nil
+}
+
+// Scrobble reports a play of trackID that started at playedAt. Without
+// submission it only marks the track as now playing.
+func (c *SubsonicClient) Scrobble(ctx context.Context, trackID string, playedAt time.Time, submission bool) error {
+	params, err := c.authParams()
+	if err != nil {
+		return err
+	}
+	params.Set("id", trackID)
+	params.Set("time", strconv.FormatInt(playedAt.UnixMilli(), 10))
+	params.Set("submission", strconv.FormatBool(submission))
+
+	var resp subsonicPingResponse
+	if err := c.getJSON(ctx, "scrobble.view", params, &resp); err != nil {
+		return err
+	}
+	return subsonicStatusErr(resp.SubsonicResponse.Status, resp.SubsonicResponse.Error, "scrobble failed")
+}
+
 func (c *SubsonicClient) BuildStreamURL(trackID string) (string, error) {
 	params, err := c.authParams()
 	if err != nil {
@@ -152,6 +408,50 @@ func (c *SubsonicClient) songToTrack(song subsonicSong) Track {
 	}
 }
 
+func (c *SubsonicClient) artistToTrack(artist subsonicArtist) Track {
+	opaque := SubsonicRef{LibraryID: c.cfg.LibraryID, Kind: KindArtist, ID: artist.ID}.URI()
+	return Track{
+		ID:         artist.ID,
+		Title:      artist.Name,
+		Artist:     artist.Name,
+		Uploader:   artist.Name,
+		URL:        opaque,
+		WebpageURL: opaque,
+		Source:     SourceSubsonic,
+		Kind:       KindArtist,
+	}
+}
+
+func (c *SubsonicClient) albumToTrack(album subsonicAlbum) Track {
+	opaque := SubsonicRef{LibraryID: c.cfg.LibraryID, Kind: KindAlbum, ID: album.ID}.URI()
+	return Track{
+		ID:         album.ID,
+		Title:      album.Name,
+		Artist:     album.Artist,
+		Duration:   float64(album.Duration),
+		Uploader:   album.Artist,
+		URL:        opaque,
+		WebpageURL: opaque,
+		Source:     SourceSubsonic,
+		Kind:       KindAlbum,
+	}
+}
+
+func (c *SubsonicClient) playlistToTrack(playlist subsonicPlaylist) Track {
+	opaque := SubsonicRef{LibraryID: c.cfg.LibraryID, Kind: KindPlaylist, ID: playlist.ID}.URI()
+	return Track{
+		ID:         playlist.ID,
+		Title:      playlist.Name,
+		Artist:     playlist.Owner,
+		Duration:   float64(playlist.Duration),
+		Uploader:   playlist.Owner,
+		URL:        opaque,
+		WebpageURL: opaque,
+		Source:     SourceSubsonic,
+		Kind:       KindPlaylist,
+	}
+}
+
 func (c *SubsonicClient) getJSON(ctx context.Context, endpoint string, params url.Values, out any) error {
 	tCtx, cancel := context.WithTimeout(ctx, c.timeout)
 	defer cancel()
@@ -212,3 +512,208 @@ func randomSalt(n int) (string, error) {
 	}
 	return hex.EncodeToString(buf), nil
 }
+
+// subsonicSource searches one OpenSubsonic library. Its hits carry opaque
+// skaldi+subsonic URIs naming the library, resolved to an authenticated
+// stream URL only when a track is queued.
+type subsonicSource struct {
+	client *SubsonicClient
+}
+
+func (s *subsonicSource) Name() string { return SourceSubsonic }
+
+func (s *subsonicSource) Options() SourceOptions {
+	return SourceOptions{
+		Bucket:        ExternalBucket(s.client.LibraryID()),
+		Label:         s.client.Label(),
+		Scheme:        SubsonicURIScheme,
+		Typeahead:     true,
+		CacheTTL:      externalCacheTTL,
+		SearchTimeout: externalSearchTimeout,
+	}
+}
+
+func (s *subsonicSource) OwnsURL(rawURL string) bool {
+	ref, ok := ParseSubsonicURI(rawURL)
+	return ok && ref.LibraryID == s.client.LibraryID()
+}
+
+func (s *subsonicSource) Search(ctx context.Context, query string, limit int) ([]Track, error) {
+	return s.client.Search(ctx, query, limit)
+}
+
+// Resolve turns a track, album or playlist URI into stream URLs, keeping
+// album and playlist order. Artists can only be browsed.
+func (s *subsonicSource) Resolve(ctx context.Context, rawURL string) ([]Track, error) {
+	ref, ok := ParseSubsonicURI(rawURL)
+	if !ok {
+		return nil, fmt.Errorf("not an opensubsonic track: %s", rawURL)
+	}
+	if ref.LibraryID != s.client.LibraryID() {
+		return nil, fmt.Errorf("unknown opensubsonic library: %s", ref.LibraryID)
+	}
+
+	switch ref.Kind {
+	case KindAlbum:
+		album, err := s.client.GetAlbum(ctx, ref.ID)
+		if err != nil {
+			return nil, err
+		}
+		return s.streamTracks(album.Song)
+	case KindPlaylist:
+		if ref.ID == "" {
+			return nil, fmt.Errorf("the list of playlists cannot be queued, only browsed")
+		}
+		playlist, err := s.client.GetPlaylist(ctx, ref.ID)
+		if err != nil {
+			return nil, err
+		}
+		return s.streamTracks(playlist.Entry)
+	case KindArtist:
+		return nil, fmt.Errorf("artists cannot be queued, only browsed")
+	}
+
+	streamURL, err := s.client.BuildStreamURL(ref.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	track, err := s.client.GetTrack(ctx, ref.ID)
+	if err != nil {
+		track = Track{
+			ID:       ref.ID,
+			Title:    ref.ID,
+			Artist:   "OpenSubsonic",
+			Uploader: "OpenSubsonic",
+		}
+	}
+
+	track.URL = streamURL
+	track.WebpageURL = BuildSubsonicURI(ref.LibraryID, ref.ID)
+	track.Source = SourceSubsonic
+
+	return []Track{track}, nil
+}
+
+func (s *subsonicSource) Related(ctx context.Context, seed Track, limit int) ([]Track, error) {
+	ref, ok := ParseSubsonicURI(seed.WebpageURL)
+	if !ok || ref.Kind != "" {
+		return nil, fmt.Errorf("not an opensubsonic track: %s", seed.WebpageURL)
+	}
+	if ref.LibraryID != s.client.LibraryID() {
+		return nil, fmt.Errorf("unknown opensubsonic library: %s", ref.LibraryID)
+	}
+
+	tracks, err := s.client.SimilarSongs(ctx, ref.ID, limit)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.addStreamURLs(tracks); err != nil {
+		return nil, err
+	}
+	return trimTracks(tracks, limit), nil
+}
+
+func (s *subsonicSource) BrowseRoots() []Track {
+	opaque := SubsonicRef{LibraryID: s.client.LibraryID(), Kind: KindPlaylist}.URI()
+	return []Track{{
+		Title:      "Playlists",
+		Artist:     s.client.Label(),
+		URL:        opaque,
+		WebpageURL: opaque,
+		Source:     SourceSubsonic,
+		Kind:       KindFolder,
+	}}
+}
+
+// Browse lists an artist's albums, an album's or playlist's songs, or the
+// library's playlists. Songs keep their opaque URIs so they can be queued
+// one at a time.
+func (s *subsonicSource) Browse(ctx context.Context, rawURL string) (Listing, error) {
+	ref, ok := ParseSubsonicURI(rawURL)
+	if !ok || ref.LibraryID != s.client.LibraryID() {
+		return Listing{}, fmt.Errorf("not an opensubsonic library item: %s", rawURL)
+	}
+
+	switch ref.Kind {
+	case KindArtist:
+		artist, err := s.client.GetArtist(ctx, ref.ID)
+		if err != nil {
+			return Listing{}, err
+		}
+		listing := Listing{Title: artist.Name}
+		for _, album := range artist.Album {
+			listing.Tracks = append(listing.Tracks, s.client.albumToTrack(album))
+		}
+		return listing, nil
+	case KindAlbum:
+		album, err := s.client.GetAlbum(ctx, ref.ID)
+		if err != nil {
+			return Listing{}, err
+		}
+		listing := Listing{Title: album.Name, Artist: album.Artist}
+		for _, song := range album.Song {
+			listing.Tracks = append(listing.Tracks, s.client.songToTrack(song))
+		}
+		return listing, nil
+	case KindPlaylist:
+		if ref.ID == "" {
+			playlists, err := s.client.GetPlaylists(ctx)
+			if err != nil {
+				return Listing{}, err
+			}
+			listing := Listing{Title: "Playlists", Artist: s.client.Label()}
+			for _, playlist := range playlists {
+				listing.Tracks = append(listing.Tracks, s.client.playlistToTrack(playlist))
+			}
+			return listing, nil
+		}
+		playlist, err := s.client.GetPlaylist(ctx, ref.ID)
+		if err != nil {
+			return Listing{}, err
+		}
+		listing := Listing{Title: playlist.Name, Artist: playlist.Owner}
+		for _, song := range playlist.Entry {
+			listing.Tracks = append(listing.Tracks, s.client.songToTrack(song))
+		}
+		return listing, nil
+	}
+	return Listing{}, fmt.Errorf("tracks cannot be browsed")
+}
+
+func (s *subsonicSource) streamTracks(songs []subsonicSong) ([]Track, error) {
+	tracks := make([]Track, 0, len(songs))
+	for _, song := range songs {
+		tracks = append(tracks, s.client.songToTrack(song))
+	}
+	if err := s.addStreamURLs(tracks); err != nil {
+		return nil, err
+	}
+	return tracks, nil
+}
+
+func (s *subsonicSource) addStreamURLs(tracks []Track) error {
+	for i := range tracks {
+		streamURL, err := s.client.BuildStreamURL(tracks[i].ID)
+		if err != nil {
+			return err
+		}
+		tracks[i].URL = streamURL
+	}
+	return nil
+}
+
+func (s *subsonicSource) Scrobble(ctx context.Context, track Track, playedAt time.Time, submission bool) error {
+	ref, ok := ParseSubsonicURI(track.WebpageURL)
+	if !ok || ref.Kind != "" {
+		return fmt.Errorf("not an opensubsonic track: %s", track.WebpageURL)
+	}
+	if ref.LibraryID != s.client.LibraryID() {
+		return fmt.Errorf("unknown opensubsonic library: %s", ref.LibraryID)
+	}
+	return s.client.Scrobble(ctx, ref.ID, playedAt, submission)
+}
+
+func (s *subsonicSource) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx)
+}
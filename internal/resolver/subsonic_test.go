@@ -3,11 +3,15 @@
 package resolver
 
 import (
+	"context"
 	"crypto/md5"
 	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestSubsonicAuthParams(t *testing.T) {
@@ -72,3 +76,256 @@ func TestSubsonicBuildStreamURL(t *testing.T) {
 		t.Fatalf("streamURL leaked token: %s", streamURL)
 	}
 }
+
+func TestSubsonicPing(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{name: "ok", body: `{"subsonic-response":{"status":"ok"}}`},
+		{name: "failed", body: `{"subsonic-response":{"status":"failed","error":{"message":"Wrong username or password"}}}`, wantErr: "Wrong username or password"},
+		{name: "failed without message", body: `{"subsonic-response":{"status":"failed"}}`, wantErr: "ping failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !strings.HasSuffix(r.URL.Path, "/rest/ping.view") {
+					t.Errorf("path = %q, want ping.view", r.URL.Path)
+				}
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			client := NewSubsonicClient(openSubsonicConfig{
+				BaseURL:   srv.URL,
+				Username:  "alice",
+				Token:     "token-secret",
+				TimeoutMS: 2500,
+			})
+
+			err := client.Ping(context.Background())
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Ping failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Ping error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSubsonicSimilarSongs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/rest/getSimilarSongs2.view") {
+			t.Errorf("path = %q, want getSimilarSongs2.view", r.URL.Path)
+		}
+		if r.URL.Query().Get("id") != "seed" || r.URL.Query().Get("count") != "2" {
+			t.Errorf("query = %q, want id=seed and count=2", r.URL.RawQuery)
+		}
+		w.Write([]byte(`{"subsonic-response":{"status":"ok","similarSongs2":{"song":[
+			{"id":"seed","title":"Seed"},
+			{"id":"s1","title":"One","artist":"A","duration":200},
+			{"id":"s2","title":"Two"}
+		]}}}`))
+	}))
+	defer srv.Close()
+
+	client := NewSubsonicClient(openSubsonicConfig{
+		LibraryID: "personal",
+		BaseURL:   srv.URL,
+		Username:  "alice",
+		Token:     "token-secret",
+		TimeoutMS: 2500,
+	})
+
+	tracks, err := client.SimilarSongs(context.Background(), "seed", 2)
+	if err != nil {
+		t.Fatalf("SimilarSongs failed: %v", err)
+	}
+	if len(tracks) != 2 || tracks[0].ID != "s1" || tracks[1].ID != "s2" {
+		t.Fatalf("tracks = %+v, want s1 and s2 without the seed", tracks)
+	}
+	if tracks[0].WebpageURL != BuildSubsonicURI("personal", "s1") || tracks[1].Artist != "OpenSubsonic" {
+		t.Errorf("tracks not converted like search results: %+v", tracks)
+	}
+}
+
+func TestSubsonicScrobble(t *testing.T) {
+	var got []url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/rest/scrobble.view") {
+			t.Errorf("path = %q, want scrobble.view", r.URL.Path)
+		}
+		got = append(got, r.URL.Query())
+		w.Write([]byte(`{"subsonic-response":{"status":"ok"}}`))
+	}))
+	defer srv.Close()
+
+	src := &subsonicSource{client: NewSubsonicClient(openSubsonicConfig{
+		LibraryID: "personal",
+		BaseURL:   srv.URL,
+		Username:  "alice",
+		Token:     "token-secret",
+		TimeoutMS: 2500,
+	})}
+
+	playedAt := time.UnixMilli(1700000000123)
+	track := Track{ID: "s1", WebpageURL: BuildSubsonicURI("personal", "s1"), Source: SourceSubsonic}
+	if err := src.Scrobble(context.Background(), track, playedAt, false); err != nil {
+		t.Fatalf("Scrobble(now playing) failed: %v", err)
+	}
+	if err := src.Scrobble(context.Background(), track, playedAt, true); err != nil {
+		t.Fatalf("Scrobble(submission) failed: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("requests = %d, want 2", len(got))
+	}
+	for i, want := range []string{"false", "true"} {
+		if got[i].Get("id") != "s1" || got[i].Get("time") != "1700000000123" || got[i].Get("submission") != want {
+			t.Errorf("request %d query = %v, want id=s1, time=1700000000123 and submission=%s", i, got[i], want)
+		}
+	}
+
+	album := Track{WebpageURL: SubsonicRef{LibraryID: "personal", Kind: KindAlbum, ID: "al-1"}.URI(), Source: SourceSubsonic}
+	if err := src.Scrobble(context.Background(), album, playedAt, true); err == nil {
+		t.Error("Scrobble(album) should fail")
+	}
+}
+
+func newTestSubsonicSource(t *testing.T) *subsonicSource {
+	t.Helper()
+	responses := map[string]string{
+		"search3.view": `{"subsonic-response":{"status":"ok","searchResult3":{
+			"artist":[{"id":"ar-1","name":"The Band"}],
+			"album":[{"id":"al-1","name":"First Album","artist":"The Band","duration":420}],
+			"song":[{"id":"s1","title":"Best Song","artist":"The Band"},{"id":"s2","title":"Other Song","artist":"The Band"}]
+		}}}`,
+		"getArtist.view": `{"subsonic-response":{"status":"ok","artist":{"id":"ar-1","name":"The Band","album":[
+			{"id":"al-1","name":"First Album","artist":"The Band"},
+			{"id":"al-2","name":"Second Album","artist":"The Band"}
+		]}}}`,
+		"getAlbum.view": `{"subsonic-response":{"status":"ok","album":{"id":"al-1","name":"First Album","artist":"The Band","song":[
+			{"id":"t1","title":"Opener"},{"id":"t2","title":"Middle"},{"id":"t3","title":"Closer"}
+		]}}}`,
+		"getPlaylists.view": `{"subsonic-response":{"status":"ok","playlists":{"playlist":[{"id":"pl-1","name":"Mix","owner":"alice"}]}}}`,
+		"getPlaylist.view":  `{"subsonic-response":{"status":"ok","playlist":{"id":"pl-1","name":"Mix","owner":"alice","entry":[{"id":"t3"},{"id":"t1"}]}}}`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := responses[strings.TrimPrefix(r.URL.Path, "/rest/")]
+		if !ok {
+			t.Errorf("unexpected request %s", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	return &subsonicSource{client: NewSubsonicClient(openSubsonicConfig{
+		LibraryID: "personal",
+		BaseURL:   srv.URL,
+		Username:  "alice",
+		Token:     "token-secret",
+		TimeoutMS: 2500,
+	})}
+}
+
+func TestSubsonicSearchListsArtistsAndAlbums(t *testing.T) {
+	src := newTestSubsonicSource(t)
+
+	tracks, err := src.Search(context.Background(), "band", 5)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+
+	var got []string
+	for _, track := range tracks {
+		got = append(got, track.Kind+":"+track.ID)
+	}
+	if want := ":s1,artist:ar-1,album:al-1,:s2"; strings.Join(got, ",") != want {
+		t.Fatalf("hits = %s, want %s", strings.Join(got, ","), want)
+	}
+	if tracks[2].WebpageURL != "skaldi+subsonic://personal/album/al-1" {
+		t.Errorf("album URI = %q", tracks[2].WebpageURL)
+	}
+}
+
+func TestSubsonicResolveCollections(t *testing.T) {
+	src := newTestSubsonicSource(t)
+
+	tests := []struct {
+		url     string
+		want    []string
+		wantErr bool
+	}{
+		{url: "skaldi+subsonic://personal/album/al-1", want: []string{"t1", "t2", "t3"}},
+		{url: "skaldi+subsonic://personal/playlist/pl-1", want: []string{"t3", "t1"}},
+		{url: "skaldi+subsonic://personal/artist/ar-1", wantErr: true},
+		{url: "skaldi+subsonic://personal/playlist/", wantErr: true},
+	}
+	for _, tt := range tests {
+		tracks, err := src.Resolve(context.Background(), tt.url)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Resolve(%s) should fail", tt.url)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Resolve(%s) failed: %v", tt.url, err)
+		}
+		var ids []string
+		for _, track := range tracks {
+			ids = append(ids, track.ID)
+			if !strings.Contains(track.URL, "/rest/stream.view") {
+				t.Errorf("%s: URL = %q, want a stream URL", track.ID, track.URL)
+			}
+			if track.WebpageURL != BuildSubsonicURI("personal", track.ID) {
+				t.Errorf("%s: WebpageURL = %q", track.ID, track.WebpageURL)
+			}
+		}
+		if strings.Join(ids, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("Resolve(%s) = %v, want %v in order", tt.url, ids, tt.want)
+		}
+	}
+}
+
+func TestSubsonicBrowse(t *testing.T) {
+	src := newTestSubsonicSource(t)
+
+	tests := []struct {
+		url       string
+		wantTitle string
+		wantKinds string
+	}{
+		{"skaldi+subsonic://personal/artist/ar-1", "The Band", "album,album"},
+		{"skaldi+subsonic://personal/album/al-1", "First Album", ",,"},
+		{"skaldi+subsonic://personal/playlist/", "Playlists", "playlist"},
+		{"skaldi+subsonic://personal/playlist/pl-1", "Mix", ","},
+	}
+	for _, tt := range tests {
+		listing, err := src.Browse(context.Background(), tt.url)
+		if err != nil {
+			t.Fatalf("Browse(%s) failed: %v", tt.url, err)
+		}
+		if listing.Title != tt.wantTitle {
+			t.Errorf("Browse(%s) title = %q, want %q", tt.url, listing.Title, tt.wantTitle)
+		}
+		var kinds []string
+		for _, track := range listing.Tracks {
+			kinds = append(kinds, track.Kind)
+		}
+		if strings.Join(kinds, ",") != tt.wantKinds {
+			t.Errorf("Browse(%s) kinds = %q, want %q", tt.url, strings.Join(kinds, ","), tt.wantKinds)
+		}
+	}
+
+	if _, err := src.Browse(context.Background(), BuildSubsonicURI("personal", "t1")); err == nil {
+		t.Error("Browse should fail for a single track")
+	}
+}
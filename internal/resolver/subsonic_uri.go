@@ -10,13 +10,25 @@ import (
 
 const SubsonicURIScheme = "skaldi+subsonic"
 
+// SubsonicRef is what a skaldi+subsonic URI points at. Tracks have no Kind
+// and use the short skaldi+subsonic://library/track form; albums, artists
+// and playlists use skaldi+subsonic://library/kind/id. A playlist reference
+// with no ID stands for the library's list of playlists.
 type SubsonicRef struct {
 	LibraryID string
-	TrackID   string
+	Kind      string
+	ID        string
 }
 
 func BuildSubsonicURI(libraryID, trackID string) string {
-	return fmt.Sprintf("%s://%s/%s", SubsonicURIScheme, libraryID, url.PathEscape(trackID))
+	return SubsonicRef{LibraryID: libraryID, ID: trackID}.URI()
+}
+
+func (ref SubsonicRef) URI() string {
+	if ref.Kind == "" {
+		return fmt.Sprintf("%s://%s/%s", SubsonicURIScheme, ref.LibraryID, url.PathEscape(ref.ID))
+	}
+	return fmt.Sprintf("%s://%s/%s/%s", SubsonicURIScheme, ref.LibraryID, ref.Kind, url.PathEscape(ref.ID))
 }
 
 func ParseSubsonicURI(raw string) (SubsonicRef, bool) {
@@ -30,11 +42,25 @@ func ParseSubsonicURI(raw string) (SubsonicRef, bool) {
 		return SubsonicRef{}, false
 	}
 
-	trackID := strings.TrimPrefix(u.Path, "/")
-	trackID, err = url.PathUnescape(trackID)
-	if err != nil || trackID == "" {
-		return SubsonicRef{}, false
+	// IDs are path-escaped, so only the separator after a kind is a literal
+	// slash.
+	ref := SubsonicRef{LibraryID: libraryID}
+	escapedID := strings.TrimPrefix(u.EscapedPath(), "/")
+	if kind, rest, ok := strings.Cut(escapedID, "/"); ok {
+		switch kind {
+		case KindAlbum, KindArtist, KindPlaylist:
+		default:
+			return SubsonicRef{}, false
+		}
+		ref.Kind, escapedID = kind, rest
 	}
 
-	return SubsonicRef{LibraryID: libraryID, TrackID: trackID}, true
+	ref.ID, err = url.PathUnescape(escapedID)
+	if err != nil || strings.Contains(escapedID, "/") {
+		return SubsonicRef{}, false
+	}
+	if ref.ID == "" && ref.Kind != KindPlaylist {
+		return SubsonicRef{}, false
+	}
+	return ref, true
 }
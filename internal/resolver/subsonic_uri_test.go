@@ -5,16 +5,32 @@ package resolver
 import "testing"
 
 func TestSubsonicURIRoundTrip(t *testing.T) {
-	raw := BuildSubsonicURI("personal", "track/123")
-	ref, ok := ParseSubsonicURI(raw)
-	if !ok {
-		t.Fatalf("ParseSubsonicURI(%q) = not ok", raw)
+	tests := []struct {
+		ref  SubsonicRef
+		want string
+	}{
+		{SubsonicRef{LibraryID: "personal", ID: "track/123"}, "skaldi+subsonic://personal/track%2F123"},
+		{SubsonicRef{LibraryID: "personal", Kind: KindAlbum, ID: "al-1"}, "skaldi+subsonic://personal/album/al-1"},
+		{SubsonicRef{LibraryID: "personal", Kind: KindArtist, ID: "ar/1"}, "skaldi+subsonic://personal/artist/ar%2F1"},
+		{SubsonicRef{LibraryID: "personal", Kind: KindPlaylist, ID: "pl-1"}, "skaldi+subsonic://personal/playlist/pl-1"},
+		{SubsonicRef{LibraryID: "personal", Kind: KindPlaylist}, "skaldi+subsonic://personal/playlist/"},
 	}
-	if ref.LibraryID != "personal" {
-		t.Fatalf("LibraryID = %q, want personal", ref.LibraryID)
+	for _, tt := range tests {
+		raw := tt.ref.URI()
+		if raw != tt.want {
+			t.Errorf("URI() = %q, want %q", raw, tt.want)
+		}
+		ref, ok := ParseSubsonicURI(raw)
+		if !ok {
+			t.Fatalf("ParseSubsonicURI(%q) = not ok", raw)
+		}
+		if ref != tt.ref {
+			t.Errorf("ParseSubsonicURI(%q) = %+v, want %+v", raw, ref, tt.ref)
+		}
 	}
-	if ref.TrackID != "track/123" {
-		t.Fatalf("TrackID = %q, want track/123", ref.TrackID)
+
+	if got := BuildSubsonicURI("personal", "track/123"); got != tests[0].want {
+		t.Errorf("BuildSubsonicURI = %q, want %q", got, tests[0].want)
 	}
 }
 
@@ -24,6 +40,9 @@ func TestParseSubsonicURIInvalid(t *testing.T) {
 		"https://example.com/x",
 		"skaldi+subsonic:///track",
 		"skaldi+subsonic://lib/",
+		"skaldi+subsonic://lib/album/",
+		"skaldi+subsonic://lib/song/1",
+		"skaldi+subsonic://lib/album/1/2",
 	}
 	for _, raw := range cases {
 		if _, ok := ParseSubsonicURI(raw); ok {
@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package resolver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"time"
+
+	"github.com/reuski/skaldi/internal/bootstrap"
+)
+
+// youtubeSource searches YouTube videos with yt-dlp's ytsearch.
+type youtubeSource struct {
+	cfg *bootstrap.Config
+}
+
+func (s *youtubeSource) Name() string { return SourceYouTube }
+
+func (s *youtubeSource) Options() SourceOptions {
+	return SourceOptions{
+		Bucket:        SearchBucketYouTube,
+		MinQueryRunes: minRemoteQueryRunes,
+		CacheTTL:      youtubeCacheTTL,
+		SearchTimeout: youtubeSearchTimeout,
+		DiskCacheTTL:  youtubeDiskCacheTTL,
+	}
+}
+
+func (s *youtubeSource) Search(ctx context.Context, query string, limit int) ([]Track, error) {
+	searchKey := fmt.Sprintf("ytsearch%d:%s", limit, query)
+	args := []string{"--dump-json", "--flat-playlist", "--no-download", "--no-warnings", searchKey}
+
+	cmd := exec.CommandContext(ctx, s.cfg.ShimPath(), args...)
+	start := time.Now()
+	out, err := cmd.Output()
+	observeYtDlp(ctx, string(SearchBucketYouTube), start, err != nil)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("yt-dlp failed: %w", err)
+	}
+
+	tracks, err := parseLines(out)
+	if err != nil {
+		if isNoTracksError(err) {
+			return []Track{}, nil
+		}
+		return nil, err
+	}
+	for i := range tracks {
+		tracks[i].Source = SourceYouTube
+	}
+	return rankTracks(query, dedupeTracks(tracks, limit), limit), nil
+}
+
+func (s *youtubeSource) Resolve(ctx context.Context, rawURL string) ([]Track, error) {
+	return resolveWithYtDlp(ctx, s.cfg, rawURL)
+}
+
+func (s *youtubeSource) Related(ctx context.Context, seed Track, limit int) ([]Track, error) {
+	return relatedFromMix(ctx, s.cfg, seed, limit)
+}
+
+// ytMusicSource searches the songs shelf of YouTube Music. Its tracks are
+// YouTube videos too, so hits YouTube search also found are merged into
+// those.
+type ytMusicSource struct {
+	cfg *bootstrap.Config
+}
+
+func (s *ytMusicSource) Name() string { return SourceYTMusic }
+
+func (s *ytMusicSource) Options() SourceOptions {
+	return SourceOptions{
+		Bucket:        SearchBucketYTMusic,
+		MinQueryRunes: minRemoteQueryRunes,
+		MergeInto:     SourceYouTube,
+		CacheTTL:      ytMusicCacheTTL,
+		SearchTimeout: ytMusicSearchTimeout,
+		DiskCacheTTL:  ytMusicDiskCacheTTL,
+	}
+}
+
+func (s *ytMusicSource) Search(ctx context.Context, query string, limit int) ([]Track, error) {
+	musicURL := "https://music.youtube.com/search?q=" + url.QueryEscape(query) + "#songs"
+	args := []string{"--dump-json", "--no-download", "--no-warnings"}
+	args = append(args, "--playlist-end", fmt.Sprintf("%d", limit*2))
+	args = append(args, musicURL)
+
+	cmdCtx, cmdCancel := context.WithCancel(ctx)
+	defer cmdCancel()
+
+	cmd := exec.CommandContext(cmdCtx, s.cfg.ShimPath(), args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		observeYtDlp(ctx, string(SearchBucketYTMusic), start, true)
+		return nil, err
+	}
+
+	var tracks []Track
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+
+	for scanner.Scan() {
+		var resp ytDlpResponse
+		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+			continue
+		}
+		if resp.IEKey == "YoutubeTab" || resp.LiveStatus == "is_live" || resp.LiveStatus == "was_live" {
+			continue
+		}
+		track := trackFromResponse(resp)
+		if track.WebpageURL == "" {
+			continue
+		}
+		track.Source = SourceYTMusic
+		tracks = append(tracks, track)
+		if len(tracks) >= limit {
+			break
+		}
+	}
+
+	cmdCancel()
+	_ = cmd.Wait()
+	// The process is cut off once enough tracks arrive, so only an empty
+	// result counts as a failure.
+	observeYtDlp(ctx, string(SearchBucketYTMusic), start, len(tracks) == 0)
+
+	if len(tracks) == 0 {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("no tracks found")
+	}
+	return rankTracks(query, dedupeTracks(tracks, limit), limit), nil
+}
+
+func (s *ytMusicSource) Resolve(ctx context.Context, rawURL string) ([]Track, error) {
+	return resolveWithYtDlp(ctx, s.cfg, rawURL)
+}
+
+func (s *ytMusicSource) Related(ctx context.Context, seed Track, limit int) ([]Track, error) {
+	return relatedFromMix(ctx, s.cfg, seed, limit)
+}
+
+// resolveWithYtDlp lists the tracks behind any URL yt-dlp understands.
+func resolveWithYtDlp(ctx context.Context, cfg *bootstrap.Config, rawURL string) ([]Track, error) {
+	args := []string{"--dump-json", "--flat-playlist", "--no-download", "--no-warnings", rawURL}
+	cmd := exec.CommandContext(ctx, cfg.ShimPath(), args...)
+	start := time.Now()
+	out, err := cmd.Output()
+	observeYtDlp(ctx, "resolve", start, err != nil)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("yt-dlp failed: %w", err)
+	}
+	return parseLines(out)
+}
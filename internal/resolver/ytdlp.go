@@ -15,6 +15,7 @@ import (
 	"net/http"
 	"net/url"
 	"os/exec"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -23,27 +24,58 @@ import (
 	"unicode/utf8"
 
 	"github.com/reuski/skaldi/internal/bootstrap"
+	"github.com/reuski/skaldi/internal/metrics"
 )
 
 const (
-	SourceSubsonic = "subsonic"
-	SourceYTMusic  = "ytmusic"
-	SourceYouTube  = "youtube"
-
-	typeaheadTrackLimit   = 4
-	resultsTrackLimit     = 8
-	providerSearchLimit   = 12
-	maxSuggestionCount    = 8
-	minRemoteQueryRunes   = 2
-	searchCacheLimit      = 64
-	suggestionCacheTTL    = 5 * time.Minute
-	externalCacheTTL      = 60 * time.Second
-	youtubeCacheTTL       = 2 * time.Minute
-	ytMusicCacheTTL       = 2 * time.Minute
-	suggestionTimeout     = 2 * time.Second
-	externalSearchTimeout = 2500 * time.Millisecond
-	youtubeSearchTimeout  = 5 * time.Second
-	ytMusicSearchTimeout  = 10 * time.Second
+	SourceBandcamp   = "bandcamp"
+	SourceLocal      = "local"
+	SourceSoundCloud = "soundcloud"
+	SourceSubsonic   = "subsonic"
+	SourceYTMusic    = "ytmusic"
+	SourceYouTube    = "youtube"
+
+	// Search hits are single tracks unless they have one of these kinds.
+	// Albums and playlists queue all their tracks; artists and folders can
+	// only be browsed.
+	KindAlbum    = "album"
+	KindArtist   = "artist"
+	KindPlaylist = "playlist"
+	KindFolder   = "folder"
+
+	typeaheadTrackLimit     = 4
+	resultsTrackLimit       = 8
+	providerSearchLimit     = 12
+	maxSuggestionCount      = 8
+	minRemoteQueryRunes     = 2
+	searchCacheLimit        = 64
+	suggestionCacheTTL      = 5 * time.Minute
+	externalCacheTTL        = 60 * time.Second
+	youtubeCacheTTL         = 2 * time.Minute
+	ytMusicCacheTTL         = 2 * time.Minute
+	soundCloudCacheTTL      = 2 * time.Minute
+	bandcampCacheTTL        = 5 * time.Minute
+	youtubeDiskCacheTTL     = 6 * time.Hour
+	ytMusicDiskCacheTTL     = 6 * time.Hour
+	soundCloudDiskCacheTTL  = 6 * time.Hour
+	bandcampDiskCacheTTL    = 24 * time.Hour
+	suggestionTimeout       = 2 * time.Second
+	externalSearchTimeout   = 2500 * time.Millisecond
+	youtubeSearchTimeout    = 5 * time.Second
+	ytMusicSearchTimeout    = 10 * time.Second
+	soundCloudSearchTimeout = 8 * time.Second
+	bandcampSearchTimeout   = 5 * time.Second
+)
+
+var (
+	ytDlpInvocations = metrics.NewCounter("skaldi_ytdlp_invocations_total",
+		"yt-dlp runs by search bucket, or resolve for queued URLs.", "bucket")
+	ytDlpFailures = metrics.NewCounter("skaldi_ytdlp_failures_total",
+		"yt-dlp runs that failed or timed out.", "bucket")
+	ytDlpDuration = metrics.NewHistogram("skaldi_ytdlp_duration_seconds",
+		"yt-dlp run time.", metrics.SlowBuckets, "bucket")
+	searchCacheLookups = metrics.NewCounter("skaldi_search_cache_lookups_total",
+		"Search cache lookups by result: hit, miss, or deduplicated onto an in-flight load.", "cache", "result")
 )
 
 type SearchIntent string
@@ -58,25 +90,45 @@ type SearchBucket string
 const (
 	SearchBucketSuggestions SearchBucket = "suggestions"
 	SearchBucketExternal    SearchBucket = "external"
+	SearchBucketLocal       SearchBucket = "local"
 	SearchBucketYouTube     SearchBucket = "youtube"
 	SearchBucketYTMusic     SearchBucket = "ytmusic"
+	SearchBucketSoundCloud  SearchBucket = "soundcloud"
+	SearchBucketBandcamp    SearchBucket = "bandcamp"
 )
 
+// ExternalBucket is the bucket an OpenSubsonic library's hits are streamed
+// in.
+func ExternalBucket(libraryID string) SearchBucket {
+	return SearchBucketExternal + ":" + SearchBucket(libraryID)
+}
+
+// IsExternal reports whether the bucket holds hits from a personal library
+// rather than a public catalogue.
+func (b SearchBucket) IsExternal() bool {
+	return b == SearchBucketExternal || strings.HasPrefix(string(b), string(SearchBucketExternal)+":")
+}
+
 type Track struct {
-	ID         string  `json:"id,omitempty"`
-	Title      string  `json:"title"`
-	Artist     string  `json:"artist"`
-	Duration   float64 `json:"duration"`
-	Uploader   string  `json:"uploader"`
-	Thumbnail  string  `json:"thumbnail"`
-	URL        string  `json:"url,omitempty"`
-	WebpageURL string  `json:"webpage_url,omitempty"`
-	Source     string  `json:"source,omitempty"`
+	ID            string  `json:"id,omitempty"`
+	Title         string  `json:"title"`
+	Artist        string  `json:"artist"`
+	Duration      float64 `json:"duration"`
+	Uploader      string  `json:"uploader"`
+	Thumbnail     string  `json:"thumbnail"`
+	URL           string  `json:"url,omitempty"`
+	WebpageURL    string  `json:"webpage_url,omitempty"`
+	Source        string  `json:"source,omitempty"`
+	Kind          string  `json:"kind,omitempty"`
+	Autoplay      bool    `json:"autoplay,omitempty"`
+	RequesterID   string  `json:"requester_id,omitempty"`
+	RequesterName string  `json:"requester_name,omitempty"`
 }
 
 type SearchHit struct {
 	ID         string  `json:"id"`
 	Source     string  `json:"source"`
+	Kind       string  `json:"kind,omitempty"`
 	Title      string  `json:"title"`
 	Artist     string  `json:"artist"`
 	Duration   float64 `json:"duration"`
@@ -88,6 +140,7 @@ type SearchHit struct {
 type SearchBatch struct {
 	Intent      SearchIntent `json:"intent"`
 	Bucket      SearchBucket `json:"bucket"`
+	Label       string       `json:"label,omitempty"`
 	Complete    bool         `json:"complete"`
 	Suggestions []string     `json:"suggestions,omitempty"`
 	Hits        []SearchHit  `json:"hits,omitempty"`
@@ -115,13 +168,13 @@ type ytDlpResponse struct {
 
 type Resolver struct {
 	cfg             *bootstrap.Config
-	subsonic        *SubsonicClient
 	suggestClient   *http.Client
 	warnings        []error
 	suggestionCache *searchCache[[]string]
-	externalCache   *searchCache[[]Track]
-	youtubeCache    *searchCache[[]Track]
-	ytMusicCache    *searchCache[[]Track]
+	disk            *diskCache
+
+	sourcesMu sync.RWMutex
+	sources   []*registeredSource
 }
 
 type cacheResult[T any] struct {
@@ -136,6 +189,7 @@ type cacheEntry[T any] struct {
 }
 
 type searchCache[T any] struct {
+	name     SearchBucket
 	mu       sync.Mutex
 	ttl      time.Duration
 	limit    int
@@ -148,30 +202,55 @@ func New(cfg *bootstrap.Config) (*Resolver, error) {
 	r := &Resolver{
 		cfg:             cfg,
 		suggestClient:   &http.Client{Timeout: suggestionTimeout},
-		suggestionCache: newSearchCache[[]string](suggestionCacheTTL, searchCacheLimit),
-		externalCache:   newSearchCache[[]Track](externalCacheTTL, searchCacheLimit),
-		youtubeCache:    newSearchCache[[]Track](youtubeCacheTTL, searchCacheLimit),
-		ytMusicCache:    newSearchCache[[]Track](ytMusicCacheTTL, searchCacheLimit),
+		suggestionCache: newSearchCache[[]string](SearchBucketSuggestions, suggestionCacheTTL, searchCacheLimit),
 	}
+	r.Register(&youtubeSource{cfg: cfg})
+	r.Register(&ytMusicSource{cfg: cfg})
+	r.Register(&soundCloudSource{cfg: cfg})
 
 	if cfg == nil {
 		return r, nil
 	}
 
-	extCfg, err := loadOpenSubsonicConfig(cfg.ConfigPath)
+	libraries, problems := loadOpenSubsonicConfigs(cfg.ConfigPath)
+	for _, problem := range problems {
+		r.warnings = append(r.warnings, fmt.Errorf("opensubsonic disabled: %w", problem))
+	}
+	for _, library := range libraries {
+		r.Register(&subsonicSource{client: NewSubsonicClient(library)})
+	}
+
+	local, ok, err := loadLocalLibraryConfig(cfg.ConfigPath)
 	if err != nil {
-		r.warnings = append(r.warnings, fmt.Errorf("opensubsonic disabled: %w", err))
-		return r, nil
+		r.warnings = append(r.warnings, fmt.Errorf("local library disabled: %w", err))
+	} else if ok {
+		if ffprobePath, err := exec.LookPath("ffprobe"); err != nil {
+			r.warnings = append(r.warnings, fmt.Errorf("local library disabled: ffprobe not found in PATH"))
+		} else {
+			r.Register(newLocalSource(local, cfg.LocalIndexPath(), ffprobePath))
+		}
 	}
-	if extCfg != nil {
-		r.subsonic = NewSubsonicClient(*extCfg)
+
+	bandcamp, ok, err := loadBandcampConfig(cfg.ConfigPath)
+	if err != nil {
+		r.warnings = append(r.warnings, fmt.Errorf("bandcamp search disabled: %w", err))
+	} else if ok {
+		r.Register(newBandcampSource(cfg, bandcamp.SearchURL))
+	}
+
+	cache, ok, err := loadDiskCacheConfig(cfg.ConfigPath)
+	if err != nil {
+		r.warnings = append(r.warnings, fmt.Errorf("persistent cache disabled: %w", err))
+	} else if ok {
+		r.disk = newDiskCache(cfg.DiskCacheDir(), int64(cache.MaxMB)<<20)
 	}
 
 	return r, nil
 }
 
-func newSearchCache[T any](ttl time.Duration, limit int) *searchCache[T] {
+func newSearchCache[T any](name SearchBucket, ttl time.Duration, limit int) *searchCache[T] {
 	return &searchCache[T]{
+		name:     name,
 		ttl:      ttl,
 		limit:    limit,
 		order:    list.New(),
@@ -190,6 +269,7 @@ func (c *searchCache[T]) GetOrLoad(ctx context.Context, key string, loader func(
 			c.order.MoveToFront(elem)
 			value := entry.value
 			c.mu.Unlock()
+			searchCacheLookups.Inc(string(c.name), "hit")
 			return value, nil
 		}
 		c.order.Remove(elem)
@@ -200,6 +280,7 @@ func (c *searchCache[T]) GetOrLoad(ctx context.Context, key string, loader func(
 		waitCh := make(chan cacheResult[T], 1)
 		c.inflight[key] = append(waiters, waitCh)
 		c.mu.Unlock()
+		searchCacheLookups.Inc(string(c.name), "deduplicated")
 
 		select {
 		case <-ctx.Done():
@@ -211,6 +292,7 @@ func (c *searchCache[T]) GetOrLoad(ctx context.Context, key string, loader func(
 
 	c.inflight[key] = nil
 	c.mu.Unlock()
+	searchCacheLookups.Inc(string(c.name), "miss")
 
 	value, err := loader(ctx)
 
@@ -231,6 +313,13 @@ func (c *searchCache[T]) GetOrLoad(ctx context.Context, key string, loader func(
 	return value, err
 }
 
+// Set replaces the value cached under key, as when it has been refreshed.
+func (c *searchCache[T]) Set(key string, value T) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.storeLocked(key, value)
+}
+
 func (c *searchCache[T]) storeLocked(key string, value T) {
 	if elem, ok := c.entries[key]; ok {
 		c.order.Remove(elem)
@@ -264,6 +353,38 @@ func (r *Resolver) Warnings() []error {
 	return out
 }
 
+type LibraryPing struct {
+	LibraryID string
+	Latency   time.Duration
+	Err       error
+}
+
+// PingOpenSubsonic checks that every configured OpenSubsonic library answers
+// and accepts our credentials, asking them all at once. It returns nothing
+// when no library is configured.
+func (r *Resolver) PingOpenSubsonic(ctx context.Context) []LibraryPing {
+	var libraries []*subsonicSource
+	for _, src := range r.registered() {
+		if subsonic, ok := src.Source.(*subsonicSource); ok {
+			libraries = append(libraries, subsonic)
+		}
+	}
+
+	pings := make([]LibraryPing, len(libraries))
+	var wg sync.WaitGroup
+	for i, library := range libraries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			err := library.Ping(ctx)
+			pings[i] = LibraryPing{LibraryID: library.client.LibraryID(), Latency: time.Since(start), Err: err}
+		}()
+	}
+	wg.Wait()
+	return pings
+}
+
 func ParseSearchIntent(raw string) (SearchIntent, error) {
 	switch SearchIntent(raw) {
 	case SearchIntentTypeahead, SearchIntentResults:
@@ -319,18 +440,22 @@ func (r *Resolver) streamTypeahead(ctx context.Context, query string, resultCh c
 		})
 	}()
 
-	if r.subsonic != nil {
+	for _, src := range r.registered() {
+		if !src.opts.Typeahead {
+			continue
+		}
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			hits := []SearchHit{}
-			tracks, err := r.loadExternalTracks(ctx, query)
+			tracks, err := r.searchSource(ctx, src, query)
 			if err == nil {
 				hits = searchHitsFromTracks(trimTracks(tracks, typeaheadTrackLimit))
 			}
 			emitSearchBatch(ctx, resultCh, SearchBatch{
 				Intent:   SearchIntentTypeahead,
-				Bucket:   SearchBucketExternal,
+				Bucket:   src.opts.Bucket,
+				Label:    src.opts.Label,
 				Complete: true,
 				Hits:     hits,
 			})
@@ -340,120 +465,104 @@ func (r *Resolver) streamTypeahead(ctx context.Context, query string, resultCh c
 	wg.Wait()
 }
 
+// streamResults searches every source at once and sends each source's hits
+// as soon as they arrive. A source merged into another waits for it; the
+// target's hits go out early as an incomplete batch, and both again once
+// merged.
 func (r *Resolver) streamResults(ctx context.Context, query string, resultCh chan<- SearchBatch) {
-	var wg sync.WaitGroup
+	type sourceResult struct {
+		src    *registeredSource
+		tracks []Track
+	}
 
-	if r.subsonic != nil {
-		wg.Add(1)
+	sources := r.registered()
+	results := make(chan sourceResult, len(sources))
+	for _, src := range sources {
 		go func() {
-			defer wg.Done()
-			hits := []SearchHit{}
-			tracks, err := r.loadExternalTracks(ctx, query)
-			if err == nil {
-				hits = searchHitsFromTracks(trimTracks(tracks, resultsTrackLimit))
+			tracks, err := r.searchSource(ctx, src, query)
+			if err != nil {
+				tracks = nil
+			}
+			results <- sourceResult{src: src, tracks: trimTracks(tracks, resultsTrackLimit)}
+		}()
+	}
+
+	found := make(map[SearchBucket][]Track, len(sources))
+	for range sources {
+		var result sourceResult
+		select {
+		case <-ctx.Done():
+			return
+		case result = <-results:
+		}
+		found[result.src.opts.Bucket] = result.tracks
+
+		group := mergeGroup(sources, result.src)
+		waiting := false
+		for _, member := range group {
+			if _, ok := found[member.opts.Bucket]; !ok {
+				waiting = true
 			}
+		}
+		if !waiting {
+			emitMergedResults(ctx, resultCh, group, found)
+			continue
+		}
+		if result.src == group[0] && len(result.tracks) > 0 {
 			emitSearchBatch(ctx, resultCh, SearchBatch{
 				Intent:   SearchIntentResults,
-				Bucket:   SearchBucketExternal,
-				Complete: true,
-				Hits:     hits,
+				Bucket:   result.src.opts.Bucket,
+				Label:    result.src.opts.Label,
+				Complete: false,
+				Hits:     searchHitsFromTracks(result.tracks),
 			})
-		}()
+		}
 	}
+}
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		r.streamVideoResults(ctx, query, resultCh)
-	}()
+// mergeGroup returns the source src merges into, or src itself, followed by
+// every source that merges into it.
+func mergeGroup(sources []*registeredSource, src *registeredSource) []*registeredSource {
+	target := src
+	if src.opts.MergeInto != "" {
+		for _, candidate := range sources {
+			if candidate.Name() == src.opts.MergeInto {
+				target = candidate
+				break
+			}
+		}
+	}
 
-	wg.Wait()
+	group := []*registeredSource{target}
+	for _, candidate := range sources {
+		if candidate != target && candidate.opts.MergeInto == target.Name() {
+			group = append(group, candidate)
+		}
+	}
+	return group
 }
 
-func (r *Resolver) streamVideoResults(ctx context.Context, query string, resultCh chan<- SearchBatch) {
-	if !shouldSearchRemote(query) {
-		emitSearchBatch(ctx, resultCh, SearchBatch{
-			Intent:   SearchIntentResults,
-			Bucket:   SearchBucketYouTube,
-			Complete: true,
-			Hits:     []SearchHit{},
-		})
+func emitMergedResults(ctx context.Context, resultCh chan<- SearchBatch, group []*registeredSource, found map[SearchBucket][]Track) {
+	batches := make([][]Track, len(group))
+	merged := found[group[0].opts.Bucket]
+	for i, member := range group[1:] {
+		merged, batches[i+1] = mergeTrackSources(merged, found[member.opts.Bucket])
+	}
+	batches[0] = merged
+
+	for i, src := range group {
 		emitSearchBatch(ctx, resultCh, SearchBatch{
 			Intent:   SearchIntentResults,
-			Bucket:   SearchBucketYTMusic,
+			Bucket:   src.opts.Bucket,
+			Label:    src.opts.Label,
 			Complete: true,
-			Hits:     []SearchHit{},
+			Hits:     searchHitsFromTracks(trimTracks(batches[i], resultsTrackLimit)),
 		})
-		return
-	}
-
-	type providerResult struct {
-		tracks []Track
-		err    error
-	}
-
-	youtubeCh := make(chan providerResult, 1)
-	ytMusicCh := make(chan providerResult, 1)
-
-	go func() {
-		tracks, err := r.loadYouTubeTracks(ctx, query)
-		youtubeCh <- providerResult{tracks: tracks, err: err}
-	}()
-
-	go func() {
-		tracks, err := r.loadYTMusicTracks(ctx, query)
-		ytMusicCh <- providerResult{tracks: tracks, err: err}
-	}()
-
-	var (
-		youtubeTracks []Track
-		ytMusicTracks []Track
-		youtubeReady  bool
-		ytMusicReady  bool
-	)
-
-	for !youtubeReady || !ytMusicReady {
-		select {
-		case <-ctx.Done():
-			return
-		case result := <-youtubeCh:
-			youtubeReady = true
-			if result.err == nil {
-				youtubeTracks = trimTracks(result.tracks, resultsTrackLimit)
-			}
-			if len(youtubeTracks) > 0 && !ytMusicReady {
-				emitSearchBatch(ctx, resultCh, SearchBatch{
-					Intent:   SearchIntentResults,
-					Bucket:   SearchBucketYouTube,
-					Complete: false,
-					Hits:     searchHitsFromTracks(youtubeTracks),
-				})
-			}
-		case result := <-ytMusicCh:
-			ytMusicReady = true
-			if result.err == nil {
-				ytMusicTracks = trimTracks(result.tracks, resultsTrackLimit)
-			}
-		}
 	}
-
-	mergedYouTube, uniqueYTMusic := mergeTrackSources(youtubeTracks, ytMusicTracks)
-	emitSearchBatch(ctx, resultCh, SearchBatch{
-		Intent:   SearchIntentResults,
-		Bucket:   SearchBucketYouTube,
-		Complete: true,
-		Hits:     searchHitsFromTracks(trimTracks(mergedYouTube, resultsTrackLimit)),
-	})
-	emitSearchBatch(ctx, resultCh, SearchBatch{
-		Intent:   SearchIntentResults,
-		Bucket:   SearchBucketYTMusic,
-		Complete: true,
-		Hits:     searchHitsFromTracks(trimTracks(uniqueYTMusic, resultsTrackLimit)),
-	})
 }
 
 func (r *Resolver) loadSuggestions(ctx context.Context, query string) ([]string, error) {
-	return r.suggestionCache.GetOrLoad(ctx, query, func(ctx context.Context) ([]string, error) {
+	load := func(ctx context.Context) ([]string, error) {
 		tCtx, cancel := context.WithTimeout(ctx, suggestionTimeout)
 		defer cancel()
 		items, err := r.fetchSuggestions(tCtx, query)
@@ -461,6 +570,11 @@ func (r *Resolver) loadSuggestions(ctx context.Context, query string) ([]string,
 			return nil, err
 		}
 		return dedupeSuggestions(items), nil
+	}
+	return r.suggestionCache.GetOrLoad(ctx, query, func(ctx context.Context) ([]string, error) {
+		return cachedLoad(ctx, r.disk, string(SearchBucketSuggestions), query, suggestionDiskCacheTTL, load, func(items []string) {
+			r.suggestionCache.Set(query, items)
+		})
 	})
 }
 
@@ -499,172 +613,29 @@ func (r *Resolver) fetchSuggestions(ctx context.Context, query string) ([]string
 	return suggestions, nil
 }
 
-func (r *Resolver) loadExternalTracks(ctx context.Context, query string) ([]Track, error) {
-	if r.subsonic == nil {
-		return []Track{}, nil
-	}
-
-	return r.externalCache.GetOrLoad(ctx, query, func(ctx context.Context) ([]Track, error) {
-		tCtx, cancel := context.WithTimeout(ctx, externalSearchTimeout)
-		defer cancel()
-		tracks, err := r.subsonic.Search(tCtx, query, providerSearchLimit)
-		if err != nil {
-			return nil, err
-		}
-		return dedupeTracks(tracks, providerSearchLimit), nil
-	})
-}
-
-func (r *Resolver) loadYouTubeTracks(ctx context.Context, query string) ([]Track, error) {
-	return r.youtubeCache.GetOrLoad(ctx, query, func(ctx context.Context) ([]Track, error) {
-		tCtx, cancel := context.WithTimeout(ctx, youtubeSearchTimeout)
-		defer cancel()
-		tracks, err := r.searchYouTube(tCtx, query)
-		if err != nil {
-			return nil, err
-		}
-		return rankTracks(query, dedupeTracks(tracks, providerSearchLimit), providerSearchLimit), nil
-	})
-}
-
-func (r *Resolver) loadYTMusicTracks(ctx context.Context, query string) ([]Track, error) {
-	return r.ytMusicCache.GetOrLoad(ctx, query, func(ctx context.Context) ([]Track, error) {
-		tCtx, cancel := context.WithTimeout(ctx, ytMusicSearchTimeout)
-		defer cancel()
-		tracks, err := r.searchMusic(tCtx, query)
-		if err != nil {
-			return nil, err
-		}
-		return rankTracks(query, dedupeTracks(tracks, providerSearchLimit), providerSearchLimit), nil
-	})
-}
-
-func (r *Resolver) searchYouTube(ctx context.Context, query string) ([]Track, error) {
-	searchKey := fmt.Sprintf("ytsearch%d:%s", providerSearchLimit, query)
-	args := []string{"--dump-json", "--flat-playlist", "--no-download", "--no-warnings", searchKey}
-
-	cmd := exec.CommandContext(ctx, r.cfg.ShimPath(), args...)
-	out, err := cmd.Output()
-	if err != nil {
-		if ctx.Err() != nil {
-			return nil, ctx.Err()
-		}
-		return nil, fmt.Errorf("yt-dlp failed: %w", err)
-	}
-
-	tracks, err := parseLines(out)
-	if err != nil {
-		if isNoTracksError(err) {
-			return []Track{}, nil
-		}
-		return nil, err
-	}
-	for i := range tracks {
-		tracks[i].Source = SourceYouTube
-	}
-	return tracks, nil
-}
-
-func (r *Resolver) searchMusic(ctx context.Context, query string) ([]Track, error) {
-	musicURL := "https://music.youtube.com/search?q=" + url.QueryEscape(query) + "#songs"
-	args := []string{"--dump-json", "--no-download", "--no-warnings"}
-	args = append(args, "--playlist-end", fmt.Sprintf("%d", providerSearchLimit*2))
-	args = append(args, musicURL)
-
-	cmdCtx, cmdCancel := context.WithCancel(ctx)
-	defer cmdCancel()
-
-	cmd := exec.CommandContext(cmdCtx, r.cfg.ShimPath(), args...)
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return nil, err
-	}
-	if err := cmd.Start(); err != nil {
-		return nil, err
-	}
-
-	var tracks []Track
-	scanner := bufio.NewScanner(stdout)
-	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
-
-	for scanner.Scan() {
-		var resp ytDlpResponse
-		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
-			continue
-		}
-		if resp.IEKey == "YoutubeTab" || resp.LiveStatus == "is_live" || resp.LiveStatus == "was_live" {
-			continue
-		}
-		track := trackFromResponse(resp)
-		if track.WebpageURL == "" {
-			continue
-		}
-		track.Source = SourceYTMusic
-		tracks = append(tracks, track)
-		if len(tracks) >= providerSearchLimit {
-			break
-		}
-	}
-
-	cmdCancel()
-	_ = cmd.Wait()
-
-	if len(tracks) == 0 {
-		if ctx.Err() != nil {
-			return nil, ctx.Err()
-		}
-		return nil, fmt.Errorf("no tracks found")
-	}
-	return tracks, nil
-}
-
+// Resolve lists the tracks behind a URL. Opaque URLs go to the source that
+// owns their scheme and everything else to yt-dlp, through the persistent
+// cache when one is configured.
 func (r *Resolver) Resolve(ctx context.Context, rawURL string) ([]Track, error) {
-	if subsonicRef, ok := ParseSubsonicURI(rawURL); ok {
-		return r.resolveSubsonicTrack(ctx, subsonicRef)
+	if src, ok := r.SourceForURL(rawURL); ok {
+		return src.Resolve(ctx, rawURL)
 	}
-
-	args := []string{"--dump-json", "--flat-playlist", "--no-download", "--no-warnings", rawURL}
-	cmd := exec.CommandContext(ctx, r.cfg.ShimPath(), args...)
-	out, err := cmd.Output()
-	if err != nil {
-		if ctx.Err() != nil {
-			return nil, ctx.Err()
-		}
-		return nil, fmt.Errorf("yt-dlp failed: %w", err)
+	if IsSourceURL(rawURL) {
+		return nil, fmt.Errorf("no source is configured for %s", rawURL)
 	}
-	return parseLines(out)
+	return cachedLoad(ctx, r.disk, "resolve", rawURL, resolveDiskCacheTTL, func(ctx context.Context) ([]Track, error) {
+		return resolveWithYtDlp(ctx, r.cfg, rawURL)
+	}, nil)
 }
 
-func (r *Resolver) resolveSubsonicTrack(ctx context.Context, ref SubsonicRef) ([]Track, error) {
-	if r.subsonic == nil {
-		return nil, fmt.Errorf("opensubsonic source is not configured")
-	}
-	if ref.LibraryID != r.subsonic.LibraryID() {
-		return nil, fmt.Errorf("unknown opensubsonic library: %s", ref.LibraryID)
-	}
-
-	streamURL, err := r.subsonic.BuildStreamURL(ref.TrackID)
-	if err != nil {
-		return nil, err
-	}
-
-	track, err := r.subsonic.GetTrack(ctx, ref.TrackID)
-	if err != nil {
-		track = Track{
-			ID:         ref.TrackID,
-			Title:      ref.TrackID,
-			Artist:     "OpenSubsonic",
-			Uploader:   "OpenSubsonic",
-			WebpageURL: BuildSubsonicURI(ref.LibraryID, ref.TrackID),
-			Source:     SourceSubsonic,
-		}
+// observeYtDlp records one yt-dlp run. A run the caller cancelled is not
+// counted as a failure; one that hit its deadline is.
+func observeYtDlp(ctx context.Context, bucket string, start time.Time, failed bool) {
+	ytDlpInvocations.Inc(bucket)
+	ytDlpDuration.Observe(time.Since(start).Seconds(), bucket)
+	if failed && !errors.Is(ctx.Err(), context.Canceled) {
+		ytDlpFailures.Inc(bucket)
 	}
-
-	track.URL = streamURL
-	track.WebpageURL = BuildSubsonicURI(ref.LibraryID, ref.TrackID)
-	track.Source = SourceSubsonic
-
-	return []Track{track}, nil
 }
 
 func emitSearchBatch(ctx context.Context, resultCh chan<- SearchBatch, batch SearchBatch) {
@@ -684,6 +655,7 @@ func searchHitsFromTracks(tracks []Track) []SearchHit {
 		hits = append(hits, SearchHit{
 			ID:         track.ID,
 			Source:     track.Source,
+			Kind:       track.Kind,
 			Title:      track.Title,
 			Artist:     track.Artist,
 			Duration:   track.Duration,
@@ -695,15 +667,32 @@ func searchHitsFromTracks(tracks []Track) []SearchHit {
 	return hits
 }
 
+// PlayableURL is what mpv is given for a track from a search or resolve: its
+// stream URL when the source provides one, or else its page URL, which mpv
+// plays through yt-dlp.
 func (t Track) PlayableURL() string {
-	switch t.Source {
-	case SourceSubsonic:
-		return t.URL
-	case SourceYouTube, SourceYTMusic:
-		return t.WebpageURL
-	default:
+	if t.Source == "" {
 		return ""
 	}
+	if t.URL != "" {
+		return t.URL
+	}
+	return t.WebpageURL
+}
+
+// DedupKey identifies a track across searches and queue requests, or is
+// empty when the track has neither an ID nor a page URL.
+func (t Track) DedupKey() string {
+	if t.ID != "" && t.Kind != "" {
+		return t.Source + "|" + t.Kind + "|" + t.ID
+	}
+	if t.ID != "" {
+		return t.Source + "|id|" + t.ID
+	}
+	if t.WebpageURL != "" {
+		return t.Source + "|url|" + t.WebpageURL
+	}
+	return ""
 }
 
 func dedupeSuggestions(items []string) []string {
@@ -730,7 +719,7 @@ func dedupeTracks(tracks []Track, limit int) []Track {
 	seen := make(map[string]struct{}, len(tracks))
 	out := make([]Track, 0, min(limit, len(tracks)))
 	for _, track := range tracks {
-		key := trackDedupKey(track)
+		key := track.DedupKey()
 		if key == "" {
 			continue
 		}
@@ -746,16 +735,6 @@ func dedupeTracks(tracks []Track, limit int) []Track {
 	return out
 }
 
-func trackDedupKey(track Track) string {
-	if track.ID != "" {
-		return track.Source + "|id|" + track.ID
-	}
-	if track.WebpageURL != "" {
-		return track.Source + "|url|" + track.WebpageURL
-	}
-	return ""
-}
-
 func rankTracks(query string, tracks []Track, limit int) []Track {
 	type rankedTrack struct {
 		track Track
@@ -832,29 +811,76 @@ func trackRelevanceScore(query string, tokens []string, track Track) int {
 	return score
 }
 
-func mergeTrackSources(youtubeTracks []Track, ytMusicTracks []Track) ([]Track, []Track) {
-	if len(youtubeTracks) == 0 {
-		return []Track{}, trimTracks(ytMusicTracks, resultsTrackLimit)
-	}
-
-	mergedYouTube := append([]Track(nil), youtubeTracks...)
-	youtubeIndex := make(map[string]int, len(mergedYouTube))
-	for idx, track := range mergedYouTube {
-		if track.ID != "" {
-			youtubeIndex[track.ID] = idx
+// mergeTrackSources folds secondary hits that are also among the primary
+// hits into those, returning the merged primary hits and the secondary hits
+// left over. YouTube and YouTube Music tracks match by video ID; tracks from
+// other catalogues match by artist and title.
+func mergeTrackSources(primaryTracks []Track, secondaryTracks []Track) ([]Track, []Track) {
+	if len(primaryTracks) == 0 {
+		return []Track{}, trimTracks(secondaryTracks, resultsTrackLimit)
+	}
+
+	merged := append([]Track(nil), primaryTracks...)
+	byID := make(map[string]int, len(merged))
+	byRecording := make(map[string]int, len(merged))
+	for idx, track := range merged {
+		if key := videoIDKey(track); key != "" {
+			byID[key] = idx
+		}
+		if key := recordingKey(track); key != "" {
+			if _, ok := byRecording[key]; !ok {
+				byRecording[key] = idx
+			}
 		}
 	}
 
-	uniqueYTMusic := make([]Track, 0, len(ytMusicTracks))
-	for _, track := range ytMusicTracks {
-		if idx, ok := youtubeIndex[track.ID]; ok && track.ID != "" {
-			mergedYouTube[idx] = mergeTrackMetadata(mergedYouTube[idx], track)
+	unique := make([]Track, 0, len(secondaryTracks))
+	for _, track := range secondaryTracks {
+		idx, ok := 0, false
+		if key := videoIDKey(track); key != "" {
+			idx, ok = byID[key]
+		} else if key := recordingKey(track); key != "" {
+			idx, ok = byRecording[key]
+		}
+		if ok {
+			merged[idx] = mergeTrackMetadata(merged[idx], track)
 			continue
 		}
-		uniqueYTMusic = append(uniqueYTMusic, track)
+		unique = append(unique, track)
+	}
+
+	return merged, unique
+}
+
+// videoIDKey is the ID of a YouTube or YouTube Music track, which both
+// share, or empty for tracks from elsewhere.
+func videoIDKey(track Track) string {
+	if track.ID == "" || (track.Source != SourceYouTube && track.Source != SourceYTMusic) {
+		return ""
 	}
+	return track.ID
+}
+
+var (
+	bracketedPattern = regexp.MustCompile(`[(\[][^)\]]*[)\]]`)
+	nonWordPattern   = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+)
 
-	return mergedYouTube, uniqueYTMusic
+// recordingKey identifies a song by artist and title across catalogues.
+// Bracketed notes such as "(Official Video)" are ignored, and a title in
+// the "Artist - Title" form common on YouTube names its own artist.
+func recordingKey(track Track) string {
+	title := bracketedPattern.ReplaceAllString(strings.ToLower(track.Title), " ")
+	artist := strings.ToLower(track.Artist)
+	if before, after, ok := strings.Cut(title, " - "); ok {
+		artist, title = before, after
+	}
+	artist = strings.TrimSpace(nonWordPattern.ReplaceAllString(artist, " "))
+	title = strings.TrimSpace(nonWordPattern.ReplaceAllString(title, " "))
+	if artist == "" || title == "" {
+		return ""
+	}
+	return artist + "|" + title
 }
 
 func mergeTrackMetadata(primary Track, secondary Track) Track {
@@ -943,7 +969,7 @@ func trackFromResponse(resp ytDlpResponse) Track {
 		}
 	}
 
-	if thumbnail == "" && resp.ID != "" {
+	if thumbnail == "" && resp.ID != "" && isYouTubeURL(webpageURL) {
 		thumbnail = fmt.Sprintf("https://i.ytimg.com/vi/%s/hqdefault.jpg", resp.ID)
 	}
 
@@ -959,6 +985,15 @@ func trackFromResponse(resp ytDlpResponse) Track {
 	}
 }
 
+func isYouTubeURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	return host == "youtu.be" || host == "youtube.com" || strings.HasSuffix(host, ".youtube.com")
+}
+
 func durationFromResponse(resp ytDlpResponse) float64 {
 	if resp.Duration > 0 {
 		return resp.Duration
@@ -204,14 +204,15 @@ func TestSearchTypeaheadIgnoresSubsonicFailure(t *testing.T) {
 			}, nil
 		}),
 	}
-	r.subsonic = &SubsonicClient{
+	r.Register(&subsonicSource{client: &SubsonicClient{
+		cfg: openSubsonicConfig{LibraryID: "personal"},
 		httpClient: &http.Client{
 			Transport: roundTripFunc(func(*http.Request) (*http.Response, error) {
 				return nil, errors.New("dial tcp: connection refused")
 			}),
 		},
 		timeout: 20 * time.Millisecond,
-	}
+	}})
 
 	resultCh, err := r.Search(context.Background(), "test", SearchIntentTypeahead)
 	if err != nil {
@@ -228,7 +229,7 @@ func TestSearchTypeaheadIgnoresSubsonicFailure(t *testing.T) {
 		t.Fatalf("suggestions = %#v, want [\"test suggestion\"]", suggestionsBatch.Suggestions)
 	}
 
-	externalBatch := lastBatchForBucket(batches, SearchBucketExternal)
+	externalBatch := lastBatchForBucket(batches, ExternalBucket("personal"))
 	if len(externalBatch.Hits) != 0 {
 		t.Fatalf("external hits = %#v, want none", externalBatch.Hits)
 	}
@@ -261,9 +262,9 @@ func TestSearchTypeaheadSkipsRemoteSuggestionsForSingleRuneQuery(t *testing.T) {
 
 func TestSearchResultsEmitFixedBucketsAndMergeYTMusic(t *testing.T) {
 	r := newResolverWithVideoFixture(t)
-	r.subsonic = newFakeSubsonicClient([]subsonicSong{
+	r.Register(&subsonicSource{client: newFakeSubsonicClient([]subsonicSong{
 		{ID: "lib-1", Title: "Library Song", Artist: "Library Artist", Duration: 180},
-	})
+	})})
 
 	resultCh, err := r.Search(context.Background(), "test song", SearchIntentResults)
 	if err != nil {
@@ -272,7 +273,7 @@ func TestSearchResultsEmitFixedBucketsAndMergeYTMusic(t *testing.T) {
 
 	batches := collectSearchBatches(t, resultCh)
 
-	externalBatch := lastBatchForBucket(batches, SearchBucketExternal)
+	externalBatch := lastBatchForBucket(batches, ExternalBucket("personal"))
 	if !externalBatch.Complete {
 		t.Fatal("external batch should be complete")
 	}
@@ -315,8 +316,126 @@ func TestSearchResultsEmitFixedBucketsAndMergeYTMusic(t *testing.T) {
 	}
 }
 
+func TestSearchResultsMergeSoundCloudIntoYouTube(t *testing.T) {
+	r := newResolverWithVideoFixture(t)
+
+	resultCh, err := r.Search(context.Background(), "test song", SearchIntentResults)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	batches := collectSearchBatches(t, resultCh)
+
+	soundCloud := lastBatchForBucket(batches, SearchBucketSoundCloud)
+	if !soundCloud.Complete {
+		t.Fatal("soundcloud batch should be complete")
+	}
+	if len(soundCloud.Hits) != 1 || soundCloud.Hits[0].ID != "sc-2" {
+		t.Fatalf("soundcloud hits = %#v, want only the track YouTube did not find", soundCloud.Hits)
+	}
+	if soundCloud.Hits[0].Source != SourceSoundCloud || soundCloud.Hits[0].Thumbnail != "" {
+		t.Errorf("soundcloud hit = %#v", soundCloud.Hits[0])
+	}
+	if youtube := lastBatchForBucket(batches, SearchBucketYouTube); len(youtube.Hits) != 1 {
+		t.Errorf("youtube hits = %d, want 1", len(youtube.Hits))
+	}
+}
+
+func TestMergeTrackSources(t *testing.T) {
+	primary := []Track{
+		{ID: "v1", Title: "The Band - First Song (Official Video)", Artist: "TheBandVEVO", Source: SourceYouTube},
+		{ID: "v2", Title: "Second Song", Artist: "The Band", Source: SourceYouTube},
+	}
+	secondary := []Track{
+		{ID: "v2", Title: "Second Song", Artist: "The Band", Duration: 180, Source: SourceYTMusic},
+		{ID: "v3", Title: "First Song", Artist: "The Band", Source: SourceYTMusic},
+		{ID: "123", Title: "First Song", Artist: "The Band", Thumbnail: "https://img.example/sc.jpg", Source: SourceSoundCloud},
+		{ID: "456", Title: "Second Song [Remix]", Artist: "the band!", Source: SourceBandcamp},
+		{ID: "789", Title: "Third Song", Artist: "The Band", Source: SourceBandcamp},
+	}
+
+	merged, unique := mergeTrackSources(primary, secondary)
+	if merged[1].Duration != 180 {
+		t.Errorf("merged[1] = %+v, want YouTube Music metadata by video ID", merged[1])
+	}
+	if merged[0].Thumbnail != "https://img.example/sc.jpg" {
+		t.Errorf("merged[0] = %+v, want the SoundCloud track merged by artist and title", merged[0])
+	}
+
+	var ids []string
+	for _, track := range unique {
+		ids = append(ids, track.ID)
+	}
+	if got := strings.Join(ids, ","); got != "v3,789" {
+		t.Errorf("unique = %s, want v3,789", got)
+	}
+}
+
+func TestRecordingKey(t *testing.T) {
+	tests := []struct {
+		track Track
+		want  string
+	}{
+		{Track{Title: "Song", Artist: "Band"}, "band|song"},
+		{Track{Title: "Band - Song (Official Audio)", Artist: "BandVEVO"}, "band|song"},
+		{Track{Title: "Song [HD]", Artist: "Band!"}, "band|song"},
+		{Track{Title: "Song"}, ""},
+		{Track{Title: "(Intro)", Artist: "Band"}, ""},
+	}
+	for _, tt := range tests {
+		if got := recordingKey(tt.track); got != tt.want {
+			t.Errorf("recordingKey(%+v) = %q, want %q", tt.track, got, tt.want)
+		}
+	}
+}
+
+func TestSearchResultsEmitBucketPerLibrary(t *testing.T) {
+	r := newTestResolver(t)
+	navidrome := newFakeSubsonicClient([]subsonicSong{{ID: "nd-1", Title: "Navidrome Song"}})
+	navidrome.cfg.LibraryID = "navidrome"
+	navidrome.cfg.Label = "Navidrome"
+	gonic := newFakeSubsonicClient([]subsonicSong{{ID: "gc-1", Title: "Gonic Song"}})
+	gonic.cfg.LibraryID = "gonic"
+	gonic.cfg.BaseURL = "https://gonic.example.com"
+	r.Register(&subsonicSource{client: navidrome})
+	r.Register(&subsonicSource{client: gonic})
+
+	resultCh, err := r.Search(context.Background(), "song", SearchIntentResults)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	batches := collectSearchBatches(t, resultCh)
+
+	for _, tt := range []struct {
+		library, label, queueURL string
+	}{
+		{"navidrome", "Navidrome", "skaldi+subsonic://navidrome/nd-1"},
+		{"gonic", "", "skaldi+subsonic://gonic/gc-1"},
+	} {
+		batch := lastBatchForBucket(batches, ExternalBucket(tt.library))
+		if len(batch.Hits) != 1 || batch.Hits[0].QueueURL != tt.queueURL {
+			t.Fatalf("%s hits = %#v, want %s", tt.library, batch.Hits, tt.queueURL)
+		}
+		if batch.Label != tt.label {
+			t.Errorf("%s label = %q, want %q", tt.library, batch.Label, tt.label)
+		}
+	}
+
+	tracks, err := r.Resolve(context.Background(), "skaldi+subsonic://gonic/gc-1")
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if !strings.HasPrefix(tracks[0].URL, "https://gonic.example.com/") {
+		t.Errorf("stream URL = %q, want one from the gonic library", tracks[0].URL)
+	}
+	if _, err := r.Resolve(context.Background(), "skaldi+subsonic://elsewhere/1"); err == nil {
+		t.Error("Resolve should fail for an unknown library")
+	}
+}
+
 func TestSearchCacheCoalescesConcurrentLoads(t *testing.T) {
-	cache := newSearchCache[string](time.Minute, 4)
+	cache := newSearchCache[string](SearchBucketYouTube, time.Minute, 4)
+	hits := searchCacheLookups.Value(string(SearchBucketYouTube), "hit")
+	deduplicated := searchCacheLookups.Value(string(SearchBucketYouTube), "deduplicated")
 	var calls atomic.Int32
 
 	loader := func(ctx context.Context) (string, error) {
@@ -345,6 +464,16 @@ func TestSearchCacheCoalescesConcurrentLoads(t *testing.T) {
 	if calls.Load() != 1 {
 		t.Fatalf("loader calls = %d, want 1", calls.Load())
 	}
+
+	if _, err := cache.GetOrLoad(context.Background(), "same-key", loader); err != nil {
+		t.Fatalf("GetOrLoad failed: %v", err)
+	}
+	gotHits := searchCacheLookups.Value(string(SearchBucketYouTube), "hit") - hits
+	gotDeduplicated := searchCacheLookups.Value(string(SearchBucketYouTube), "deduplicated") - deduplicated
+	// A goroutine that starts after the load finished sees a hit instead.
+	if gotHits+gotDeduplicated != 4 || gotHits < 1 {
+		t.Errorf("hits = %v, deduplicated = %v, want 4 together including the final hit", gotHits, gotDeduplicated)
+	}
 }
 
 func collectSearchBatches(t *testing.T, ch <-chan SearchBatch) []SearchBatch {
@@ -378,6 +507,8 @@ func newTestResolver(t *testing.T) *Resolver {
 	if err != nil {
 		t.Fatalf("New failed: %v", err)
 	}
+	// Search Bandcamp too, without going to the network.
+	r.Register(newBandcampSource(cfg, "http://127.0.0.1:0/"))
 	return r
 }
 
@@ -393,6 +524,10 @@ case "$last" in
   ytsearch12:*)
     printf '%s\n' '{"id":"shared-1","title":"Test Song","uploader":"Loose Channel","webpage_url":"https://www.youtube.com/watch?v=shared-1","ie_key":"Youtube"}'
     ;;
+  scsearch12:*)
+    printf '%s\n' '{"id":"sc-1","title":"Test Song","uploader":"Precise Artist","duration":200,"webpage_url":"https://soundcloud.com/precise/test-song","ie_key":"Soundcloud"}'
+    printf '%s\n' '{"id":"sc-2","title":"Test Song (Live)","uploader":"Someone Else","webpage_url":"https://soundcloud.com/else/test-song-live","ie_key":"Soundcloud"}'
+    ;;
   https://music.youtube.com/search\?q=*)
     sleep 0.05
     printf '%s\n' '{"id":"shared-1","title":"Test Song","artist":"Precise Artist","duration":201,"thumbnail":"https://img.example/shared-1.jpg","webpage_url":"https://music.youtube.com/watch?v=shared-1","ie_key":"Youtube"}'
@@ -0,0 +1,256 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type Role string
+
+const (
+	RoleGuest Role = "guest"
+	RoleHost  Role = "host"
+
+	sessionCookieName = "skaldi_session"
+	maxLoginFailures  = 5
+	loginLockout      = time.Minute
+)
+
+type LoginRequest struct {
+	PIN string `json:"pin"`
+}
+
+type SessionInfo struct {
+	Role         Role  `json:"role"`
+	AuthRequired bool  `json:"auth_required"`
+	Guest        Guest `json:"guest"`
+}
+
+type session struct {
+	role      Role
+	expiresAt time.Time
+}
+
+// loginFailures counts wrong PINs from one remote host. It is forgotten
+// once the host is neither locked out nor has failed within loginLockout.
+type loginFailures struct {
+	count       int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+func (f *loginFailures) expired(now time.Time) bool {
+	return !now.Before(f.lockedUntil) && !now.Before(f.lastFailure.Add(loginLockout))
+}
+
+type Authenticator struct {
+	cfg authConfig
+	ttl time.Duration
+
+	// guestKey signs guest cookies.
+	guestKey []byte
+
+	mu       sync.Mutex
+	sessions map[string]session
+	failures map[string]*loginFailures
+}
+
+// NewAuthenticator returns an Authenticator that signs guest cookies with
+// guestKey, or with a key of its own when guestKey is nil.
+func NewAuthenticator(cfg authConfig, guestKey []byte) *Authenticator {
+	if guestKey == nil {
+		guestKey, _ = loadGuestKey("")
+	}
+	return &Authenticator{
+		cfg:      cfg,
+		guestKey: guestKey,
+		ttl:      time.Duration(cfg.SessionTTLHours) * time.Hour,
+		sessions: make(map[string]session),
+		failures: make(map[string]*loginFailures),
+	}
+}
+
+func (a *Authenticator) Enabled() bool {
+	return a != nil && a.cfg.Enabled
+}
+
+func (a *Authenticator) RoleFor(r *http.Request) Role {
+	if !a.Enabled() {
+		return RoleHost
+	}
+
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return RoleGuest
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	sess, ok := a.sessions[cookie.Value]
+	if !ok {
+		return RoleGuest
+	}
+	if time.Now().After(sess.expiresAt) {
+		delete(a.sessions, cookie.Value)
+		return RoleGuest
+	}
+	return sess.role
+}
+
+func (a *Authenticator) SessionInfo(r *http.Request) SessionInfo {
+	return SessionInfo{
+		Role:         a.RoleFor(r),
+		AuthRequired: a.Enabled(),
+		Guest:        a.guestFor(r),
+	}
+}
+
+func (a *Authenticator) login(remote, pin string) (string, time.Time, bool) {
+	now := time.Now()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for key, f := range a.failures {
+		if f.expired(now) {
+			delete(a.failures, key)
+		}
+	}
+	if f, ok := a.failures[remote]; ok && now.Before(f.lockedUntil) {
+		return "", time.Time{}, false
+	}
+
+	if subtle.ConstantTimeCompare([]byte(pin), []byte(a.cfg.HostPIN)) != 1 {
+		f, ok := a.failures[remote]
+		if !ok {
+			f = &loginFailures{}
+			a.failures[remote] = f
+		}
+		f.count++
+		f.lastFailure = now
+		if f.count >= maxLoginFailures {
+			f.count = 0
+			f.lockedUntil = now.Add(loginLockout)
+		}
+		return "", time.Time{}, false
+	}
+	delete(a.failures, remote)
+
+	token, err := newSessionToken()
+	if err != nil {
+		return "", time.Time{}, false
+	}
+
+	for key, sess := range a.sessions {
+		if now.After(sess.expiresAt) {
+			delete(a.sessions, key)
+		}
+	}
+
+	expiresAt := now.Add(a.ttl)
+	a.sessions[token] = session{role: RoleHost, expiresAt: expiresAt}
+	return token, expiresAt, true
+}
+
+func (a *Authenticator) logout(token string) {
+	a.mu.Lock()
+	delete(a.sessions, token)
+	a.mu.Unlock()
+}
+
+func newSessionToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (s *Server) requireHost(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.auth.RoleFor(r) != RoleHost {
+			http.Error(w, "Host access required", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if !s.auth.Enabled() {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(s.auth.SessionInfo(r))
+		return
+	}
+
+	var req LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	token, expiresAt, ok := s.auth.login(remoteHost(r), req.PIN)
+	if !ok {
+		s.logger.Warn("Rejected host login", "remote", remoteHost(r))
+		http.Error(w, "Invalid PIN", http.StatusUnauthorized)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expiresAt,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   r.TLS != nil,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(SessionInfo{Role: RoleHost, AuthRequired: true, Guest: s.auth.guestFor(r)})
+}
+
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		s.auth.logout(cookie.Value)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	info := SessionInfo{Role: RoleHost, Guest: s.auth.guestFor(r)}
+	if s.auth.Enabled() {
+		info = SessionInfo{Role: RoleGuest, AuthRequired: true, Guest: s.auth.guestFor(r)}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(info)
+}
+
+func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.auth.SessionInfo(r))
+}
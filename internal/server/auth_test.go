@@ -0,0 +1,215 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/reuski/skaldi/internal/bootstrap"
+	"github.com/reuski/skaldi/internal/player"
+	"github.com/reuski/skaldi/internal/resolver"
+)
+
+func setupAuthServer(t *testing.T) *Server {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &bootstrap.Config{
+		CacheDir:   t.TempDir(),
+		MpvSocket:  filepath.Join(t.TempDir(), "mpv.sock"),
+		ConfigPath: filepath.Join(t.TempDir(), "config.json"),
+	}
+	if err := os.WriteFile(cfg.ConfigPath, []byte(`{"auth":{"enabled":true,"host_pin":"2468"}}`), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	p := player.NewManager(cfg, logger)
+	r, err := resolver.New(cfg)
+	if err != nil {
+		t.Fatalf("resolver.New failed: %v", err)
+	}
+	s, err := New(cfg, logger, p, r, []byte("<html>Test</html>"), ListenOptions{})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return s
+}
+
+func TestNormalizeAuthConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     authConfig
+		wantErr bool
+		wantTTL int
+	}{
+		{name: "disabled", cfg: authConfig{}, wantTTL: 0},
+		{name: "default_ttl", cfg: authConfig{Enabled: true, HostPIN: "1234"}, wantTTL: defaultSessionTTLHours},
+		{name: "custom_ttl", cfg: authConfig{Enabled: true, HostPIN: "passphrase", SessionTTLHours: 2}, wantTTL: 2},
+		{name: "short_pin", cfg: authConfig{Enabled: true, HostPIN: "12"}, wantErr: true},
+		{name: "negative_ttl", cfg: authConfig{Enabled: true, HostPIN: "1234", SessionTTLHours: -1}, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := normalizeAuthConfig(tc.cfg)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("normalizeAuthConfig failed: %v", err)
+			}
+			if got.SessionTTLHours != tc.wantTTL {
+				t.Fatalf("SessionTTLHours = %d, want %d", got.SessionTTLHours, tc.wantTTL)
+			}
+		})
+	}
+}
+
+func TestNew_RejectsInvalidAuthConfig(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &bootstrap.Config{CacheDir: t.TempDir(), ConfigPath: filepath.Join(t.TempDir(), "config.json")}
+	if err := os.WriteFile(cfg.ConfigPath, []byte(`{"auth":{"enabled":true}}`), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	p := player.NewManager(cfg, logger)
+	r, err := resolver.New(cfg)
+	if err != nil {
+		t.Fatalf("resolver.New failed: %v", err)
+	}
+	if _, err := New(cfg, logger, p, r, nil, ListenOptions{}); err == nil {
+		t.Fatal("expected invalid auth config error")
+	}
+}
+
+func TestAuth_DisabledGrantsHost(t *testing.T) {
+	s, _ := setupTestServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/session", nil)
+	rr := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rr, req)
+
+	var info SessionInfo
+	if err := json.Unmarshal(rr.Body.Bytes(), &info); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if info.Role != RoleHost || info.AuthRequired {
+		t.Fatalf("session = %+v, want host without auth", info)
+	}
+}
+
+func TestAuth_GuestCannotControlPlayback(t *testing.T) {
+	s := setupAuthServer(t)
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodPost, "/playback", `{"action":"skip"}`},
+		{http.MethodPost, "/queue/move", `{"from":1,"to":0}`},
+		{http.MethodDelete, "/queue/0", ""},
+		{http.MethodPost, "/upload", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			rr := httptest.NewRecorder()
+			s.server.Handler.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusForbidden {
+				t.Fatalf("Status = %d, want %d", rr.Code, http.StatusForbidden)
+			}
+		})
+	}
+}
+
+func TestAuth_LoginGrantsHostSession(t *testing.T) {
+	s := setupAuthServer(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(`{"pin":"0000"}`))
+	rr := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong PIN status = %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(`{"pin":"2468"}`))
+	rr = httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("login status = %d, want %d", rr.Code, http.StatusOK)
+	}
+
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != sessionCookieName || !cookies[0].HttpOnly {
+		t.Fatalf("cookies = %+v, want one HttpOnly session cookie", cookies)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/auth/session", nil)
+	req.AddCookie(cookies[0])
+	if role := s.auth.RoleFor(req); role != RoleHost {
+		t.Fatalf("role = %q, want %q", role, RoleHost)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/playback", strings.NewReader(`{"action":"bogus"}`))
+	req.AddCookie(cookies[0])
+	rr = httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("host playback status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+	req.AddCookie(cookies[0])
+	s.server.Handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest(http.MethodGet, "/auth/session", nil)
+	req.AddCookie(cookies[0])
+	if role := s.auth.RoleFor(req); role != RoleGuest {
+		t.Fatalf("role after logout = %q, want %q", role, RoleGuest)
+	}
+}
+
+func TestAuth_LocksOutRepeatedFailures(t *testing.T) {
+	a := NewAuthenticator(authConfig{Enabled: true, HostPIN: "2468", SessionTTLHours: 1}, nil)
+
+	for range maxLoginFailures {
+		if _, _, ok := a.login("10.0.0.9", "0000"); ok {
+			t.Fatal("wrong PIN accepted")
+		}
+	}
+	if _, _, ok := a.login("10.0.0.9", "2468"); ok {
+		t.Fatal("correct PIN accepted during lockout")
+	}
+	if _, _, ok := a.login("10.0.0.10", "2468"); !ok {
+		t.Fatal("lockout should be per remote address")
+	}
+}
+
+func TestAuth_ForgetsOldFailures(t *testing.T) {
+	a := NewAuthenticator(authConfig{Enabled: true, HostPIN: "2468", SessionTTLHours: 1}, nil)
+	past := time.Now().Add(-2 * loginLockout)
+	a.failures["10.0.0.1"] = &loginFailures{count: 2, lastFailure: past}
+	a.failures["10.0.0.2"] = &loginFailures{lastFailure: past, lockedUntil: past.Add(loginLockout)}
+	a.failures["10.0.0.3"] = &loginFailures{lockedUntil: time.Now().Add(loginLockout)}
+
+	if _, _, ok := a.login("10.0.0.9", "0000"); ok {
+		t.Fatal("wrong PIN accepted")
+	}
+	if len(a.failures) != 2 || a.failures["10.0.0.3"] == nil || a.failures["10.0.0.9"] == nil {
+		t.Errorf("failures = %v, want only the locked out and the new host", a.failures)
+	}
+}
@@ -0,0 +1,101 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/reuski/skaldi/internal/player"
+	"github.com/reuski/skaldi/internal/resolver"
+)
+
+const (
+	autoplayTimeout  = 30 * time.Second
+	maxAutoplaySeeds = 3
+	// autoplayOverfetch leaves room for related tracks that already played.
+	autoplayOverfetch = 3
+)
+
+func (s *Server) runAutoplay() {
+	for range s.player.QueueDrained {
+		if !s.autoplay.Enabled {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), autoplayTimeout)
+		s.startRadio(ctx)
+		cancel()
+	}
+}
+
+// startRadio queues tracks related to what just played, trying the most
+// recent seeds first until one yields something new.
+func (s *Server) startRadio(ctx context.Context) {
+	snap := s.player.State.Snapshot()
+	seen := queuedURLs(snap)
+
+	for _, seed := range autoplaySeeds(snap, s.resolver.HasRelated) {
+		related, err := s.resolver.Related(ctx, seed, s.autoplay.Tracks*autoplayOverfetch)
+		if err != nil {
+			s.logger.Warn("Autoplay could not find related tracks", "seed", seed.Title, "error", err)
+			continue
+		}
+
+		picks := pickAutoplayTracks(related, seen, s.autoplay.Tracks)
+		if len(picks) == 0 {
+			continue
+		}
+
+		// Someone may have queued a track while we were resolving; then the
+		// room is not silent any more.
+		if s.player.State.Snapshot().Status != player.StatusIdle {
+			return
+		}
+
+		outcome := s.queueTracks(picks, unlimitedQuota)
+		s.logger.Info("Autoplay queued related tracks", "seed", seed.Title, "tracks", len(outcome.queued))
+		return
+	}
+}
+
+// autoplaySeeds returns up to maxAutoplaySeeds recently played tracks that
+// hasRelated can find related material for, most recent first.
+func autoplaySeeds(snap player.Snapshot, hasRelated func(source string) bool) []resolver.Track {
+	var seeds []resolver.Track
+	for i := len(snap.History) - 1; i >= 0 && len(seeds) < maxAutoplaySeeds; i-- {
+		meta := snap.History[i].Metadata
+		if meta == nil {
+			continue
+		}
+		if hasRelated(meta.Source) {
+			seeds = append(seeds, *meta)
+		}
+	}
+	return seeds
+}
+
+func queuedURLs(snap player.Snapshot) map[string]struct{} {
+	seen := make(map[string]struct{}, len(snap.Queue)+len(snap.History))
+	for _, items := range [][]player.QueueItem{snap.Queue, snap.History} {
+		for _, item := range items {
+			seen[item.Filename] = struct{}{}
+		}
+	}
+	return seen
+}
+
+func pickAutoplayTracks(related []resolver.Track, seen map[string]struct{}, limit int) []resolver.Track {
+	picks := make([]resolver.Track, 0, limit)
+	for _, track := range related {
+		if len(picks) == limit {
+			break
+		}
+		if _, ok := seen[track.WebpageURL]; ok {
+			continue
+		}
+		seen[track.WebpageURL] = struct{}{}
+		track.Autoplay = true
+		picks = append(picks, track)
+	}
+	return picks
+}
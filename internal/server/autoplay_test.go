@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"testing"
+
+	"github.com/reuski/skaldi/internal/player"
+	"github.com/reuski/skaldi/internal/resolver"
+)
+
+func TestAutoplaySeeds(t *testing.T) {
+	snap := player.Snapshot{
+		History: []player.QueueItem{
+			{Filename: "https://youtu.be/a", Metadata: &resolver.Track{ID: "a", Source: resolver.SourceYouTube}},
+			{Filename: "/tmp/upload.mp3", Metadata: &resolver.Track{Title: "upload.mp3"}},
+			{Filename: "skaldi+subsonic://lib/track/b", Metadata: &resolver.Track{ID: "b", Source: resolver.SourceSubsonic}},
+			{Filename: "https://example.com/stream"},
+		},
+	}
+
+	hasRelated := func(source string) bool {
+		return source == resolver.SourceYouTube || source == resolver.SourceSubsonic
+	}
+	seeds := autoplaySeeds(snap, hasRelated)
+	if len(seeds) != 2 {
+		t.Fatalf("len(seeds) = %d, want 2", len(seeds))
+	}
+	if seeds[0].ID != "b" || seeds[1].ID != "a" {
+		t.Errorf("seeds = %q, %q; want most recent first", seeds[0].ID, seeds[1].ID)
+	}
+}
+
+func TestPickAutoplayTracks(t *testing.T) {
+	snap := player.Snapshot{
+		Queue:   []player.QueueItem{{Filename: "https://www.youtube.com/watch?v=queued"}},
+		History: []player.QueueItem{{Filename: "https://www.youtube.com/watch?v=played"}},
+	}
+	related := []resolver.Track{
+		{ID: "played", WebpageURL: "https://www.youtube.com/watch?v=played"},
+		{ID: "new1", WebpageURL: "https://www.youtube.com/watch?v=new1"},
+		{ID: "queued", WebpageURL: "https://www.youtube.com/watch?v=queued"},
+		{ID: "new1", WebpageURL: "https://www.youtube.com/watch?v=new1"},
+		{ID: "new2", WebpageURL: "https://www.youtube.com/watch?v=new2"},
+		{ID: "new3", WebpageURL: "https://www.youtube.com/watch?v=new3"},
+	}
+
+	picks := pickAutoplayTracks(related, queuedURLs(snap), 2)
+	if len(picks) != 2 {
+		t.Fatalf("len(picks) = %d, want 2", len(picks))
+	}
+	for i, want := range []string{"new1", "new2"} {
+		if picks[i].ID != want {
+			t.Errorf("picks[%d] = %q, want %q", i, picks[i].ID, want)
+		}
+		if !picks[i].Autoplay {
+			t.Errorf("picks[%d] should be marked autoplay", i)
+		}
+	}
+}
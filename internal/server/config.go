@@ -0,0 +1,272 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/reuski/skaldi/internal/cron"
+)
+
+const (
+	defaultSessionTTLHours = 12
+	minHostPINLength       = 4
+	defaultPort            = 8080
+	defaultAutoplayTracks  = 3
+	maxAutoplayTracks      = 10
+)
+
+type appConfig struct {
+	Auth       authConfig       `json:"auth"`
+	Listen     listenConfig     `json:"listen"`
+	Autoplay   autoplayConfig   `json:"autoplay"`
+	Schedule   scheduleConfig   `json:"schedule"`
+	Duplicates duplicatesConfig `json:"duplicates"`
+	Quotas     quotaConfig      `json:"quotas"`
+}
+
+// quotaConfig caps what a single guest can queue. Zero means no cap.
+type quotaConfig struct {
+	MaxUpcoming int `json:"max_upcoming"`
+	MaxPerHour  int `json:"max_per_hour"`
+}
+
+type duplicatesConfig struct {
+	Policy        string `json:"policy"`
+	WindowMinutes int    `json:"window_minutes"`
+}
+
+type autoplayConfig struct {
+	Enabled bool `json:"enabled"`
+	Tracks  int  `json:"tracks"`
+}
+
+type scheduleConfig struct {
+	// Playlists names lists of URLs that play rules can start.
+	Playlists map[string][]string `json:"playlists"`
+	Rules     []scheduleRule      `json:"rules"`
+}
+
+type scheduleRule struct {
+	Name      string  `json:"name"`
+	Cron      string  `json:"cron"`
+	Action    string  `json:"action"`
+	URL       string  `json:"url,omitempty"`
+	Playlist  string  `json:"playlist,omitempty"`
+	MaxVolume float64 `json:"max_volume,omitempty"`
+
+	schedule cron.Schedule
+}
+
+type listenConfig struct {
+	Address string    `json:"address"`
+	Port    int       `json:"port"`
+	TLS     tlsConfig `json:"tls"`
+}
+
+type tlsConfig struct {
+	CertFile   string `json:"cert_file"`
+	KeyFile    string `json:"key_file"`
+	SelfSigned bool   `json:"self_signed"`
+}
+
+// ListenOptions carries command-line overrides for the listen block of
+// config.json. Zero values leave the config file setting in place.
+type ListenOptions struct {
+	Address    string
+	Port       int
+	CertFile   string
+	KeyFile    string
+	SelfSigned bool
+}
+
+type authConfig struct {
+	Enabled         bool   `json:"enabled"`
+	HostPIN         string `json:"host_pin"`
+	SessionTTLHours int    `json:"session_ttl_hours"`
+}
+
+func loadAppConfig(path string) (appConfig, error) {
+	var cfg appConfig
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return cfg, nil
+		}
+		return cfg, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	if strings.TrimSpace(string(data)) == "" {
+		return cfg, nil
+	}
+
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid config JSON at %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// normalize applies the command-line listen overrides, checks every block
+// and fills in defaults.
+func (cfg appConfig) normalize(opts ListenOptions) (appConfig, error) {
+	var err error
+	if cfg.Auth, err = normalizeAuthConfig(cfg.Auth); err != nil {
+		return cfg, err
+	}
+	if cfg.Listen, err = normalizeListenConfig(opts.apply(cfg.Listen)); err != nil {
+		return cfg, err
+	}
+	if cfg.Autoplay, err = normalizeAutoplayConfig(cfg.Autoplay); err != nil {
+		return cfg, err
+	}
+	if cfg.Schedule, err = normalizeScheduleConfig(cfg.Schedule); err != nil {
+		return cfg, err
+	}
+	if cfg.Duplicates, err = normalizeDuplicatesConfig(cfg.Duplicates); err != nil {
+		return cfg, err
+	}
+	if cfg.Quotas, err = normalizeQuotaConfig(cfg.Quotas); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+func normalizeDuplicatesConfig(cfg duplicatesConfig) (duplicatesConfig, error) {
+	switch cfg.Policy {
+	case "":
+		cfg.Policy = duplicatesAllow
+	case duplicatesAllow, duplicatesReject, duplicatesMerge:
+	default:
+		return cfg, fmt.Errorf("duplicates config: policy must be allow, reject or merge")
+	}
+	if cfg.WindowMinutes < 0 || cfg.WindowMinutes > maxDuplicateWindowMinutes {
+		return cfg, fmt.Errorf("duplicates config: window_minutes must be between 1 and %d, or 0 for the default", maxDuplicateWindowMinutes)
+	}
+	if cfg.WindowMinutes == 0 {
+		cfg.WindowMinutes = defaultDuplicateWindowMinutes
+	}
+	return cfg, nil
+}
+
+func normalizeQuotaConfig(cfg quotaConfig) (quotaConfig, error) {
+	if cfg.MaxUpcoming < 0 {
+		return cfg, fmt.Errorf("quotas config: max_upcoming must be >= 0")
+	}
+	if cfg.MaxPerHour < 0 {
+		return cfg, fmt.Errorf("quotas config: max_per_hour must be >= 0")
+	}
+	return cfg, nil
+}
+
+func normalizeAutoplayConfig(cfg autoplayConfig) (autoplayConfig, error) {
+	if cfg.Tracks < 0 || cfg.Tracks > maxAutoplayTracks {
+		return cfg, fmt.Errorf("autoplay config: tracks must be between 1 and %d, or 0 for the default", maxAutoplayTracks)
+	}
+	if cfg.Tracks == 0 {
+		cfg.Tracks = defaultAutoplayTracks
+	}
+	return cfg, nil
+}
+
+// normalizeScheduleConfig compiles every rule's cron expression. Unless a
+// clear rule is configured, the playlist is cleared at midnight as before.
+func normalizeScheduleConfig(cfg scheduleConfig) (scheduleConfig, error) {
+	hasClear := false
+	rules := make([]scheduleRule, 0, len(cfg.Rules)+1)
+	for i, rule := range cfg.Rules {
+		if rule.Name == "" {
+			rule.Name = rule.Action
+		}
+		sched, err := cron.Parse(rule.Cron)
+		if err != nil {
+			return cfg, fmt.Errorf("schedule config: rule %d: %w", i+1, err)
+		}
+		rule.schedule = sched
+
+		switch rule.Action {
+		case scheduleCapVolume:
+			if rule.MaxVolume < 1 || rule.MaxVolume > 100 {
+				return cfg, fmt.Errorf("schedule config: rule %d: max_volume must be between 1 and 100", i+1)
+			}
+		case schedulePlay:
+			if (rule.URL == "") == (rule.Playlist == "") {
+				return cfg, fmt.Errorf("schedule config: rule %d: play needs either url or playlist", i+1)
+			}
+			if rule.Playlist != "" && len(cfg.Playlists[rule.Playlist]) == 0 {
+				return cfg, fmt.Errorf("schedule config: rule %d: unknown playlist %q", i+1, rule.Playlist)
+			}
+		case schedulePause:
+		case scheduleClear:
+			hasClear = true
+		default:
+			return cfg, fmt.Errorf("schedule config: rule %d: unknown action %q", i+1, rule.Action)
+		}
+		rules = append(rules, rule)
+	}
+
+	if !hasClear {
+		rule := scheduleRule{Name: "daily clear", Cron: defaultClearCron, Action: scheduleClear}
+		rule.schedule, _ = cron.Parse(rule.Cron)
+		rules = append(rules, rule)
+	}
+	cfg.Rules = rules
+	return cfg, nil
+}
+
+func normalizeAuthConfig(cfg authConfig) (authConfig, error) {
+	if !cfg.Enabled {
+		return cfg, nil
+	}
+	if len(cfg.HostPIN) < minHostPINLength {
+		return cfg, fmt.Errorf("auth config: host_pin must be at least %d characters when enabled", minHostPINLength)
+	}
+	if cfg.SessionTTLHours < 0 {
+		return cfg, fmt.Errorf("auth config: session_ttl_hours must be >= 0")
+	}
+	if cfg.SessionTTLHours == 0 {
+		cfg.SessionTTLHours = defaultSessionTTLHours
+	}
+	return cfg, nil
+}
+
+func (o ListenOptions) apply(cfg listenConfig) listenConfig {
+	if o.Address != "" {
+		cfg.Address = o.Address
+	}
+	if o.Port != 0 {
+		cfg.Port = o.Port
+	}
+	if o.CertFile != "" || o.KeyFile != "" {
+		cfg.TLS = tlsConfig{CertFile: o.CertFile, KeyFile: o.KeyFile}
+	}
+	if o.SelfSigned {
+		cfg.TLS = tlsConfig{SelfSigned: true}
+	}
+	return cfg
+}
+
+func normalizeListenConfig(cfg listenConfig) (listenConfig, error) {
+	if cfg.Port < 0 || cfg.Port > 65535 {
+		return cfg, fmt.Errorf("listen config: port must be between 1 and 65535")
+	}
+	if cfg.Port == 0 {
+		cfg.Port = defaultPort
+	}
+	if cfg.Address != "" && net.ParseIP(cfg.Address) == nil {
+		return cfg, fmt.Errorf("listen config: address must be an IP address")
+	}
+	if (cfg.TLS.CertFile == "") != (cfg.TLS.KeyFile == "") {
+		return cfg, fmt.Errorf("listen config: tls cert_file and key_file must be set together")
+	}
+	if cfg.TLS.SelfSigned && cfg.TLS.CertFile != "" {
+		return cfg, fmt.Errorf("listen config: tls self_signed cannot be combined with cert_file")
+	}
+	return cfg, nil
+}
@@ -0,0 +1,205 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestNormalizeListenConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      listenConfig
+		wantErr  bool
+		wantPort int
+	}{
+		{name: "defaults", cfg: listenConfig{}, wantPort: defaultPort},
+		{name: "custom", cfg: listenConfig{Address: "127.0.0.1", Port: 9000}, wantPort: 9000},
+		{name: "ipv6", cfg: listenConfig{Address: "::1"}, wantPort: defaultPort},
+		{name: "tls_pair", cfg: listenConfig{TLS: tlsConfig{CertFile: "c.pem", KeyFile: "k.pem"}}, wantPort: defaultPort},
+		{name: "bad_port", cfg: listenConfig{Port: 70000}, wantErr: true},
+		{name: "hostname_address", cfg: listenConfig{Address: "skaldi.local"}, wantErr: true},
+		{name: "cert_without_key", cfg: listenConfig{TLS: tlsConfig{CertFile: "c.pem"}}, wantErr: true},
+		{name: "self_signed_and_cert", cfg: listenConfig{TLS: tlsConfig{CertFile: "c.pem", KeyFile: "k.pem", SelfSigned: true}}, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := normalizeListenConfig(tc.cfg)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Port != tc.wantPort {
+				t.Errorf("Port = %d, want %d", got.Port, tc.wantPort)
+			}
+		})
+	}
+}
+
+func TestListenOptions_Apply(t *testing.T) {
+	fileCfg := listenConfig{
+		Address: "0.0.0.0",
+		Port:    9000,
+		TLS:     tlsConfig{SelfSigned: true},
+	}
+
+	got := ListenOptions{}.apply(fileCfg)
+	if got != fileCfg {
+		t.Errorf("empty options changed config: %+v", got)
+	}
+
+	got = ListenOptions{Port: 8443, CertFile: "c.pem", KeyFile: "k.pem"}.apply(fileCfg)
+	if got.Address != "0.0.0.0" {
+		t.Errorf("Address = %q, want config value", got.Address)
+	}
+	if got.Port != 8443 {
+		t.Errorf("Port = %d, want 8443", got.Port)
+	}
+	if got.TLS.SelfSigned || got.TLS.CertFile != "c.pem" {
+		t.Errorf("TLS = %+v, want flag certificate to replace self_signed", got.TLS)
+	}
+}
+
+func TestNormalizeAutoplayConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        autoplayConfig
+		wantErr    bool
+		wantTracks int
+	}{
+		{name: "defaults", cfg: autoplayConfig{Enabled: true}, wantTracks: defaultAutoplayTracks},
+		{name: "custom", cfg: autoplayConfig{Enabled: true, Tracks: 5}, wantTracks: 5},
+		{name: "most", cfg: autoplayConfig{Enabled: true, Tracks: maxAutoplayTracks}, wantTracks: maxAutoplayTracks},
+		{name: "negative", cfg: autoplayConfig{Tracks: -1}, wantErr: true},
+		{name: "too_many", cfg: autoplayConfig{Tracks: maxAutoplayTracks + 1}, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := normalizeAutoplayConfig(tc.cfg)
+			if tc.wantErr {
+				want := fmt.Sprintf("autoplay config: tracks must be between 1 and %d, or 0 for the default", maxAutoplayTracks)
+				if err == nil || err.Error() != want {
+					t.Fatalf("err = %v, want %q", err, want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Tracks != tc.wantTracks {
+				t.Errorf("Tracks = %d, want %d", got.Tracks, tc.wantTracks)
+			}
+		})
+	}
+}
+
+func TestNormalizeScheduleConfig(t *testing.T) {
+	playlists := map[string][]string{"morning": {"https://example.com/a"}}
+
+	tests := []struct {
+		name      string
+		rules     []scheduleRule
+		wantErr   bool
+		wantRules int
+	}{
+		{name: "empty_adds_midnight_clear", wantRules: 1},
+		{name: "own_clear", rules: []scheduleRule{{Cron: "0 4 * * *", Action: scheduleClear}}, wantRules: 1},
+		{name: "quiet_hours", rules: []scheduleRule{{Cron: "* 22-23,0-6 * * *", Action: scheduleCapVolume, MaxVolume: 30}}, wantRules: 2},
+		{name: "play_playlist", rules: []scheduleRule{{Cron: "30 7 * * 1-5", Action: schedulePlay, Playlist: "morning"}}, wantRules: 2},
+		{name: "bad_cron", rules: []scheduleRule{{Cron: "0 25 * * *", Action: schedulePause}}, wantErr: true},
+		{name: "unknown_action", rules: []scheduleRule{{Cron: "0 1 * * *", Action: "dance"}}, wantErr: true},
+		{name: "cap_without_volume", rules: []scheduleRule{{Cron: "* 22 * * *", Action: scheduleCapVolume}}, wantErr: true},
+		{name: "play_without_target", rules: []scheduleRule{{Cron: "0 7 * * *", Action: schedulePlay}}, wantErr: true},
+		{name: "play_unknown_playlist", rules: []scheduleRule{{Cron: "0 7 * * *", Action: schedulePlay, Playlist: "evening"}}, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := normalizeScheduleConfig(scheduleConfig{Playlists: playlists, Rules: tc.rules})
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(got.Rules) != tc.wantRules {
+				t.Fatalf("len(Rules) = %d, want %d", len(got.Rules), tc.wantRules)
+			}
+			for _, rule := range got.Rules {
+				if rule.Name == "" {
+					t.Errorf("rule %+v has no name", rule)
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizeDuplicatesConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        duplicatesConfig
+		wantErr    bool
+		wantPolicy string
+		wantWindow int
+	}{
+		{name: "defaults", wantPolicy: duplicatesAllow, wantWindow: defaultDuplicateWindowMinutes},
+		{name: "merge", cfg: duplicatesConfig{Policy: duplicatesMerge, WindowMinutes: 10}, wantPolicy: duplicatesMerge, wantWindow: 10},
+		{name: "unknown_policy", cfg: duplicatesConfig{Policy: "ignore"}, wantErr: true},
+		{name: "window_too_long", cfg: duplicatesConfig{Policy: duplicatesReject, WindowMinutes: maxDuplicateWindowMinutes + 1}, wantErr: true},
+		{name: "negative_window", cfg: duplicatesConfig{WindowMinutes: -1}, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := normalizeDuplicatesConfig(tc.cfg)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Policy != tc.wantPolicy || got.WindowMinutes != tc.wantWindow {
+				t.Errorf("got %+v, want policy %q window %d", got, tc.wantPolicy, tc.wantWindow)
+			}
+		})
+	}
+}
+
+func TestAppConfig_Normalize(t *testing.T) {
+	got, err := appConfig{}.normalize(ListenOptions{Port: 8443})
+	if err != nil {
+		t.Fatalf("normalize failed: %v", err)
+	}
+	if got.Listen.Port != 8443 {
+		t.Errorf("Port = %d, want the flag override", got.Listen.Port)
+	}
+	if got.Autoplay.Tracks != defaultAutoplayTracks {
+		t.Errorf("Autoplay.Tracks = %d, want %d", got.Autoplay.Tracks, defaultAutoplayTracks)
+	}
+	if got.Duplicates.Policy != duplicatesAllow || got.Duplicates.WindowMinutes != defaultDuplicateWindowMinutes {
+		t.Errorf("Duplicates = %+v, want the defaults", got.Duplicates)
+	}
+	if len(got.Schedule.Rules) != 1 {
+		t.Errorf("Schedule.Rules = %+v, want the midnight clear", got.Schedule.Rules)
+	}
+
+	_, err = appConfig{Duplicates: duplicatesConfig{WindowMinutes: -5}}.normalize(ListenOptions{})
+	want := fmt.Sprintf("duplicates config: window_minutes must be between 1 and %d, or 0 for the default", maxDuplicateWindowMinutes)
+	if err == nil || err.Error() != want {
+		t.Errorf("err = %v, want %q", err, want)
+	}
+}
@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"time"
+
+	"github.com/reuski/skaldi/internal/player"
+	"github.com/reuski/skaldi/internal/resolver"
+)
+
+const (
+	duplicatesAllow  = "allow"
+	duplicatesReject = "reject"
+	duplicatesMerge  = "merge"
+
+	defaultDuplicateWindowMinutes = 60
+	maxDuplicateWindowMinutes     = 24 * 60
+
+	reasonAlreadyQueued  = "already_queued"
+	reasonRecentlyPlayed = "recently_played"
+)
+
+type queueRejection struct {
+	Title  string `json:"title"`
+	Reason string `json:"reason"`
+}
+
+// duplicateChecker finds requests for tracks that are playing, upcoming,
+// or played within the configured window.
+type duplicateChecker struct {
+	cfg     duplicatesConfig
+	state   *player.State
+	pending map[string]player.QueueItem
+}
+
+func (s *Server) newDuplicateChecker() *duplicateChecker {
+	c := &duplicateChecker{cfg: s.duplicates, state: s.player.State}
+	if c.cfg.Policy == duplicatesAllow {
+		return c
+	}
+
+	snap := s.player.State.Snapshot()
+	c.pending = make(map[string]player.QueueItem, len(snap.Upcoming)+1)
+	if snap.NowPlaying != nil {
+		c.pending[snap.NowPlaying.DedupKey()] = *snap.NowPlaying
+	}
+	for _, item := range snap.Upcoming {
+		c.pending[item.DedupKey()] = item
+	}
+	return c
+}
+
+// check returns the reason track should not be queued again, and the queue
+// item it duplicates when there is one. An empty reason means go ahead.
+func (c *duplicateChecker) check(track resolver.Track) (string, *player.QueueItem) {
+	if c.cfg.Policy == duplicatesAllow {
+		return "", nil
+	}
+
+	key := queueKey(track)
+	if item, ok := c.pending[key]; ok {
+		return reasonAlreadyQueued, &item
+	}
+	if c.state.PlayedWithin(key, time.Duration(c.cfg.WindowMinutes)*time.Minute) {
+		return reasonRecentlyPlayed, nil
+	}
+	return "", nil
+}
+
+// added records a newly queued track. Its mpv ID is not known yet, so a
+// repeat within the same request is rejected rather than merged.
+func (c *duplicateChecker) added(track resolver.Track) {
+	if c.pending != nil {
+		c.pending[queueKey(track)] = player.QueueItem{}
+	}
+}
+
+func queueKey(track resolver.Track) string {
+	if key := track.DedupKey(); key != "" {
+		return key
+	}
+	return track.PlayableURL()
+}
+
+func duplicateMessage(reason string) string {
+	if reason == reasonRecentlyPlayed {
+		return "Played recently"
+	}
+	return "Already in the queue"
+}
@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/reuski/skaldi/internal/player"
+	"github.com/reuski/skaldi/internal/resolver"
+)
+
+const duplicateTestURL = "https://www.youtube.com/watch?v=abc"
+
+// setupPlayingServer returns a server whose player is playing one track,
+// with the given duplicates policy.
+func setupPlayingServer(t *testing.T, policy string) (*Server, *player.Manager) {
+	t.Helper()
+	s, p := setupTestServer(t)
+	s.duplicates = duplicatesConfig{Policy: policy, WindowMinutes: defaultDuplicateWindowMinutes}
+
+	p.State.StoreMetadata(duplicateTestURL, resolver.Track{ID: "abc", Title: "Song", Source: resolver.SourceYouTube, WebpageURL: duplicateTestURL})
+	p.State.SetIdle(false)
+	p.State.SetPlaylist([]player.MpvPlaylistEntry{{Filename: duplicateTestURL, ID: 7}})
+	p.State.SetPlaylistPos(0)
+	return s, p
+}
+
+func duplicateHit() QueueRequest {
+	return QueueRequest{Hits: []resolver.SearchHit{{
+		ID:       "abc",
+		Source:   resolver.SourceYouTube,
+		Title:    "Song",
+		QueueURL: duplicateTestURL,
+	}}}
+}
+
+func TestDuplicateChecker(t *testing.T) {
+	track := resolver.Track{ID: "abc", Source: resolver.SourceYouTube, WebpageURL: duplicateTestURL}
+	other := resolver.Track{ID: "xyz", Source: resolver.SourceYouTube, WebpageURL: "https://www.youtube.com/watch?v=xyz"}
+
+	s, p := setupPlayingServer(t, duplicatesReject)
+	dups := s.newDuplicateChecker()
+
+	if reason, item := dups.check(track); reason != reasonAlreadyQueued || item == nil || item.ID != 7 {
+		t.Errorf("check(playing) = %q, %+v, want %q for item 7", reason, item, reasonAlreadyQueued)
+	}
+	if reason, _ := dups.check(other); reason != "" {
+		t.Errorf("check(other) = %q, want no reason", reason)
+	}
+	dups.added(other)
+	if reason, _ := dups.check(other); reason != reasonAlreadyQueued {
+		t.Errorf("check(other) after added = %q, want %q", reason, reasonAlreadyQueued)
+	}
+
+	// Once the queue has moved on, the track counts as recently played.
+	p.State.ResetPlayback()
+	if reason, _ := s.newDuplicateChecker().check(track); reason != reasonRecentlyPlayed {
+		t.Errorf("check(played) = %q, want %q", reason, reasonRecentlyPlayed)
+	}
+
+	s.duplicates.Policy = duplicatesAllow
+	if reason, _ := s.newDuplicateChecker().check(track); reason != "" {
+		t.Errorf("check with allow = %q, want no reason", reason)
+	}
+}
+
+func TestQueue_DuplicateRejected(t *testing.T) {
+	s, _ := setupPlayingServer(t, duplicatesReject)
+
+	_, err := s.queue(context.Background(), duplicateHit(), requester{})
+	if got := commandStatus(err); got != http.StatusConflict {
+		t.Errorf("status = %d, want %d (err %v)", got, http.StatusConflict, err)
+	}
+}
+
+func TestQueue_DuplicateMerged(t *testing.T) {
+	s, p := setupPlayingServer(t, duplicatesMerge)
+
+	result, err := s.queue(context.Background(), duplicateHit(), requester{})
+	if err != nil {
+		t.Fatalf("queue failed: %v", err)
+	}
+	if result.Status != "merged" || result.Merged != 1 || result.Count != 0 {
+		t.Errorf("result = %+v, want one merged request", result)
+	}
+	if np := p.State.Snapshot().NowPlaying; np == nil || np.Votes != 1 {
+		t.Errorf("NowPlaying = %+v, want 1 vote", np)
+	}
+}
@@ -0,0 +1,189 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	guestCookieName    = "skaldi_guest"
+	nicknameCookieName = "skaldi_nickname"
+	guestCookieMaxAge  = 365 * 24 * 60 * 60
+	maxNicknameLength  = 32
+	publicGuestIDBytes = 6
+	guestKeyBytes      = 32
+)
+
+type NicknameRequest struct {
+	Nickname string `json:"nickname"`
+}
+
+// Guest is who queued a track. The ID is derived from the browser's guest
+// cookie, or from the remote address for clients without one, so it can be
+// shown to everyone without handing out the cookie itself. Guest cookies
+// are signed, so a client cannot pick its own identity.
+type Guest struct {
+	ID       string `json:"id"`
+	Nickname string `json:"nickname,omitempty"`
+}
+
+func (a *Authenticator) guestFor(r *http.Request) Guest {
+	var guest Guest
+	if token, ok := a.guestToken(r); ok {
+		guest.ID = publicGuestID("cookie:" + token)
+	} else {
+		guest.ID = publicGuestID("addr:" + remoteHost(r))
+	}
+	if cookie, err := r.Cookie(nicknameCookieName); err == nil {
+		if name, err := url.QueryUnescape(cookie.Value); err == nil {
+			guest.Nickname = cleanNickname(name)
+		}
+	}
+	return guest
+}
+
+func publicGuestID(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:publicGuestIDBytes])
+}
+
+// guestToken returns the token of r's guest cookie. Cookies this server did
+// not sign count as missing.
+func (a *Authenticator) guestToken(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(guestCookieName)
+	if err != nil {
+		return "", false
+	}
+	token, _, ok := strings.Cut(cookie.Value, ".")
+	if !ok || token == "" || !hmac.Equal([]byte(cookie.Value), []byte(a.signGuestToken(token))) {
+		return "", false
+	}
+	return token, true
+}
+
+// signGuestToken returns the guest cookie value for token.
+func (a *Authenticator) signGuestToken(token string) string {
+	mac := hmac.New(sha256.New, a.guestKey)
+	mac.Write([]byte(token))
+	return token + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ensureGuestCookie gives a browser its long-lived guest identity on first
+// visit, or in place of a cookie this server did not sign.
+func (a *Authenticator) ensureGuestCookie(w http.ResponseWriter, r *http.Request) {
+	if _, ok := a.guestToken(r); ok {
+		return
+	}
+	token, err := newSessionToken()
+	if err != nil {
+		return
+	}
+	value := a.signGuestToken(token)
+	http.SetCookie(w, guestCookie(r, guestCookieName, value))
+
+	// Later handlers in this request should see the same identity.
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, cookie := range cookies {
+		if cookie.Name != guestCookieName {
+			r.AddCookie(cookie)
+		}
+	}
+	r.AddCookie(&http.Cookie{Name: guestCookieName, Value: value})
+}
+
+// loadGuestKey returns the key guest cookies are signed with, kept at path
+// so that guests keep their identity across restarts. Without a path the
+// key only lasts until the server stops.
+func loadGuestKey(path string) ([]byte, error) {
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			if key, err := hex.DecodeString(strings.TrimSpace(string(data))); err == nil && len(key) == guestKeyBytes {
+				return key, nil
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read guest key: %w", err)
+		}
+	}
+
+	key := make([]byte, guestKeyBytes)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate guest key: %w", err)
+	}
+	if path == "" {
+		return key, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create guest key dir: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write guest key: %w", err)
+	}
+	return key, nil
+}
+
+func guestCookie(r *http.Request, name, value string) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   guestCookieMaxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   r.TLS != nil,
+	}
+}
+
+// cleanNickname drops control characters and trims the name to
+// maxNicknameLength runes.
+func cleanNickname(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	for utf8.RuneCountInString(name) > maxNicknameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return strings.TrimSpace(name)
+}
+
+func (s *Server) handleNickname(w http.ResponseWriter, r *http.Request) {
+	var req NicknameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	s.auth.ensureGuestCookie(w, r)
+	nickname := cleanNickname(req.Nickname)
+	cookie := guestCookie(r, nicknameCookieName, url.QueryEscape(nickname))
+	if nickname == "" {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, cookie)
+
+	// Reflect the new name in this response, replacing the old cookie.
+	info := s.auth.SessionInfo(r)
+	info.Guest.Nickname = nickname
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(info)
+}
@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGuestFor(t *testing.T) {
+	a := NewAuthenticator(authConfig{}, nil)
+	anon := httptest.NewRequest(http.MethodGet, "/", nil)
+	anon.RemoteAddr = "10.0.0.5:1234"
+	sameAddr := httptest.NewRequest(http.MethodGet, "/", nil)
+	sameAddr.RemoteAddr = "10.0.0.5:5678"
+	if x, y := a.guestFor(anon), a.guestFor(sameAddr); x.ID == "" || x.ID != y.ID {
+		t.Fatalf("guest IDs by address = %q, %q, want the same non-empty ID", x.ID, y.ID)
+	}
+
+	withCookie := httptest.NewRequest(http.MethodGet, "/", nil)
+	withCookie.RemoteAddr = "10.0.0.5:1234"
+	withCookie.AddCookie(&http.Cookie{Name: guestCookieName, Value: a.signGuestToken("secret-token")})
+	withCookie.AddCookie(&http.Cookie{Name: nicknameCookieName, Value: "DJ%20Anna"})
+	guest := a.guestFor(withCookie)
+	if guest.ID == a.guestFor(anon).ID || strings.Contains(guest.ID, "secret") {
+		t.Errorf("cookie guest ID = %q, want a distinct hash of the cookie", guest.ID)
+	}
+	if guest.Nickname != "DJ Anna" {
+		t.Errorf("Nickname = %q, want %q", guest.Nickname, "DJ Anna")
+	}
+
+	other := NewAuthenticator(authConfig{}, nil)
+	for _, value := range []string{"secret-token", "secret-token.00", other.signGuestToken("secret-token"), "." + a.signGuestToken("")} {
+		forged := httptest.NewRequest(http.MethodGet, "/", nil)
+		forged.RemoteAddr = "10.0.0.5:1234"
+		forged.AddCookie(&http.Cookie{Name: guestCookieName, Value: value})
+		if got := a.guestFor(forged); got.ID != a.guestFor(anon).ID {
+			t.Errorf("guest for cookie %q = %q, want the address guest", value, got.ID)
+		}
+	}
+}
+
+func TestEnsureGuestCookie_ReplacesForged(t *testing.T) {
+	a := NewAuthenticator(authConfig{}, nil)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: guestCookieName, Value: "made-up"})
+	rr := httptest.NewRecorder()
+	a.ensureGuestCookie(rr, req)
+
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != guestCookieName || cookies[0].Value == "made-up" {
+		t.Fatalf("cookies = %+v, want a new guest cookie", cookies)
+	}
+	if token, ok := a.guestToken(req); !ok || cookies[0].Value != a.signGuestToken(token) {
+		t.Errorf("request still carries cookie %q, want the issued one", token)
+	}
+}
+
+func TestLoadGuestKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "guest.key")
+	key, err := loadGuestKey(path)
+	if err != nil {
+		t.Fatalf("loadGuestKey failed: %v", err)
+	}
+	again, err := loadGuestKey(path)
+	if err != nil {
+		t.Fatalf("loadGuestKey failed: %v", err)
+	}
+	if len(key) != guestKeyBytes || !bytes.Equal(key, again) {
+		t.Errorf("keys = %x, %x, want the same key after a restart", key, again)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestCleanNickname(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "  Anna  ", want: "Anna"},
+		{in: "An\x00na\n", want: "Anna"},
+		{in: strings.Repeat("é", maxNicknameLength+5), want: strings.Repeat("é", maxNicknameLength)},
+		{in: " \t ", want: ""},
+	}
+
+	for _, tc := range tests {
+		if got := cleanNickname(tc.in); got != tc.want {
+			t.Errorf("cleanNickname(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestHandleNickname(t *testing.T) {
+	s, _ := setupTestServer(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/nickname", strings.NewReader(`{"nickname":" Anna "}`))
+	rr := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d", rr.Code, http.StatusOK)
+	}
+
+	var info SessionInfo
+	if err := json.Unmarshal(rr.Body.Bytes(), &info); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if info.Guest.Nickname != "Anna" || info.Guest.ID == "" {
+		t.Fatalf("guest = %+v, want nickname Anna with an ID", info.Guest)
+	}
+
+	next := httptest.NewRequest(http.MethodGet, "/auth/session", nil)
+	for _, cookie := range rr.Result().Cookies() {
+		next.AddCookie(cookie)
+	}
+	if got := s.auth.guestFor(next); got != info.Guest {
+		t.Errorf("guest from cookies = %+v, want %+v", got, info.Guest)
+	}
+}
@@ -5,14 +5,21 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/reuski/skaldi/internal/metrics"
+	"github.com/reuski/skaldi/internal/player"
 	"github.com/reuski/skaldi/internal/resolver"
 )
 
@@ -22,9 +29,13 @@ type QueueRequest struct {
 }
 
 type PlaybackRequest struct {
-	Action string   `json:"action"`
-	Index  int      `json:"index"`
-	Value  *float64 `json:"value,omitempty"`
+	Action string    `json:"action"`
+	Index  int       `json:"index"`
+	Value  *float64  `json:"value,omitempty"`
+	Mode   string    `json:"mode,omitempty"`
+	Preset string    `json:"preset,omitempty"`
+	Gains  []float64 `json:"gains,omitempty"`
+	Device string    `json:"device,omitempty"`
 }
 
 type MoveRequest struct {
@@ -32,12 +43,56 @@ type MoveRequest struct {
 	To   int `json:"to"`
 }
 
+type queueResult struct {
+	Status   string `json:"status"`
+	Count    int    `json:"count"`
+	Rejected int    `json:"rejected"`
+	// Merged counts requests folded into a queued copy of the same track.
+	Merged     int              `json:"merged,omitempty"`
+	Rejections []queueRejection `json:"rejections,omitempty"`
+	Tracks     []resolver.Track `json:"tracks"`
+}
+
+type queueOutcome struct {
+	queued     []resolver.Track
+	merged     int
+	rejections []queueRejection
+}
+
+// commandError is a failed queue, playback or move command. The REST
+// handlers and the WebSocket channel both report it with its HTTP status.
+type commandError struct {
+	status  int
+	message string
+}
+
+func newCommandError(status int, message string) error {
+	return &commandError{status: status, message: message}
+}
+
+func (e *commandError) Error() string {
+	return e.message
+}
+
+func commandStatus(err error) int {
+	var cmdErr *commandError
+	if errors.As(err, &cmdErr) {
+		return cmdErr.status
+	}
+	return http.StatusInternalServerError
+}
+
+func writeCommandError(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), commandStatus(err))
+}
+
 func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path != "/" {
 		http.NotFound(w, r)
 		return
 	}
 
+	s.auth.ensureGuestCookie(w, r)
 	w.Header().Set("Content-Type", "text/html")
 	_, _ = w.Write(s.indexHTML)
 }
@@ -49,13 +104,28 @@ func (s *Server) handleQueue(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	result, err := s.queue(r.Context(), req, s.requesterFor(r))
+	if err != nil {
+		writeCommandError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+func (s *Server) queue(ctx context.Context, req QueueRequest, who requester) (queueResult, error) {
 	switch {
 	case req.URL == "" && len(req.Hits) == 0:
-		http.Error(w, "URL or hits are required", http.StatusBadRequest)
-		return
+		return queueResult{}, newCommandError(http.StatusBadRequest, "URL or hits are required")
 	case req.URL != "" && len(req.Hits) > 0:
-		http.Error(w, "Provide either url or hits", http.StatusBadRequest)
-		return
+		return queueResult{}, newCommandError(http.StatusBadRequest, "Provide either url or hits")
+	}
+
+	// Check the quota up front so a guest at their cap is not kept waiting
+	// on a resolve whose tracks would all be turned away.
+	if _, err := s.quotaUsage.allowance(s.quotas, who, s.player.State.Snapshot(), time.Now()); err != nil {
+		return queueResult{}, err
 	}
 
 	var (
@@ -65,16 +135,15 @@ func (s *Server) handleQueue(w http.ResponseWriter, r *http.Request) {
 	)
 
 	if req.URL != "" {
-		tracks, err = s.resolver.Resolve(r.Context(), req.URL)
+		tracks, err = s.resolver.Resolve(ctx, req.URL)
 		if err != nil {
 			s.logger.Error("Failed to resolve URL", "url", req.URL, "error", err)
-			http.Error(w, fmt.Sprintf("Failed to resolve URL: %v", err), http.StatusInternalServerError)
-			return
+			return queueResult{}, newCommandError(http.StatusInternalServerError, fmt.Sprintf("Failed to resolve URL: %v", err))
 		}
 	} else {
 		tracks = make([]resolver.Track, 0, len(req.Hits))
 		for _, hit := range req.Hits {
-			resolvedTracks, resolveErr := s.resolveQueueHit(r.Context(), hit)
+			resolvedTracks, resolveErr := s.resolver.ResolveHit(ctx, hit)
 			if resolveErr != nil {
 				rejected++
 				s.logger.Error("Failed to queue search hit", "source", hit.Source, "queue_url", hit.QueueURL, "error", resolveErr)
@@ -83,100 +152,87 @@ func (s *Server) handleQueue(w http.ResponseWriter, r *http.Request) {
 			tracks = append(tracks, resolvedTracks...)
 		}
 		if len(tracks) == 0 {
-			http.Error(w, "No tracks could be queued", http.StatusBadRequest)
-			return
+			return queueResult{}, newCommandError(http.StatusBadRequest, "No tracks could be queued")
 		}
 	}
 
-	queuedTracks := s.queueTracks(tracks)
-	if len(queuedTracks) == 0 {
-		http.Error(w, "Failed to enqueue tracks", http.StatusInternalServerError)
-		return
-	}
-
-	w.WriteHeader(http.StatusAccepted)
-	_ = json.NewEncoder(w).Encode(map[string]any{
-		"status":   "queued",
-		"count":    len(queuedTracks),
-		"rejected": rejected,
-		"tracks":   queuedTracks,
-	})
-}
-
-func (s *Server) resolveQueueHit(ctx context.Context, hit resolver.SearchHit) ([]resolver.Track, error) {
-	if hit.Source == resolver.SourceSubsonic {
-		return s.resolver.Resolve(ctx, hit.QueueURL)
+	for i := range tracks {
+		tracks[i].RequesterID = who.ID
+		tracks[i].RequesterName = who.Nickname
 	}
 
-	track, err := queueTrackFromHit(hit)
+	// Resolving can take a while, so the allowance is taken again against the
+	// queue as it is now, and held until the tracks are in it.
+	res, err := s.quotaUsage.reserve(s.quotas, who, s.player.State.Snapshot, len(tracks), time.Now())
 	if err != nil {
-		return nil, err
+		return queueResult{}, err
+	}
+	outcome := s.queueTracks(tracks, res.limit)
+	s.quotaUsage.release(res, outcome.queued, time.Now())
+
+	status := "queued"
+	if len(outcome.queued) == 0 {
+		switch {
+		case outcome.merged > 0:
+			status = "merged"
+		case len(outcome.rejections) > 0:
+			return queueResult{}, newCommandError(http.StatusConflict, duplicateMessage(outcome.rejections[0].Reason))
+		default:
+			return queueResult{}, newCommandError(http.StatusInternalServerError, "Failed to enqueue tracks")
+		}
 	}
-	return []resolver.Track{track}, nil
-}
 
-func queueTrackFromHit(hit resolver.SearchHit) (resolver.Track, error) {
-	if hit.QueueURL == "" {
-		return resolver.Track{}, fmt.Errorf("queue_url is required")
-	}
-
-	webpageURL := hit.WebpageURL
-	if webpageURL == "" {
-		webpageURL = hit.QueueURL
-	}
-
-	switch hit.Source {
-	case resolver.SourceYouTube, resolver.SourceYTMusic:
-		return resolver.Track{
-			ID:         hit.ID,
-			Title:      hit.Title,
-			Artist:     hit.Artist,
-			Duration:   hit.Duration,
-			Uploader:   hit.Artist,
-			Thumbnail:  hit.Thumbnail,
-			URL:        hit.QueueURL,
-			WebpageURL: webpageURL,
-			Source:     hit.Source,
-		}, nil
-	case resolver.SourceSubsonic:
-		return resolver.Track{
-			ID:         hit.ID,
-			Title:      hit.Title,
-			Artist:     hit.Artist,
-			Duration:   hit.Duration,
-			Uploader:   hit.Artist,
-			Thumbnail:  hit.Thumbnail,
-			URL:        hit.QueueURL,
-			WebpageURL: webpageURL,
-			Source:     hit.Source,
-		}, nil
-	default:
-		return resolver.Track{}, fmt.Errorf("unsupported search hit source: %s", hit.Source)
-	}
+	return queueResult{
+		Status:     status,
+		Count:      len(outcome.queued),
+		Rejected:   rejected + len(outcome.rejections),
+		Merged:     outcome.merged,
+		Rejections: outcome.rejections,
+		Tracks:     outcome.queued,
+	}, nil
 }
 
-func (s *Server) queueTracks(tracks []resolver.Track) []resolver.Track {
-	queuedTracks := make([]resolver.Track, 0, len(tracks))
+// queueTracks enqueues tracks in order, applying the duplicates policy and
+// queueing at most limit tracks unless limit is unlimitedQuota. Autoplay
+// picks never add votes, so under merge they are rejected instead.
+func (s *Server) queueTracks(tracks []resolver.Track, limit int) queueOutcome {
+	outcome := queueOutcome{queued: make([]resolver.Track, 0, len(tracks))}
+	dups := s.newDuplicateChecker()
 	for _, track := range tracks {
 		urlToQueue := track.PlayableURL()
 		if urlToQueue == "" {
 			continue
 		}
 
+		if reason, item := dups.check(track); reason != "" {
+			if s.duplicates.Policy == duplicatesMerge && item != nil && item.ID != 0 && !track.Autoplay {
+				s.player.Vote(item.ID)
+				outcome.merged++
+				continue
+			}
+			outcome.rejections = append(outcome.rejections, queueRejection{Title: track.Title, Reason: reason})
+			continue
+		}
+		if limit != unlimitedQuota && len(outcome.queued) >= limit {
+			outcome.rejections = append(outcome.rejections, queueRejection{Title: track.Title, Reason: reasonQuota})
+			continue
+		}
+
 		s.player.State.StoreMetadata(urlToQueue, track)
 
-		if _, err := s.player.Exec("loadfile", urlToQueue, "append-play"); err != nil {
+		if err := s.player.Enqueue(urlToQueue, track.Autoplay); err != nil {
 			s.logger.Error("Failed to enqueue track", "url", urlToQueue, "error", err)
 			continue
 		}
+		dups.added(track)
 
 		safeTrack := track
-		if _, ok := resolver.ParseSubsonicURI(track.WebpageURL); ok {
+		if resolver.IsSourceURL(track.WebpageURL) {
 			safeTrack.URL = track.WebpageURL
 		}
-		queuedTracks = append(queuedTracks, safeTrack)
+		outcome.queued = append(outcome.queued, safeTrack)
 	}
-	return queuedTracks
+	return outcome
 }
 
 func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
@@ -217,6 +273,27 @@ func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleBrowse lists what a library URI holds, or where to start browsing
+// when no uri is given.
+func (s *Server) handleBrowse(w http.ResponseWriter, r *http.Request) {
+	result, err := s.resolver.Browse(r.Context(), r.URL.Query().Get("uri"))
+	if err != nil {
+		if r.Context().Err() != nil {
+			return
+		}
+		if errors.Is(err, resolver.ErrNotBrowsable) {
+			http.Error(w, "Nothing to browse there", http.StatusNotFound)
+			return
+		}
+		s.logger.Error("Failed to browse", "uri", r.URL.Query().Get("uri"), "error", err)
+		http.Error(w, "Browse failed", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(result)
+}
+
 func (s *Server) handlePlayback(w http.ResponseWriter, r *http.Request) {
 	var req PlaybackRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -224,6 +301,15 @@ func (s *Server) handlePlayback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := s.playback(req); err != nil {
+		writeCommandError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) playback(req PlaybackRequest) error {
 	var err error
 	switch req.Action {
 	case "pause":
@@ -238,24 +324,86 @@ func (s *Server) handlePlayback(w http.ResponseWriter, r *http.Request) {
 		err = s.player.PlayIndex(req.Index)
 	case "set_volume":
 		if req.Value == nil {
-			http.Error(w, "Volume value is required", http.StatusBadRequest)
-			return
+			return newCommandError(http.StatusBadRequest, "Volume value is required")
 		}
-		_, err = s.player.Exec("set_property", "volume", clampVolume(*req.Value))
+		_, err = s.player.Exec("set_property", "volume", s.clampToCap(clampVolume(*req.Value)))
 	case "toggle_mute":
 		_, err = s.player.Exec("cycle", "mute")
+	case "set_repeat":
+		mode, ok := player.ParseRepeatMode(req.Mode)
+		if !ok {
+			return newCommandError(http.StatusBadRequest, "Repeat mode must be off, one or all")
+		}
+		err = s.player.SetRepeat(mode)
+	case "shuffle":
+		err = s.player.SetShuffle(true)
+	case "unshuffle":
+		err = s.player.SetShuffle(false)
+	case "set_queue_order":
+		order, ok := player.ParseQueueOrder(req.Mode)
+		if !ok {
+			return newCommandError(http.StatusBadRequest, "Queue order must be append or fair")
+		}
+		err = s.player.SetQueueOrder(order)
+	case "set_audio_preset":
+		preset, ok := player.ParseAudioPreset(req.Preset)
+		if !ok {
+			return newCommandError(http.StatusBadRequest, "Unknown audio preset")
+		}
+		err = s.player.SetAudioPreset(preset)
+	case "set_equalizer":
+		if validateErr := player.ValidateEqualizer(req.Gains); validateErr != nil {
+			return newCommandError(http.StatusBadRequest, "Invalid equalizer: "+validateErr.Error())
+		}
+		err = s.player.SetEqualizer(req.Gains)
+	case "set_audio_device":
+		if req.Device == "" {
+			return newCommandError(http.StatusBadRequest, "Audio device is required")
+		}
+		var devices []player.AudioDevice
+		if devices, err = s.player.AudioDevices(); err == nil {
+			if !slices.ContainsFunc(devices, func(d player.AudioDevice) bool { return d.Name == req.Device }) {
+				return newCommandError(http.StatusBadRequest, "Unknown audio device")
+			}
+			err = s.player.SetAudioDevice(req.Device)
+		}
+	case "seek", "seek_relative", "seek_percent":
+		if req.Value == nil {
+			return newCommandError(http.StatusBadRequest, "Seek value is required")
+		}
+		target, seekErr := seekTarget(s.player.State.Snapshot(), req.Action, *req.Value)
+		if seekErr != nil {
+			status := http.StatusBadRequest
+			if errors.Is(seekErr, errNotSeekable) {
+				status = http.StatusConflict
+			}
+			return newCommandError(status, sentenceCase(seekErr.Error()))
+		}
+		_, err = s.player.Exec("seek", target, "absolute")
+	case "sleep":
+		if req.Value == nil || *req.Value <= 0 || *req.Value > maxSleepMinutes {
+			return newCommandError(http.StatusBadRequest, fmt.Sprintf("Sleep timer needs 1 to %d minutes", maxSleepMinutes))
+		}
+		err = s.player.SleepAfter(time.Duration(*req.Value * float64(time.Minute)))
+	case "sleep_tracks":
+		if req.Value == nil || *req.Value < 1 || *req.Value > maxSleepTracks || *req.Value != math.Trunc(*req.Value) {
+			return newCommandError(http.StatusBadRequest, fmt.Sprintf("Sleep timer needs 1 to %d tracks", maxSleepTracks))
+		}
+		err = s.player.SleepAfterTracks(int(*req.Value))
+	case "cancel_sleep":
+		s.player.CancelSleep()
 	default:
-		http.Error(w, "Invalid action", http.StatusBadRequest)
-		return
+		return newCommandError(http.StatusBadRequest, "Invalid action")
 	}
 
+	if errors.Is(err, player.ErrNothingPlaying) {
+		return newCommandError(http.StatusConflict, "Nothing is playing")
+	}
 	if err != nil {
 		s.logger.Error("Playback action failed", "action", req.Action, "error", err)
-		http.Error(w, "Action failed", http.StatusInternalServerError)
-		return
+		return newCommandError(http.StatusInternalServerError, "Action failed")
 	}
-
-	w.WriteHeader(http.StatusOK)
+	return nil
 }
 
 func clampVolume(v float64) float64 {
@@ -268,6 +416,45 @@ func clampVolume(v float64) float64 {
 	return v
 }
 
+const (
+	maxSleepMinutes = 24 * 60
+	maxSleepTracks  = 100
+)
+
+var errNotSeekable = errors.New("current track is not seekable")
+
+// sentenceCase capitalizes an error message for the UI.
+func sentenceCase(msg string) string {
+	r, size := utf8.DecodeRuneInString(msg)
+	if size == 0 {
+		return msg
+	}
+	return string(unicode.ToUpper(r)) + msg[size:]
+}
+
+func seekTarget(snap player.Snapshot, action string, value float64) (float64, error) {
+	if snap.NowPlaying == nil || snap.Duration <= 0 {
+		return 0, errNotSeekable
+	}
+
+	switch action {
+	case "seek":
+		if value < 0 || value > snap.Duration {
+			return 0, fmt.Errorf("seek position must be between 0 and %.0f seconds", snap.Duration)
+		}
+		return value, nil
+	case "seek_relative":
+		return min(max(snap.CurrentTime+value, 0), snap.Duration), nil
+	case "seek_percent":
+		if value < 0 || value > 100 {
+			return 0, errors.New("seek percentage must be between 0 and 100")
+		}
+		return snap.Duration * value / 100, nil
+	default:
+		return 0, fmt.Errorf("invalid seek action: %s", action)
+	}
+}
+
 func (s *Server) handleRemove(w http.ResponseWriter, r *http.Request) {
 	indexStr := r.PathValue("index")
 	if indexStr == "" {
@@ -297,26 +484,61 @@ func (s *Server) handleMove(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.From < 0 || req.To < -1 {
-		http.Error(w, "Invalid indices", http.StatusBadRequest)
+	if err := s.move(req); err != nil {
+		writeCommandError(w, err)
 		return
 	}
 
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) move(req MoveRequest) error {
+	if req.From < 0 || req.To < -1 {
+		return newCommandError(http.StatusBadRequest, "Invalid indices")
+	}
+
 	if req.To >= 0 && req.From == req.To {
-		http.Error(w, "Source and destination cannot match", http.StatusBadRequest)
-		return
+		return newCommandError(http.StatusBadRequest, "Source and destination cannot match")
 	}
 
-	if _, err := s.player.Exec("playlist-move", req.From, req.To); err != nil {
+	if err := s.player.Move(req.From, req.To); err != nil {
 		s.logger.Error("Failed to move item", "from", req.From, "to", req.To, "error", err)
-		http.Error(w, "Move failed", http.StatusInternalServerError)
+		return newCommandError(http.StatusInternalServerError, "Move failed")
+	}
+	return nil
+}
+
+func (s *Server) handleAudioDevices(w http.ResponseWriter, r *http.Request) {
+	devices, err := s.player.AudioDevices()
+	if err != nil {
+		s.logger.Error("Failed to list audio devices", "error", err)
+		http.Error(w, "Failed to list audio devices", http.StatusServiceUnavailable)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(devices)
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", metrics.ContentType)
+	if err := metrics.WriteText(w); err != nil {
+		s.logger.Debug("Failed to write metrics", "error", err)
+	}
 }
 
 func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	// Uploads need a host session when host access is enabled; without it
+	// they count against the uploader's quota like any queued track.
+	who := s.requesterFor(r)
+	res, err := s.quotaUsage.reserve(s.quotas, who, s.player.State.Snapshot, 1, time.Now())
+	if err != nil {
+		writeCommandError(w, err)
+		return
+	}
+	var queued []resolver.Track
+	defer func() { s.quotaUsage.release(res, queued, time.Now()) }()
+
 	r.Body = http.MaxBytesReader(w, r.Body, 100<<20)
 	if err := r.ParseMultipartForm(100 << 20); err != nil {
 		http.Error(w, "File too large or invalid multipart", http.StatusBadRequest)
@@ -353,16 +575,19 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 	s.player.RegisterTempFile(dstPath)
 
 	track := resolver.Track{
-		Title:    header.Filename,
-		Uploader: "Local Upload",
+		Title:         header.Filename,
+		Uploader:      "Local Upload",
+		RequesterID:   who.ID,
+		RequesterName: who.Nickname,
 	}
 	s.player.State.StoreMetadata(dstPath, track)
 
-	if _, err := s.player.Exec("loadfile", dstPath, "append-play"); err != nil {
+	if err := s.player.Enqueue(dstPath, false); err != nil {
 		http.Error(w, "Failed to enqueue", http.StatusInternalServerError)
 		os.Remove(dstPath)
 		return
 	}
+	queued = append(queued, track)
 
 	w.WriteHeader(http.StatusAccepted)
 }
@@ -6,9 +6,11 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -38,7 +40,10 @@ func setupTestServer(t *testing.T) (*Server, *player.Manager) {
 	}
 	indexHTML := []byte("<html><body>Test</body></html>")
 
-	s := New(logger, p, r, indexHTML, 0)
+	s, err := New(cfg, logger, p, r, indexHTML, ListenOptions{})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
 	return s, p
 }
 
@@ -150,6 +155,167 @@ func TestHandlePlayback_InvalidAction(t *testing.T) {
 	}
 }
 
+func TestHandlePlayback_Seek(t *testing.T) {
+	s, _ := setupTestServer(t)
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{name: "missing_value", body: `{"action": "seek"}`, want: http.StatusBadRequest},
+		{name: "nothing_playing", body: `{"action": "seek", "value": 30}`, want: http.StatusConflict},
+		{name: "nothing_playing_relative", body: `{"action": "seek_relative", "value": -10}`, want: http.StatusConflict},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/playback", strings.NewReader(tc.body))
+			rr := httptest.NewRecorder()
+
+			s.handlePlayback(rr, req)
+
+			if rr.Code != tc.want {
+				t.Errorf("Status = %d, want %d", rr.Code, tc.want)
+			}
+		})
+	}
+}
+
+func TestHandlePlayback_InvalidModes(t *testing.T) {
+	s, _ := setupTestServer(t)
+
+	for _, body := range []string{
+		`{"action": "set_repeat"}`,
+		`{"action": "set_repeat", "mode": "twice"}`,
+		`{"action": "set_queue_order", "mode": "random"}`,
+		`{"action": "set_audio_preset", "preset": "stadium"}`,
+		`{"action": "set_equalizer", "gains": [1, 2, 3]}`,
+		`{"action": "set_equalizer", "gains": [0, 0, 0, 0, 0, 0, 0, 0, 0, 30]}`,
+		`{"action": "set_audio_device"}`,
+		`{"action": "sleep"}`,
+		`{"action": "sleep", "value": 0}`,
+		`{"action": "sleep_tracks", "value": 1.5}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/playback", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+
+		s.handlePlayback(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: Status = %d, want %d", body, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestHandlePlayback_SleepNothingPlaying(t *testing.T) {
+	s, _ := setupTestServer(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/playback", strings.NewReader(`{"action": "sleep", "value": 30}`))
+	rr := httptest.NewRecorder()
+
+	s.handlePlayback(rr, req)
+
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Status = %d, want %d", rr.Code, http.StatusConflict)
+	}
+}
+
+func TestHandleAudioDevices_PlayerUnavailable(t *testing.T) {
+	s, _ := setupTestServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/audio/devices", nil)
+	rr := httptest.NewRecorder()
+
+	s.handleAudioDevices(rr, req)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Status = %d, want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestSeekTarget(t *testing.T) {
+	playing := player.Snapshot{NowPlaying: &player.QueueItem{Filename: "a"}, CurrentTime: 60, Duration: 200}
+	live := player.Snapshot{NowPlaying: &player.QueueItem{Filename: "stream"}, CurrentTime: 60}
+
+	tests := []struct {
+		name        string
+		snap        player.Snapshot
+		action      string
+		value       float64
+		want        float64
+		wantErr     bool
+		notSeekable bool
+	}{
+		{name: "absolute", snap: playing, action: "seek", value: 90, want: 90},
+		{name: "absolute_end", snap: playing, action: "seek", value: 200, want: 200},
+		{name: "absolute_past_end", snap: playing, action: "seek", value: 201, wantErr: true},
+		{name: "absolute_negative", snap: playing, action: "seek", value: -1, wantErr: true},
+		{name: "relative_forward", snap: playing, action: "seek_relative", value: 30, want: 90},
+		{name: "relative_back", snap: playing, action: "seek_relative", value: -10, want: 50},
+		{name: "relative_clamped_start", snap: playing, action: "seek_relative", value: -600, want: 0},
+		{name: "relative_clamped_end", snap: playing, action: "seek_relative", value: 600, want: 200},
+		{name: "percent", snap: playing, action: "seek_percent", value: 25, want: 50},
+		{name: "percent_out_of_range", snap: playing, action: "seek_percent", value: 101, wantErr: true},
+		{name: "live_stream", snap: live, action: "seek_relative", value: 10, wantErr: true, notSeekable: true},
+		{name: "nothing_playing", snap: player.Snapshot{}, action: "seek", value: 0, wantErr: true, notSeekable: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := seekTarget(tc.snap, tc.action, tc.value)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("seekTarget error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if errors.Is(err, errNotSeekable) != tc.notSeekable {
+				t.Errorf("seekTarget error = %v, notSeekable %v", err, tc.notSeekable)
+			}
+			if !tc.wantErr && got != tc.want {
+				t.Errorf("seekTarget = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSentenceCase(t *testing.T) {
+	tests := map[string]string{
+		"current track is not seekable": "Current track is not seekable",
+		"élan":                          "Élan",
+		"":                              "",
+	}
+	for in, want := range tests {
+		if got := sentenceCase(in); got != want {
+			t.Errorf("sentenceCase(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestHandleMetrics(t *testing.T) {
+	s, _ := setupTestServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rr := httptest.NewRecorder()
+
+	s.server.Handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	if got := rr.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", got)
+	}
+	for _, name := range []string{
+		"skaldi_broadcast_snapshots_total",
+		"skaldi_mpv_restarts_total",
+		"skaldi_history_write_failures_total",
+		"# TYPE skaldi_ytdlp_duration_seconds histogram",
+	} {
+		if !strings.Contains(rr.Body.String(), name) {
+			t.Errorf("metrics output is missing %s", name)
+		}
+	}
+}
+
 func TestHandleSearch_InvalidIntent(t *testing.T) {
 	s, _ := setupTestServer(t)
 
@@ -163,6 +329,32 @@ func TestHandleSearch_InvalidIntent(t *testing.T) {
 	}
 }
 
+func TestHandleBrowse(t *testing.T) {
+	s := setupSearchServer(t, true)
+
+	rr := httptest.NewRecorder()
+	s.handleBrowse(rr, httptest.NewRequest(http.MethodGet, "/browse", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	var roots resolver.BrowseResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &roots); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if len(roots.Hits) != 1 || roots.Hits[0].Kind != resolver.KindFolder {
+		t.Fatalf("roots = %+v, want the library's playlists folder", roots.Hits)
+	}
+	if roots.Hits[0].QueueURL != "skaldi+subsonic://personal/playlist/" {
+		t.Errorf("root queue_url = %q", roots.Hits[0].QueueURL)
+	}
+
+	rr = httptest.NewRecorder()
+	s.handleBrowse(rr, httptest.NewRequest(http.MethodGet, "/browse?uri="+url.QueryEscape("https://www.youtube.com/watch?v=1"), nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Status = %d, want %d for a URL no source can browse", rr.Code, http.StatusNotFound)
+	}
+}
+
 func TestHandleSearch_StreamsCanonicalBatchesWithoutExternalLibrary(t *testing.T) {
 	s := setupSearchServer(t, false)
 
@@ -251,40 +443,6 @@ func TestHandleQueue_InvalidMethod(t *testing.T) {
 	}
 }
 
-func TestQueueTrackFromHit(t *testing.T) {
-	hit := resolver.SearchHit{
-		ID:         "vid-1",
-		Source:     resolver.SourceYouTube,
-		Title:      "Song",
-		Artist:     "Artist",
-		Duration:   123,
-		Thumbnail:  "https://img.example/vid-1.jpg",
-		WebpageURL: "https://www.youtube.com/watch?v=vid-1",
-		QueueURL:   "https://www.youtube.com/watch?v=vid-1",
-	}
-
-	track, err := queueTrackFromHit(hit)
-	if err != nil {
-		t.Fatalf("queueTrackFromHit failed: %v", err)
-	}
-	if track.Source != resolver.SourceYouTube {
-		t.Fatalf("source = %q, want %q", track.Source, resolver.SourceYouTube)
-	}
-	if track.WebpageURL != hit.WebpageURL {
-		t.Fatalf("webpage_url = %q, want %q", track.WebpageURL, hit.WebpageURL)
-	}
-	if track.Uploader != hit.Artist {
-		t.Fatalf("uploader = %q, want %q", track.Uploader, hit.Artist)
-	}
-}
-
-func TestQueueTrackFromHit_InvalidSource(t *testing.T) {
-	_, err := queueTrackFromHit(resolver.SearchHit{Source: "unsupported", QueueURL: "https://example.com"})
-	if err == nil {
-		t.Fatal("expected unsupported source error")
-	}
-}
-
 func TestHandleRemove_InvalidIndex(t *testing.T) {
 	s, _ := setupTestServer(t)
 
@@ -570,7 +728,10 @@ func TestNew(t *testing.T) {
 	}
 	indexHTML := []byte("<html>Test</html>")
 
-	s := New(logger, p, r, indexHTML, 8080)
+	s, err := New(cfg, logger, p, r, indexHTML, ListenOptions{})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
 
 	if s == nil {
 		t.Fatal("New() returned nil")
@@ -603,22 +764,33 @@ func setupSearchServer(t *testing.T, withLibrary bool) *Server {
 		ConfigPath: filepath.Join(t.TempDir(), "config.json"),
 	}
 
+	// Bandcamp search is stubbed so that no test reaches bandcamp.com.
+	bandcampServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"auto":{"results":[]}}`))
+	}))
+	t.Cleanup(bandcampServer.Close)
+	appConfig := `{
+  "bandcamp": {"enabled": true, "search_url": "` + bandcampServer.URL + `"}
+}`
+
 	if withLibrary {
 		subsonicServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			_, _ = w.Write([]byte(`{"subsonic-response":{"status":"ok","searchResult3":{"song":[{"id":"lib-1","title":"Library Song","artist":"Library Artist","duration":180}]}}}`))
 		}))
 		t.Cleanup(subsonicServer.Close)
-		if err := os.WriteFile(cfg.ConfigPath, []byte(`{
+		appConfig = `{
+  "bandcamp": {"enabled": true, "search_url": "` + bandcampServer.URL + `"},
   "opensubsonic": {
     "enabled": true,
     "library_id": "personal",
-    "base_url": "`+subsonicServer.URL+`",
+    "base_url": "` + subsonicServer.URL + `",
     "username": "alice",
     "token": "secret"
   }
-}`), 0o644); err != nil {
-			t.Fatalf("WriteFile failed: %v", err)
-		}
+}`
+	}
+	if err := os.WriteFile(cfg.ConfigPath, []byte(appConfig), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
 	}
 
 	writeExecutable(t, cfg.ShimPath(), `#!/bin/sh
@@ -643,7 +815,11 @@ esac
 	if err != nil {
 		t.Fatalf("resolver.New failed: %v", err)
 	}
-	return New(logger, p, r, []byte("<html>Test</html>"), 0)
+	s, err := New(cfg, logger, p, r, []byte("<html>Test</html>"), ListenOptions{})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return s
 }
 
 func decodeSearchBatches(t *testing.T, body string) []resolver.SearchBatch {
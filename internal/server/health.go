@@ -0,0 +1,162 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/reuski/skaldi/internal/bootstrap"
+	"github.com/reuski/skaldi/internal/resolver"
+)
+
+const (
+	healthOK          = "ok"
+	healthDegraded    = "degraded"
+	healthUnavailable = "unavailable"
+
+	readinessPingTimeout = 3 * time.Second
+)
+
+type readinessReport struct {
+	Status       string         `json:"status"`
+	Mpv          mpvHealth      `json:"mpv"`
+	Tools        toolsHealth    `json:"tools"`
+	OpenSubsonic subsonicHealth `json:"opensubsonic"`
+	Warnings     []string       `json:"warnings"`
+}
+
+type mpvHealth struct {
+	Connected bool `json:"connected"`
+	// LastEventSeconds is null until mpv has sent its first event.
+	LastEventSeconds *float64 `json:"last_event_seconds"`
+}
+
+type toolsHealth struct {
+	Uv        string `json:"uv"`
+	Bun       string `json:"bun"`
+	YtDlp     string `json:"yt-dlp"`
+	ShimReady bool   `json:"ytdlp_shim_ready"`
+	Error     string `json:"error,omitempty"`
+}
+
+// subsonicHealth sums up every OpenSubsonic library: reachable only when all
+// of them are, with the slowest latency and the first error.
+type subsonicHealth struct {
+	Configured bool            `json:"configured"`
+	Reachable  bool            `json:"reachable"`
+	LatencyMS  float64         `json:"latency_ms,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Libraries  []libraryHealth `json:"libraries,omitempty"`
+}
+
+type libraryHealth struct {
+	LibraryID string  `json:"library_id"`
+	Reachable bool    `json:"reachable"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, map[string]string{"status": healthOK})
+}
+
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessPingTimeout)
+	defer cancel()
+
+	report := s.readiness(ctx)
+	status := http.StatusOK
+	if report.Status == healthUnavailable {
+		status = http.StatusServiceUnavailable
+	}
+	writeHealth(w, status, report)
+}
+
+// readiness treats mpv and the yt-dlp shim as required, since nothing plays
+// without them, and everything else as degrading service.
+func (s *Server) readiness(ctx context.Context) readinessReport {
+	report := readinessReport{
+		Status:   healthOK,
+		Mpv:      mpvHealth{Connected: s.player.IPCConnected()},
+		Tools:    s.toolsHealth(),
+		Warnings: []string{},
+	}
+
+	if last := s.player.LastEventAt(); !last.IsZero() {
+		age := time.Since(last).Seconds()
+		report.Mpv.LastEventSeconds = &age
+	}
+
+	if s.resolver != nil {
+		for _, warning := range s.resolver.Warnings() {
+			report.Warnings = append(report.Warnings, warning.Error())
+		}
+
+		report.OpenSubsonic = subsonicHealthFrom(s.resolver.PingOpenSubsonic(ctx))
+	}
+
+	switch {
+	case !report.Mpv.Connected || !report.Tools.ShimReady:
+		report.Status = healthUnavailable
+	case len(report.Warnings) > 0 || (report.OpenSubsonic.Configured && !report.OpenSubsonic.Reachable):
+		report.Status = healthDegraded
+	}
+	return report
+}
+
+func subsonicHealthFrom(pings []resolver.LibraryPing) subsonicHealth {
+	health := subsonicHealth{Configured: len(pings) > 0, Reachable: len(pings) > 0}
+	for _, ping := range pings {
+		library := libraryHealth{
+			LibraryID: ping.LibraryID,
+			Reachable: ping.Err == nil,
+			LatencyMS: float64(ping.Latency.Microseconds()) / 1000,
+		}
+		if ping.Err != nil {
+			library.Error = ping.Err.Error()
+			health.Reachable = false
+			if health.Error == "" {
+				health.Error = ping.LibraryID + ": " + library.Error
+			}
+		}
+		health.LatencyMS = max(health.LatencyMS, library.LatencyMS)
+		health.Libraries = append(health.Libraries, library)
+	}
+	return health
+}
+
+func (s *Server) toolsHealth() toolsHealth {
+	if s.cfg == nil {
+		return toolsHealth{Error: "no bootstrap config"}
+	}
+
+	var tools toolsHealth
+	state, err := bootstrap.LoadState(s.cfg.CacheDir)
+	if err != nil {
+		tools.Error = "failed to read installed versions: " + err.Error()
+	} else {
+		tools.Uv, tools.Bun, tools.YtDlp = state.Uv, state.Bun, state.YtDlp
+	}
+
+	info, err := os.Stat(s.cfg.ShimPath())
+	switch {
+	case err != nil:
+		tools.Error = "yt-dlp shim: " + err.Error()
+	case info.Mode()&0o111 == 0:
+		tools.Error = "yt-dlp shim is not executable"
+	default:
+		tools.ShimReady = true
+	}
+	return tools
+}
+
+func writeHealth(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
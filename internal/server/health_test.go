@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/reuski/skaldi/internal/resolver"
+)
+
+func TestHandleHealthz(t *testing.T) {
+	s, _ := setupTestServer(t)
+
+	rr := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	if got := rr.Body.String(); got != "{\"status\":\"ok\"}\n" {
+		t.Errorf("body = %q", got)
+	}
+}
+
+func TestHandleReadyz_MpvDisconnected(t *testing.T) {
+	s, _ := setupTestServer(t)
+	if err := os.WriteFile(s.cfg.ShimPath(), []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+
+	var report readinessReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if report.Status != healthUnavailable {
+		t.Errorf("status = %q, want %q", report.Status, healthUnavailable)
+	}
+	if report.Mpv.Connected || report.Mpv.LastEventSeconds != nil {
+		t.Errorf("mpv = %+v, want disconnected with no events", report.Mpv)
+	}
+	if !report.Tools.ShimReady {
+		t.Errorf("tools = %+v, want shim ready", report.Tools)
+	}
+	if report.OpenSubsonic.Configured {
+		t.Errorf("opensubsonic = %+v, want unconfigured", report.OpenSubsonic)
+	}
+}
+
+func TestToolsHealth_ShimNotExecutable(t *testing.T) {
+	s, _ := setupTestServer(t)
+	if err := os.WriteFile(s.cfg.ShimPath(), []byte("#!/bin/sh\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	tools := s.toolsHealth()
+	if tools.ShimReady || tools.Error == "" {
+		t.Errorf("tools = %+v, want shim not ready with an error", tools)
+	}
+}
+
+func TestSubsonicHealthFrom(t *testing.T) {
+	tests := []struct {
+		name          string
+		pings         []resolver.LibraryPing
+		wantReachable bool
+		wantError     string
+	}{
+		{name: "unconfigured"},
+		{
+			name: "all reachable",
+			pings: []resolver.LibraryPing{
+				{LibraryID: "navidrome", Latency: 10 * time.Millisecond},
+				{LibraryID: "gonic", Latency: 30 * time.Millisecond},
+			},
+			wantReachable: true,
+		},
+		{
+			name: "one down",
+			pings: []resolver.LibraryPing{
+				{LibraryID: "navidrome", Latency: 10 * time.Millisecond},
+				{LibraryID: "gonic", Latency: 30 * time.Millisecond, Err: errors.New("connection refused")},
+			},
+			wantError: "gonic: connection refused",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			health := subsonicHealthFrom(tt.pings)
+			if health.Configured != (len(tt.pings) > 0) {
+				t.Errorf("configured = %v, want %v", health.Configured, len(tt.pings) > 0)
+			}
+			if health.Reachable != tt.wantReachable {
+				t.Errorf("reachable = %v, want %v", health.Reachable, tt.wantReachable)
+			}
+			if health.Error != tt.wantError {
+				t.Errorf("error = %q, want %q", health.Error, tt.wantError)
+			}
+			if len(health.Libraries) != len(tt.pings) {
+				t.Fatalf("libraries = %d, want %d", len(health.Libraries), len(tt.pings))
+			}
+			if len(tt.pings) > 0 && health.LatencyMS != 30 {
+				t.Errorf("latency = %v, want the slowest library's", health.LatencyMS)
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/reuski/skaldi/internal/player"
+	"github.com/reuski/skaldi/internal/resolver"
+)
+
+const (
+	quotaWindow = time.Hour
+	reasonQuota = "quota"
+	// quotaSettle is how long tracks a guest just queued count against
+	// max_upcoming even before the player's snapshot shows them.
+	quotaSettle = 10 * time.Second
+	// unlimitedQuota is the allowance of a guest no cap applies to.
+	unlimitedQuota = -1
+)
+
+// requester is who a queue request came from. Signed-in hosts are exempt
+// from quotas; with host access disabled everyone is a guest for quotas.
+type requester struct {
+	Guest
+	// addr identifies the remote address. Caps apply to it as well, so
+	// that a client cannot start over by dropping its guest cookie.
+	addr   string
+	exempt bool
+}
+
+func (s *Server) requesterFor(r *http.Request) requester {
+	return requester{
+		Guest:  s.auth.guestFor(r),
+		addr:   publicGuestID("addr:" + remoteHost(r)),
+		exempt: s.auth.Enabled() && s.auth.RoleFor(r) == RoleHost,
+	}
+}
+
+// quotaKeys are the allowances a request from who counts against. A guest
+// without a cookie is known by its address alone.
+func (who requester) quotaKeys() []string {
+	if who.addr == "" || who.addr == who.ID {
+		return []string{who.ID}
+	}
+	return []string{who.ID, who.addr}
+}
+
+// quotaTracker remembers when each guest and each remote address added
+// tracks over the last hour, and holds the allowance of queue requests
+// still being added so that concurrent requests cannot together exceed
+// the caps.
+type quotaTracker struct {
+	mu    sync.Mutex
+	added map[string][]time.Time
+	// reserved counts tracks being queued right now.
+	reserved map[string]int
+	// settling are tracks just queued, which the player's snapshot may not
+	// show yet.
+	settling map[string][]settlingTrack
+	// addrGuests are the guests seen at each address and when, so that
+	// their upcoming tracks count against the address.
+	addrGuests map[string]map[string]time.Time
+}
+
+type settlingTrack struct {
+	key   string
+	until time.Time
+}
+
+// quotaReservation is the part of an allowance held by one queue request.
+// limit is how many tracks the request may queue.
+type quotaReservation struct {
+	keys  []string
+	n     int
+	at    time.Time
+	limit int
+}
+
+func newQuotaTracker() *quotaTracker {
+	return &quotaTracker{
+		added:      make(map[string][]time.Time),
+		reserved:   make(map[string]int),
+		settling:   make(map[string][]settlingTrack),
+		addrGuests: make(map[string]map[string]time.Time),
+	}
+}
+
+// allowance returns how many more tracks who may queue right now, or
+// unlimitedQuota. It fails with a 429 command error once a cap is reached.
+func (q *quotaTracker) allowance(cfg quotaConfig, who requester, snap player.Snapshot, now time.Time) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.allowanceLocked(cfg, who, snap, now)
+}
+
+func (q *quotaTracker) allowanceLocked(cfg quotaConfig, who requester, snap player.Snapshot, now time.Time) (int, error) {
+	if who.exempt || (cfg.MaxUpcoming == 0 && cfg.MaxPerHour == 0) {
+		return unlimitedQuota, nil
+	}
+	q.pruneLocked(now, snap)
+
+	remaining := unlimitedQuota
+	for _, key := range who.quotaKeys() {
+		left, err := q.keyAllowanceLocked(cfg, key, q.ownersLocked(who, key), snap)
+		if err != nil {
+			return 0, err
+		}
+		if remaining == unlimitedQuota || (left != unlimitedQuota && left < remaining) {
+			remaining = left
+		}
+	}
+	return remaining, nil
+}
+
+// ownersLocked reports which requester IDs' tracks count against key: the
+// guest's own, or for an address those of every guest seen there.
+func (q *quotaTracker) ownersLocked(who requester, key string) func(string) bool {
+	if key != who.addr {
+		return func(id string) bool { return id == key }
+	}
+	guests := q.addrGuests[key]
+	return func(id string) bool {
+		_, seen := guests[id]
+		return id == who.ID || id == key || seen
+	}
+}
+
+func (q *quotaTracker) keyAllowanceLocked(cfg quotaConfig, key string, owns func(string) bool, snap player.Snapshot) (int, error) {
+	remaining := unlimitedQuota
+	if cfg.MaxUpcoming > 0 {
+		held := q.reserved[key]
+		for _, item := range snap.Upcoming {
+			if item.Metadata != nil && owns(item.Metadata.RequesterID) {
+				held++
+			}
+		}
+		if settling := q.settling[key]; len(settling) > 0 {
+			inQueue := make(map[string]bool, len(snap.Queue))
+			for _, item := range snap.Queue {
+				inQueue[item.DedupKey()] = true
+			}
+			for _, track := range settling {
+				if !inQueue[track.key] {
+					held++
+				}
+			}
+		}
+		if held >= cfg.MaxUpcoming {
+			return 0, newCommandError(http.StatusTooManyRequests,
+				fmt.Sprintf("You already have %d tracks waiting", held))
+		}
+		remaining = cfg.MaxUpcoming - held
+	}
+
+	if cfg.MaxPerHour > 0 {
+		added := len(q.added[key])
+		if added >= cfg.MaxPerHour {
+			return 0, newCommandError(http.StatusTooManyRequests,
+				fmt.Sprintf("You can add %d tracks per hour", cfg.MaxPerHour))
+		}
+		if left := cfg.MaxPerHour - added; remaining == unlimitedQuota || left < remaining {
+			remaining = left
+		}
+	}
+	return remaining, nil
+}
+
+// reserve holds the allowance for up to want tracks from who until release
+// is called. snapshot is read under the tracker's lock, so that it shows
+// the tracks of any request released before.
+func (q *quotaTracker) reserve(cfg quotaConfig, who requester, snapshot func() player.Snapshot, want int, now time.Time) (quotaReservation, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	limit, err := q.allowanceLocked(cfg, who, snapshot(), now)
+	if err != nil {
+		return quotaReservation{}, err
+	}
+	res := quotaReservation{keys: who.quotaKeys(), at: now, limit: limit}
+	if limit == unlimitedQuota {
+		return res, nil
+	}
+	if who.addr != "" && who.addr != who.ID {
+		if q.addrGuests[who.addr] == nil {
+			q.addrGuests[who.addr] = make(map[string]time.Time)
+		}
+		q.addrGuests[who.addr][who.ID] = now
+	}
+	res.n = min(limit, want)
+	res.limit = res.n
+	for _, key := range res.keys {
+		q.reserved[key] += res.n
+		for range res.n {
+			q.added[key] = append(q.added[key], now)
+		}
+	}
+	return res, nil
+}
+
+// release gives back the part of res that was not used once the tracks in
+// queued have been added to the player.
+func (q *quotaTracker) release(res quotaReservation, queued []resolver.Track, now time.Time) {
+	if res.n == 0 {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, key := range res.keys {
+		if q.reserved[key] -= res.n; q.reserved[key] <= 0 {
+			delete(q.reserved, key)
+		}
+
+		times, unused := q.added[key], res.n-len(queued)
+		for i := len(times) - 1; i >= 0 && unused > 0; i-- {
+			if times[i].Equal(res.at) {
+				times = slices.Delete(times, i, i+1)
+				unused--
+			}
+		}
+		if len(times) == 0 {
+			delete(q.added, key)
+		} else {
+			q.added[key] = times
+		}
+
+		for _, track := range queued {
+			q.settling[key] = append(q.settling[key], settlingTrack{key: track.DedupKey(), until: now.Add(quotaSettle)})
+		}
+	}
+}
+
+// pruneLocked forgets adds older than quotaWindow, settled tracks, and
+// guests not seen at an address for quotaWindow who have nothing waiting.
+func (q *quotaTracker) pruneLocked(now time.Time, snap player.Snapshot) {
+	for id, tracks := range q.settling {
+		tracks = slices.DeleteFunc(tracks, func(t settlingTrack) bool { return !now.Before(t.until) })
+		if len(tracks) == 0 {
+			delete(q.settling, id)
+		} else {
+			q.settling[id] = tracks
+		}
+	}
+
+	cutoff := now.Add(-quotaWindow)
+	for id, times := range q.added {
+		i := 0
+		for i < len(times) && !times[i].After(cutoff) {
+			i++
+		}
+		if i == len(times) {
+			delete(q.added, id)
+		} else {
+			q.added[id] = times[i:]
+		}
+	}
+
+	if len(q.addrGuests) == 0 {
+		return
+	}
+	waiting := make(map[string]bool)
+	for _, item := range snap.Upcoming {
+		if item.Metadata != nil {
+			waiting[item.Metadata.RequesterID] = true
+		}
+	}
+	for addr, guests := range q.addrGuests {
+		for id, seen := range guests {
+			if !seen.After(cutoff) && !waiting[id] {
+				delete(guests, id)
+			}
+		}
+		if len(guests) == 0 {
+			delete(q.addrGuests, addr)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/reuski/skaldi/internal/player"
+	"github.com/reuski/skaldi/internal/resolver"
+)
+
+// record notes that id added n tracks at now.
+func (q *quotaTracker) record(id string, n int, now time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for range n {
+		q.added[id] = append(q.added[id], now)
+	}
+}
+
+func (q *quotaTracker) recent(id string, now time.Time) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pruneLocked(now, player.Snapshot{})
+	return len(q.added[id])
+}
+
+func TestQuotaTracker_Allowance(t *testing.T) {
+	now := time.Date(2026, 3, 2, 20, 0, 0, 0, time.UTC)
+	anna := requester{Guest: Guest{ID: "anna"}}
+	snap := player.Snapshot{Upcoming: []player.QueueItem{
+		{Metadata: &resolver.Track{RequesterID: "anna"}},
+		{Metadata: &resolver.Track{RequesterID: "ben"}},
+		{},
+	}}
+
+	tests := []struct {
+		name    string
+		cfg     quotaConfig
+		who     requester
+		added   int
+		want    int
+		wantErr bool
+	}{
+		{name: "no_caps", who: anna, want: unlimitedQuota},
+		{name: "upcoming_left", cfg: quotaConfig{MaxUpcoming: 3}, who: anna, want: 2},
+		{name: "upcoming_full", cfg: quotaConfig{MaxUpcoming: 1}, who: anna, wantErr: true},
+		{name: "hourly_left", cfg: quotaConfig{MaxPerHour: 5}, who: anna, added: 4, want: 1},
+		{name: "hourly_spent", cfg: quotaConfig{MaxPerHour: 5}, who: anna, added: 5, wantErr: true},
+		{name: "tighter_wins", cfg: quotaConfig{MaxUpcoming: 5, MaxPerHour: 5}, who: anna, added: 3, want: 2},
+		{name: "host_exempt", cfg: quotaConfig{MaxUpcoming: 1}, who: requester{Guest: Guest{ID: "anna"}, exempt: true}, want: unlimitedQuota},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			q := newQuotaTracker()
+			q.record("anna", tc.added, now.Add(-30*time.Minute))
+			got, err := q.allowance(tc.cfg, tc.who, snap, now)
+			if tc.wantErr {
+				if commandStatus(err) != http.StatusTooManyRequests {
+					t.Fatalf("err = %v, want a 429 command error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("allowance = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestQuotaTracker_ForgetsOldAdds(t *testing.T) {
+	now := time.Date(2026, 3, 2, 20, 0, 0, 0, time.UTC)
+	q := newQuotaTracker()
+	q.record("anna", 2, now.Add(-quotaWindow))
+	q.record("anna", 1, now.Add(-time.Minute))
+
+	if got := q.recent("anna", now); got != 1 {
+		t.Errorf("recent = %d, want 1", got)
+	}
+}
+
+func TestQuotaTracker_Reserve(t *testing.T) {
+	now := time.Date(2026, 3, 2, 20, 0, 0, 0, time.UTC)
+	anna := requester{Guest: Guest{ID: "anna"}}
+	empty := func() player.Snapshot { return player.Snapshot{} }
+	cfg := quotaConfig{MaxUpcoming: 3, MaxPerHour: 4}
+	q := newQuotaTracker()
+
+	first, err := q.reserve(cfg, anna, empty, 2, now)
+	if err != nil || first.limit != 2 {
+		t.Fatalf("first reserve = %+v, %v; want 2", first, err)
+	}
+	// A concurrent request only gets what the first one left.
+	second, err := q.reserve(cfg, anna, empty, 5, now)
+	if err != nil || second.limit != 1 {
+		t.Fatalf("second reserve = %+v, %v; want 1", second, err)
+	}
+	if _, err := q.reserve(cfg, anna, empty, 1, now); commandStatus(err) != http.StatusTooManyRequests {
+		t.Fatalf("third reserve err = %v, want a 429 while the allowance is held", err)
+	}
+
+	// The first request queued one track, which the snapshot does not show
+	// yet; the unused track goes back to the hourly allowance.
+	queued := resolver.Track{ID: "a", Source: resolver.SourceYouTube, RequesterID: "anna"}
+	q.release(first, []resolver.Track{queued}, now)
+	q.release(second, nil, now)
+	if got := q.recent("anna", now); got != 1 {
+		t.Errorf("recent = %d, want only the queued track", got)
+	}
+	if got, err := q.allowance(cfg, anna, empty(), now); err != nil || got != 2 {
+		t.Errorf("allowance = %d, %v; want 2 while the queued track settles", got, err)
+	}
+
+	shown := player.Snapshot{
+		Queue:    []player.QueueItem{{Metadata: &queued}},
+		Upcoming: []player.QueueItem{{Metadata: &queued}},
+	}
+	if got, err := q.allowance(cfg, anna, shown, now); err != nil || got != 2 {
+		t.Errorf("allowance = %d, %v; want the track counted once", got, err)
+	}
+	if got, err := q.allowance(cfg, anna, empty(), now.Add(quotaSettle)); err != nil || got != 3 {
+		t.Errorf("allowance = %d, %v; want 3 once settled", got, err)
+	}
+}
+
+func TestQueue_QuotaReached(t *testing.T) {
+	s, _ := setupPlayingServer(t, duplicatesAllow)
+	s.quotas = quotaConfig{MaxPerHour: 1}
+	anna := requester{Guest: Guest{ID: "anna", Nickname: "Anna"}}
+	s.quotaUsage.record(anna.ID, 1, time.Now())
+
+	_, err := s.queue(context.Background(), duplicateHit(), anna)
+	if commandStatus(err) != http.StatusTooManyRequests {
+		t.Fatalf("err = %v, want %d", err, http.StatusTooManyRequests)
+	}
+	if err.Error() != "You can add 1 tracks per hour" {
+		t.Errorf("message = %q", err.Error())
+	}
+}
+
+func TestUpload_QuotaReached(t *testing.T) {
+	s, _ := setupPlayingServer(t, duplicatesAllow)
+	s.quotas = quotaConfig{MaxPerHour: 1}
+	req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(""))
+	s.quotaUsage.record(s.requesterFor(req).ID, 1, time.Now())
+
+	rr := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("Status = %d, want %d", rr.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestQuotaTracker_CapsAddress(t *testing.T) {
+	now := time.Date(2026, 3, 2, 20, 0, 0, 0, time.UTC)
+	cfg := quotaConfig{MaxUpcoming: 2}
+	anna := requester{Guest: Guest{ID: "anna"}, addr: "addr-1"}
+	ben := requester{Guest: Guest{ID: "ben"}, addr: "addr-1"}
+	cleo := requester{Guest: Guest{ID: "cleo"}, addr: "addr-2"}
+	q := newQuotaTracker()
+
+	res, err := q.reserve(cfg, anna, func() player.Snapshot { return player.Snapshot{} }, 2, now)
+	if err != nil {
+		t.Fatalf("reserve failed: %v", err)
+	}
+	queued := []resolver.Track{
+		{ID: "a", Source: resolver.SourceYouTube, RequesterID: "anna"},
+		{ID: "b", Source: resolver.SourceYouTube, RequesterID: "anna"},
+	}
+	q.release(res, queued, now)
+	snap := player.Snapshot{}
+	for i := range queued {
+		item := player.QueueItem{Metadata: &queued[i]}
+		snap.Queue = append(snap.Queue, item)
+		snap.Upcoming = append(snap.Upcoming, item)
+	}
+
+	// A new cookie from the same address does not bring a new allowance,
+	// even once the queued tracks have settled.
+	later := now.Add(time.Minute)
+	if _, err := q.allowance(cfg, ben, snap, later); commandStatus(err) != http.StatusTooManyRequests {
+		t.Errorf("allowance from the same address err = %v, want a 429", err)
+	}
+	if got, err := q.allowance(cfg, cleo, snap, later); err != nil || got != 2 {
+		t.Errorf("allowance from another address = %d, %v; want 2", got, err)
+	}
+	if got, err := q.allowance(cfg, ben, player.Snapshot{}, later); err != nil || got != 2 {
+		t.Errorf("allowance once the tracks played = %d, %v; want 2", got, err)
+	}
+}
+
+func TestUpload_ForgedCookieKeepsQuota(t *testing.T) {
+	s, _ := setupPlayingServer(t, duplicatesAllow)
+	s.quotas = quotaConfig{MaxPerHour: 1}
+	newRequest := func(cookie string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(""))
+		req.RemoteAddr = "10.0.0.7:4000"
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: guestCookieName, Value: cookie})
+		}
+		return req
+	}
+
+	first := newRequest(s.auth.signGuestToken("anna-token"))
+	res, err := s.quotaUsage.reserve(s.quotas, s.requesterFor(first), s.player.State.Snapshot, 1, time.Now())
+	if err != nil {
+		t.Fatalf("reserve failed: %v", err)
+	}
+	s.quotaUsage.release(res, []resolver.Track{{ID: "a", Source: resolver.SourceYouTube}}, time.Now())
+
+	for _, cookie := range []string{"", "forged-token", "forged-token.abcd", s.auth.signGuestToken("new-token")} {
+		rr := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rr, newRequest(cookie))
+		if rr.Code != http.StatusTooManyRequests {
+			t.Errorf("cookie %q: Status = %d, want %d", cookie, rr.Code, http.StatusTooManyRequests)
+		}
+	}
+}
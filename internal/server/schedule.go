@@ -0,0 +1,214 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/reuski/skaldi/internal/cron"
+	"github.com/reuski/skaldi/internal/player"
+	"github.com/reuski/skaldi/internal/resolver"
+)
+
+const (
+	scheduleCapVolume = "cap_volume"
+	schedulePlay      = "play"
+	schedulePause     = "pause"
+	scheduleClear     = "clear"
+
+	defaultClearCron = "0 0 * * *"
+
+	schedulePlayTimeout = 2 * time.Minute
+	// scheduleWindowSearch bounds how far ahead the start of a volume cap
+	// window is looked for.
+	scheduleWindowSearch = 7 * 24 * 60
+	maxUpcomingSchedule  = 20
+)
+
+type scheduleReport struct {
+	// VolumeCap is the limit in force right now, if any.
+	VolumeCap *float64          `json:"volume_cap,omitempty"`
+	Upcoming  []scheduledAction `json:"upcoming"`
+}
+
+type scheduledAction struct {
+	Name      string    `json:"name"`
+	Action    string    `json:"action"`
+	At        time.Time `json:"at"`
+	URL       string    `json:"url,omitempty"`
+	Playlist  string    `json:"playlist,omitempty"`
+	MaxVolume *float64  `json:"max_volume,omitempty"`
+}
+
+// runSchedule wakes at the start of every minute and fires the rules that
+// match it. A clear that finds music playing is retried each minute until
+// the room goes quiet.
+func (s *Server) runSchedule(ctx context.Context) {
+	pendingClear := false
+	for {
+		now := time.Now()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(now.Truncate(time.Minute).Add(time.Minute).Sub(now)):
+		}
+
+		minute := time.Now().Truncate(time.Minute)
+		s.enforceVolumeCap(minute)
+
+		for _, rule := range s.schedule.Rules {
+			if !rule.schedule.Matches(minute) {
+				continue
+			}
+			switch rule.Action {
+			case schedulePlay:
+				go s.schedulePlay(ctx, rule)
+			case schedulePause:
+				s.schedulePause(rule)
+			case scheduleClear:
+				pendingClear = true
+			}
+		}
+
+		if pendingClear && s.player.ClearIfIdle() {
+			pendingClear = false
+		}
+	}
+}
+
+func (s *Server) schedulePlay(ctx context.Context, rule scheduleRule) {
+	ctx, cancel := context.WithTimeout(ctx, schedulePlayTimeout)
+	defer cancel()
+
+	urls := []string{rule.URL}
+	if rule.Playlist != "" {
+		urls = s.schedule.Playlists[rule.Playlist]
+	}
+
+	var tracks []resolver.Track
+	for _, url := range urls {
+		resolved, err := s.resolver.Resolve(ctx, url)
+		if err != nil {
+			s.logger.Warn("Scheduled play could not resolve URL", "rule", rule.Name, "url", url, "error", err)
+			continue
+		}
+		tracks = append(tracks, resolved...)
+	}
+
+	queued := s.queueTracks(tracks, unlimitedQuota).queued
+	if len(queued) == 0 {
+		s.logger.Warn("Scheduled play queued nothing", "rule", rule.Name)
+		return
+	}
+	if _, err := s.player.Exec("set_property", "pause", false); err != nil {
+		s.logger.Warn("Scheduled play could not resume playback", "rule", rule.Name, "error", err)
+	}
+	s.logger.Info("Scheduled play queued tracks", "rule", rule.Name, "tracks", len(queued))
+}
+
+// schedulePause only pauses a track that is playing. Pausing an idle mpv
+// would leave the next queued track paused as well.
+func (s *Server) schedulePause(rule scheduleRule) {
+	if s.player.State.Snapshot().Status != player.StatusPlaying {
+		return
+	}
+	s.logger.Info("Scheduled pause", "rule", rule.Name)
+	if _, err := s.player.Exec("set_property", "pause", true); err != nil {
+		s.logger.Warn("Scheduled pause failed", "rule", rule.Name, "error", err)
+	}
+}
+
+// volumeCap returns the lowest max_volume among cap rules matching t.
+func (s *Server) volumeCap(t time.Time) (float64, bool) {
+	limit, capped := 100.0, false
+	for _, rule := range s.schedule.Rules {
+		if rule.Action == scheduleCapVolume && rule.schedule.Matches(t) {
+			limit = min(limit, rule.MaxVolume)
+			capped = true
+		}
+	}
+	return limit, capped
+}
+
+func (s *Server) enforceVolumeCap(t time.Time) {
+	limit, capped := s.volumeCap(t)
+	if !capped || s.player.State.Snapshot().Volume <= limit {
+		return
+	}
+	s.logger.Info("Lowering volume for quiet hours", "max_volume", limit)
+	if _, err := s.player.Exec("set_property", "volume", limit); err != nil {
+		s.logger.Warn("Failed to cap volume", "error", err)
+	}
+}
+
+func (s *Server) handleSchedule(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	report := scheduleReport{Upcoming: upcomingSchedule(s.schedule.Rules, now)}
+	if limit, capped := s.volumeCap(now); capped {
+		report.VolumeCap = &limit
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+// upcomingSchedule lists the next time each rule fires, soonest first. A
+// volume cap is listed at the start of its next window, since it matches
+// every minute inside one.
+func upcomingSchedule(rules []scheduleRule, now time.Time) []scheduledAction {
+	upcoming := make([]scheduledAction, 0, len(rules))
+	for _, rule := range rules {
+		at := rule.schedule.Next(now)
+		if rule.Action == scheduleCapVolume {
+			at = windowStart(rule.schedule, now)
+		}
+		if at.IsZero() {
+			continue
+		}
+
+		action := scheduledAction{
+			Name:     rule.Name,
+			Action:   rule.Action,
+			At:       at,
+			URL:      rule.URL,
+			Playlist: rule.Playlist,
+		}
+		if rule.Action == scheduleCapVolume {
+			action.MaxVolume = &rule.MaxVolume
+		}
+		upcoming = append(upcoming, action)
+	}
+
+	slices.SortStableFunc(upcoming, func(a, b scheduledAction) int {
+		return a.At.Compare(b.At)
+	})
+	if len(upcoming) > maxUpcomingSchedule {
+		upcoming = upcoming[:maxUpcomingSchedule]
+	}
+	return upcoming
+}
+
+// windowStart returns the next matching minute after now whose previous
+// minute does not match.
+func windowStart(sched cron.Schedule, now time.Time) time.Time {
+	t := now
+	for range scheduleWindowSearch {
+		t = sched.Next(t)
+		if t.IsZero() || !sched.Matches(t.Add(-time.Minute)) {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// clampToCap keeps a requested volume inside any quiet-hours cap.
+func (s *Server) clampToCap(volume float64) float64 {
+	if limit, capped := s.volumeCap(time.Now()); capped && volume > limit {
+		return limit
+	}
+	return volume
+}
@@ -0,0 +1,102 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testScheduleRules(t *testing.T, rules ...scheduleRule) scheduleConfig {
+	t.Helper()
+	cfg, err := normalizeScheduleConfig(scheduleConfig{
+		Playlists: map[string][]string{"morning": {"https://example.com/a"}},
+		Rules:     rules,
+	})
+	if err != nil {
+		t.Fatalf("normalizeScheduleConfig failed: %v", err)
+	}
+	return cfg
+}
+
+func TestServer_VolumeCap(t *testing.T) {
+	s := &Server{schedule: testScheduleRules(t,
+		scheduleRule{Cron: "* 22-23,0-6 * * *", Action: scheduleCapVolume, MaxVolume: 40},
+		scheduleRule{Cron: "* 0-6 * * *", Action: scheduleCapVolume, MaxVolume: 20},
+	)}
+
+	tests := []struct {
+		hour       int
+		wantCapped bool
+		want       float64
+	}{
+		{hour: 12, wantCapped: false, want: 100},
+		{hour: 22, wantCapped: true, want: 40},
+		{hour: 3, wantCapped: true, want: 20},
+	}
+
+	for _, tt := range tests {
+		got, capped := s.volumeCap(time.Date(2026, 3, 2, tt.hour, 30, 0, 0, time.Local))
+		if capped != tt.wantCapped || got != tt.want {
+			t.Errorf("volumeCap(%d:30) = %v, %v, want %v, %v", tt.hour, got, capped, tt.want, tt.wantCapped)
+		}
+	}
+}
+
+func TestUpcomingSchedule(t *testing.T) {
+	cfg := testScheduleRules(t,
+		scheduleRule{Name: "quiet", Cron: "* 22-23,0-6 * * *", Action: scheduleCapVolume, MaxVolume: 30},
+		scheduleRule{Name: "alarm", Cron: "30 7 * * *", Action: schedulePlay, Playlist: "morning"},
+		scheduleRule{Name: "closing", Cron: "0 23 * * *", Action: schedulePause},
+	)
+	now := time.Date(2026, 3, 2, 22, 45, 0, 0, time.Local)
+
+	got := upcomingSchedule(cfg.Rules, now)
+
+	want := []struct {
+		name string
+		at   time.Time
+	}{
+		{name: "closing", at: time.Date(2026, 3, 2, 23, 0, 0, 0, time.Local)},
+		{name: "daily clear", at: time.Date(2026, 3, 3, 0, 0, 0, 0, time.Local)},
+		{name: "alarm", at: time.Date(2026, 3, 3, 7, 30, 0, 0, time.Local)},
+		{name: "quiet", at: time.Date(2026, 3, 3, 22, 0, 0, 0, time.Local)},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("upcomingSchedule returned %d actions, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		if got[i].Name != w.name || !got[i].At.Equal(w.at) {
+			t.Errorf("upcoming[%d] = %s at %v, want %s at %v", i, got[i].Name, got[i].At, w.name, w.at)
+		}
+	}
+	if got[3].MaxVolume == nil || *got[3].MaxVolume != 30 {
+		t.Errorf("quiet max_volume = %v, want 30", got[3].MaxVolume)
+	}
+}
+
+func TestHandleSchedule(t *testing.T) {
+	s, _ := setupTestServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/schedule", nil)
+	rr := httptest.NewRecorder()
+
+	s.handleSchedule(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	var report scheduleReport
+	if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+		t.Fatalf("failed to decode report: %v", err)
+	}
+	if len(report.Upcoming) != 1 || report.Upcoming[0].Action != scheduleClear {
+		t.Errorf("Upcoming = %+v, want the default midnight clear", report.Upcoming)
+	}
+	if report.VolumeCap != nil {
+		t.Errorf("VolumeCap = %v, want none", *report.VolumeCap)
+	}
+}
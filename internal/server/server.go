@@ -5,74 +5,200 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
+	"path/filepath"
+	"strconv"
 	"time"
 
+	"github.com/reuski/skaldi/internal/bootstrap"
+	"github.com/reuski/skaldi/internal/discovery"
 	"github.com/reuski/skaldi/internal/player"
 	"github.com/reuski/skaldi/internal/resolver"
 )
 
 type Server struct {
 	server      *http.Server
+	cfg         *bootstrap.Config
 	logger      *slog.Logger
 	player      *player.Manager
 	resolver    *resolver.Resolver
 	indexHTML   []byte
 	broadcaster *Broadcaster
+	auth        *Authenticator
+	listen      listenConfig
+	autoplay    autoplayConfig
+	schedule    scheduleConfig
+	duplicates  duplicatesConfig
+	quotas      quotaConfig
+	quotaUsage  *quotaTracker
+
+	background     context.Context
+	stopBackground context.CancelFunc
 }
 
-func New(logger *slog.Logger, p *player.Manager, r *resolver.Resolver, indexHTML []byte, port int) *Server {
+func New(cfg *bootstrap.Config, logger *slog.Logger, p *player.Manager, r *resolver.Resolver, indexHTML []byte, opts ListenOptions) (*Server, error) {
+	var appCfg appConfig
+	if cfg != nil {
+		loaded, err := loadAppConfig(cfg.ConfigPath)
+		if err != nil {
+			return nil, err
+		}
+		appCfg = loaded
+	}
+
+	appCfg, err := appCfg.normalize(opts)
+	if err != nil {
+		return nil, err
+	}
+	guestKeyPath := ""
+	if cfg != nil && cfg.StateDir != "" {
+		guestKeyPath = cfg.GuestKeyPath()
+	}
+	guestKey, err := loadGuestKey(guestKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	listen := appCfg.Listen
+
+	var tlsCfg *tls.Config
+	if listen.TLS.SelfSigned {
+		if cfg == nil {
+			return nil, fmt.Errorf("listen config: self-signed tls requires a cache directory")
+		}
+		listen.TLS.CertFile, listen.TLS.KeyFile, err = ensureSelfSignedCert(filepath.Join(cfg.CacheDir, "tls"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if listen.TLS.CertFile != "" {
+		pair, err := tls.LoadX509KeyPair(listen.TLS.CertFile, listen.TLS.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load tls certificate: %w", err)
+		}
+		tlsCfg = &tls.Config{
+			Certificates: []tls.Certificate{pair},
+			MinVersion:   tls.VersionTLS12,
+		}
+	}
+
 	mux := http.NewServeMux()
+	background, stopBackground := context.WithCancel(context.Background())
 
 	s := &Server{
+		cfg:         cfg,
 		logger:      logger,
 		player:      p,
 		resolver:    r,
 		indexHTML:   indexHTML,
 		broadcaster: NewBroadcaster(p.StateUpdates),
+		auth:        NewAuthenticator(appCfg.Auth, guestKey),
+		listen:      listen,
+		autoplay:    appCfg.Autoplay,
+		schedule:    appCfg.Schedule,
+		duplicates:  appCfg.Duplicates,
+		quotas:      appCfg.Quotas,
+		quotaUsage:  newQuotaTracker(),
+
+		background:     background,
+		stopBackground: stopBackground,
 		server: &http.Server{
-			Addr:              fmt.Sprintf(":%d", port),
+			Addr:              net.JoinHostPort(listen.Address, strconv.Itoa(listen.Port)),
+			TLSConfig:         tlsCfg,
 			ReadHeaderTimeout: 10 * time.Second,
 		},
 	}
 
 	mux.HandleFunc("GET /", s.handleIndex)
 	mux.HandleFunc("GET /search", s.handleSearch)
+	mux.HandleFunc("GET /browse", s.handleBrowse)
 	mux.HandleFunc("POST /queue", s.handleQueue)
-	mux.HandleFunc("POST /queue/move", s.handleMove)
-	mux.HandleFunc("POST /playback", s.handlePlayback)
-	mux.HandleFunc("DELETE /queue/{index}", s.handleRemove)
+	mux.HandleFunc("POST /queue/move", s.requireHost(s.handleMove))
+	mux.HandleFunc("POST /playback", s.requireHost(s.handlePlayback))
+	mux.HandleFunc("GET /audio/devices", s.requireHost(s.handleAudioDevices))
+	mux.HandleFunc("DELETE /queue/{index}", s.requireHost(s.handleRemove))
 	mux.HandleFunc("GET /events", s.handleEvents)
-	mux.HandleFunc("POST /upload", s.handleUpload)
+	mux.HandleFunc("GET /ws", s.handleWebSocket)
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
+	mux.HandleFunc("GET /schedule", s.handleSchedule)
+	mux.HandleFunc("GET /healthz", s.handleHealthz)
+	mux.HandleFunc("GET /readyz", s.handleReadyz)
+	mux.HandleFunc("POST /upload", s.requireHost(s.handleUpload))
+	mux.HandleFunc("GET /auth/session", s.handleSession)
+	mux.HandleFunc("POST /auth/login", s.handleLogin)
+	mux.HandleFunc("POST /auth/logout", s.handleLogout)
+	mux.HandleFunc("POST /auth/nickname", s.handleNickname)
 
 	s.server.Handler = mux
 
-	return s
+	return s, nil
 }
 
 func (s *Server) Start(mdnsActive bool) error {
 	go s.broadcaster.Run()
+	go s.forwardNotices()
+	go s.runAutoplay()
+	go s.runSchedule(s.background)
 
 	s.printReadyMessage(mdnsActive)
 
-	if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	var err error
+	if s.TLSEnabled() {
+		err = s.server.ListenAndServeTLS("", "")
+	} else {
+		err = s.server.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
 		return err
 	}
 	return nil
 }
 
+func (s *Server) Port() int {
+	return s.listen.Port
+}
+
+func (s *Server) TLSEnabled() bool {
+	return s.server.TLSConfig != nil
+}
+
+// LANVisible reports whether the server accepts connections from other
+// machines, which is what makes an mDNS advertisement worthwhile.
+func (s *Server) LANVisible() bool {
+	ip := net.ParseIP(s.listen.Address)
+	return ip == nil || !ip.IsLoopback()
+}
+
+func (s *Server) url(host string) string {
+	scheme := "http"
+	if s.TLSEnabled() {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, strconv.Itoa(s.listen.Port)))
+}
+
+func (s *Server) forwardNotices() {
+	for notice := range s.player.Notices {
+		s.broadcaster.Notify("notice", notice)
+	}
+}
+
 func (s *Server) Shutdown(ctx context.Context) error {
+	s.stopBackground()
 	return s.server.Shutdown(ctx)
 }
 
 func (s *Server) printReadyMessage(mdnsActive bool) {
-	port := s.server.Addr
-
 	if mdnsActive {
-		s.logger.Info(fmt.Sprintf("http://skaldi.local%s", port))
+		s.logger.Info(s.url(discovery.Hostname + ".local"))
+	}
+
+	if ip := net.ParseIP(s.listen.Address); ip != nil && !ip.IsUnspecified() {
+		s.logger.Info(fmt.Sprintf("Skaldi ready at %s", s.url(ip.String())))
+		return
 	}
 
 	ifaces, err := net.Interfaces()
@@ -97,7 +223,7 @@ func (s *Server) printReadyMessage(mdnsActive bool) {
 				continue
 			}
 
-			msg := fmt.Sprintf("http://%s%s", ip.String(), port)
+			msg := s.url(ip.String())
 			if mdnsActive {
 				s.logger.Debug("Also available at", "url", msg)
 			} else {
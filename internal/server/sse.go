@@ -9,12 +9,41 @@ import (
 	"sync"
 	"time"
 
+	"github.com/reuski/skaldi/internal/metrics"
 	"github.com/reuski/skaldi/internal/player"
 )
 
+var (
+	streamClients = metrics.NewGauge("skaldi_stream_clients",
+		"Connected state stream clients.", "transport")
+	broadcastSnapshots = metrics.NewCounter("skaldi_broadcast_snapshots_total",
+		"Player snapshots received by the broadcaster.")
+	broadcastMessages = metrics.NewCounter("skaldi_broadcast_messages_total",
+		"Messages queued for stream clients.", "kind")
+	broadcastDropped = metrics.NewCounter("skaldi_broadcast_dropped_total",
+		"Messages dropped because a stream client was not keeping up.", "kind")
+)
+
 type client struct {
-	ch       chan []byte
-	lastSnap player.Snapshot
+	ch        chan []byte
+	lastSnap  player.Snapshot
+	transport transport
+}
+
+// transport names a stream protocol and wraps JSON payloads for it. An
+// empty event marks a state snapshot or delta.
+type transport struct {
+	name  string
+	frame func(event string, data []byte) []byte
+}
+
+var sseTransport = transport{name: "sse", frame: sseFrame}
+
+func sseFrame(event string, data []byte) []byte {
+	if event == "" {
+		return fmt.Appendf(nil, "data: %s\n\n", data)
+	}
+	return fmt.Appendf(nil, "event: %s\ndata: %s\n\n", event, data)
 }
 
 type Broadcaster struct {
@@ -33,6 +62,7 @@ func NewBroadcaster(updates <-chan player.Snapshot) *Broadcaster {
 
 func (b *Broadcaster) Run() {
 	for snap := range b.updates {
+		broadcastSnapshots.Inc()
 		b.clientsMu.Lock()
 		b.lastSnap = snap
 
@@ -44,7 +74,9 @@ func (b *Broadcaster) Run() {
 			var payload []byte
 			var err error
 
+			kind := "snapshot"
 			if delta := player.ComputeDelta(c.lastSnap, snap); delta != nil {
+				kind = "delta"
 				payload, err = json.Marshal(delta)
 			} else {
 				payload, err = json.Marshal(snap)
@@ -54,23 +86,47 @@ func (b *Broadcaster) Run() {
 				continue
 			}
 
-			msg := fmt.Appendf(nil, "data: %s\n\n", payload)
+			msg := c.transport.frame("", payload)
 			select {
 			case c.ch <- msg:
 				c.lastSnap = snap
+				broadcastMessages.Inc(kind)
 			default:
+				broadcastDropped.Inc(kind)
 			}
 		}
 		b.clientsMu.Unlock()
 	}
 }
 
+func (b *Broadcaster) Notify(event string, payload any) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	b.clientsMu.Lock()
+	for c := range b.clients {
+		select {
+		case c.ch <- c.transport.frame(event, data):
+			broadcastMessages.Inc("event")
+		default:
+			broadcastDropped.Inc("event")
+		}
+	}
+	b.clientsMu.Unlock()
+}
+
 func (b *Broadcaster) AddClient(initialSnap player.Snapshot) chan []byte {
+	return b.addClient(initialSnap, sseTransport)
+}
+
+func (b *Broadcaster) addClient(initialSnap player.Snapshot, t transport) chan []byte {
 	ch := make(chan []byte, 10)
 	b.clientsMu.Lock()
-	c := &client{ch: ch, lastSnap: initialSnap}
+	c := &client{ch: ch, lastSnap: initialSnap, transport: t}
 	b.clients[c] = struct{}{}
 	b.clientsMu.Unlock()
+	streamClients.Inc(t.name)
 	return ch
 }
 
@@ -80,6 +136,7 @@ func (b *Broadcaster) RemoveClient(ch chan []byte) {
 		if c.ch == ch {
 			delete(b.clients, c)
 			close(c.ch)
+			streamClients.Dec(c.transport.name)
 			break
 		}
 	}
@@ -99,6 +156,8 @@ func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	fmt.Fprintf(w, "retry: 3000\n")
+	sessionData, _ := json.Marshal(s.auth.SessionInfo(r))
+	fmt.Fprintf(w, "event: session\ndata: %s\n\n", sessionData)
 	initialSnap := s.player.State.Snapshot()
 	data, _ := json.Marshal(initialSnap)
 	fmt.Fprintf(w, "data: %s\n\n", data)
@@ -349,3 +349,46 @@ func TestSSEMessageFormat(t *testing.T) {
 		t.Error("Timeout waiting for message")
 	}
 }
+
+func TestBroadcaster_Notify(t *testing.T) {
+	updates := make(chan player.Snapshot, 10)
+	b := NewBroadcaster(updates)
+
+	clientCh := b.AddClient(player.Snapshot{})
+	defer b.RemoveClient(clientCh)
+
+	b.Notify("notice", player.Notice{Kind: player.NoticePlaybackRecovered, Message: "recovered"})
+
+	select {
+	case msg := <-clientCh:
+		want := `event: notice` + "\n" + `data: {"kind":"playback_recovered","message":"recovered"}` + "\n\n"
+		if string(msg) != want {
+			t.Errorf("message = %q, want %q", string(msg), want)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Error("Timeout waiting for notice")
+	}
+}
+
+func TestBroadcaster_CountsClientsAndDrops(t *testing.T) {
+	b := NewBroadcaster(make(chan player.Snapshot))
+	clients := streamClients.Value("sse")
+	dropped := broadcastDropped.Value("event")
+
+	ch := b.AddClient(player.Snapshot{})
+	if got := streamClients.Value("sse") - clients; got != 1 {
+		t.Errorf("sse clients = %v, want 1 more", got)
+	}
+
+	for range cap(ch) + 2 {
+		b.Notify("notice", map[string]string{"message": "hi"})
+	}
+	if got := broadcastDropped.Value("event") - dropped; got != 2 {
+		t.Errorf("dropped = %v, want 2", got)
+	}
+
+	b.RemoveClient(ch)
+	if got := streamClients.Value("sse"); got != clients {
+		t.Errorf("sse clients = %v after removal, want %v", got, clients)
+	}
+}
@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/reuski/skaldi/internal/bootstrap"
+	"github.com/reuski/skaldi/internal/player"
+	"github.com/reuski/skaldi/internal/resolver"
+)
+
+func TestEnsureSelfSignedCert(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "tls")
+
+	certPath, keyPath, err := ensureSelfSignedCert(dir)
+	if err != nil {
+		t.Fatalf("ensureSelfSignedCert failed: %v", err)
+	}
+	if !selfSignedCertValid(certPath, keyPath, time.Now()) {
+		t.Fatal("generated certificate should be valid")
+	}
+	if selfSignedCertValid(certPath, keyPath, time.Now().Add(selfSignedValidity)) {
+		t.Error("certificate should need renewal near expiry")
+	}
+
+	info, err := os.Stat(keyPath)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("key mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	before, _ := os.ReadFile(certPath)
+	if _, _, err := ensureSelfSignedCert(dir); err != nil {
+		t.Fatalf("second ensureSelfSignedCert failed: %v", err)
+	}
+	after, _ := os.ReadFile(certPath)
+	if string(before) != string(after) {
+		t.Error("valid certificate should be reused")
+	}
+}
+
+func TestNew_SelfSignedTLS(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &bootstrap.Config{
+		CacheDir:   t.TempDir(),
+		MpvSocket:  filepath.Join(t.TempDir(), "mpv.sock"),
+		ConfigPath: filepath.Join(t.TempDir(), "config.json"),
+	}
+	if err := os.WriteFile(cfg.ConfigPath, []byte(`{"listen":{"address":"127.0.0.1","port":9443,"tls":{"self_signed":true}}}`), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	p := player.NewManager(cfg, logger)
+	r, err := resolver.New(cfg)
+	if err != nil {
+		t.Fatalf("resolver.New failed: %v", err)
+	}
+	s, err := New(cfg, logger, p, r, nil, ListenOptions{})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	if !s.TLSEnabled() {
+		t.Error("TLS should be enabled")
+	}
+	if s.server.Addr != "127.0.0.1:9443" {
+		t.Errorf("Addr = %q, want 127.0.0.1:9443", s.server.Addr)
+	}
+	if got := s.url("skaldi.local"); got != "https://skaldi.local:9443" {
+		t.Errorf("url = %q, want https://skaldi.local:9443", got)
+	}
+	if s.LANVisible() {
+		t.Error("loopback listener should not be LAN visible")
+	}
+	if _, err := os.Stat(filepath.Join(cfg.CacheDir, "tls", "cert.pem")); err != nil {
+		t.Errorf("self-signed certificate not written: %v", err)
+	}
+}
@@ -0,0 +1,193 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	wsPingInterval = 15 * time.Second
+	wsReadTimeout  = 2 * wsPingInterval
+
+	// wsMaxConcurrentQueue bounds the queue commands a single connection
+	// can have resolving at once.
+	wsMaxConcurrentQueue = 4
+)
+
+// wsCommand is a message sent by a WebSocket client. Data holds a
+// QueueRequest, PlaybackRequest or MoveRequest depending on Type.
+type wsCommand struct {
+	ID   int64           `json:"id"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+type wsEvent struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+type wsAck struct {
+	Type   string `json:"type"`
+	ID     int64  `json:"id"`
+	OK     bool   `json:"ok"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Result any    `json:"result,omitempty"`
+}
+
+var wsTransport = transport{name: "websocket", frame: wsFrame}
+
+func wsFrame(event string, data []byte) []byte {
+	if event == "" {
+		event = "state"
+	}
+	msg, _ := json.Marshal(wsEvent{Type: event, Data: data})
+	return msg
+}
+
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgradeWebSocket(w, r)
+	if err != nil {
+		s.logger.Debug("WebSocket upgrade failed", "remote", r.RemoteAddr, "error", err)
+		return
+	}
+	ws.readTimeout = wsReadTimeout
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer ws.Close(wsCloseNormal, "")
+
+	sessionData, _ := json.Marshal(s.auth.SessionInfo(r))
+	initialSnap := s.player.State.Snapshot()
+	snapData, _ := json.Marshal(initialSnap)
+	if ws.WriteText(wsFrame("session", sessionData)) != nil || ws.WriteText(wsFrame("", snapData)) != nil {
+		return
+	}
+
+	clientCh := s.broadcaster.addClient(initialSnap, wsTransport)
+	defer s.broadcaster.RemoveClient(clientCh)
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(done)
+		s.readCommands(ctx, ws, r, &wg)
+	}()
+
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if ws.Ping() != nil {
+				return
+			}
+		case msg, ok := <-clientCh:
+			if !ok {
+				return
+			}
+			if ws.WriteText(msg) != nil {
+				return
+			}
+		}
+	}
+}
+
+// readCommands runs commands until the connection fails. Playback and move
+// commands run in order; queue commands may wait on a resolve, so they run
+// alongside and acknowledge whenever they finish. The role is checked per
+// command, so a logout or an expired session applies to open connections.
+func (s *Server) readCommands(ctx context.Context, ws *wsConn, r *http.Request, wg *sync.WaitGroup) {
+	sem := make(chan struct{}, wsMaxConcurrentQueue)
+
+	for {
+		msg, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var cmd wsCommand
+		if err := json.Unmarshal(msg, &cmd); err != nil {
+			writeAck(ws, cmd.ID, nil, newCommandError(http.StatusBadRequest, "Invalid message"))
+			continue
+		}
+
+		if cmd.Type != "queue" {
+			result, err := s.runCommand(ctx, r, cmd)
+			writeAck(ws, cmd.ID, result, err)
+			continue
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			result, err := s.runCommand(ctx, r, cmd)
+			writeAck(ws, cmd.ID, result, err)
+		}()
+	}
+}
+
+func (s *Server) runCommand(ctx context.Context, r *http.Request, cmd wsCommand) (any, error) {
+	switch cmd.Type {
+	case "queue":
+		var req QueueRequest
+		if err := json.Unmarshal(cmd.Data, &req); err != nil {
+			return nil, newCommandError(http.StatusBadRequest, "Invalid request body")
+		}
+		return s.queue(ctx, req, s.requesterFor(r))
+	case "playback":
+		if s.auth.RoleFor(r) != RoleHost {
+			return nil, newCommandError(http.StatusForbidden, "Host access required")
+		}
+		var req PlaybackRequest
+		if err := json.Unmarshal(cmd.Data, &req); err != nil {
+			return nil, newCommandError(http.StatusBadRequest, "Invalid request body")
+		}
+		return nil, s.playback(req)
+	case "move":
+		if s.auth.RoleFor(r) != RoleHost {
+			return nil, newCommandError(http.StatusForbidden, "Host access required")
+		}
+		var req MoveRequest
+		if err := json.Unmarshal(cmd.Data, &req); err != nil {
+			return nil, newCommandError(http.StatusBadRequest, "Invalid request body")
+		}
+		return nil, s.move(req)
+	default:
+		return nil, newCommandError(http.StatusBadRequest, "Unknown command type")
+	}
+}
+
+func writeAck(ws *wsConn, id int64, result any, err error) {
+	ack := wsAck{Type: "ack", ID: id, OK: err == nil, Status: http.StatusOK, Result: result}
+	if err != nil {
+		ack.Status = commandStatus(err)
+		ack.Error = err.Error()
+		ack.Result = nil
+	}
+
+	data, marshalErr := json.Marshal(ack)
+	if marshalErr != nil {
+		return
+	}
+	_ = ws.WriteText(data)
+}
@@ -0,0 +1,371 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeClientFrame(t *testing.T, w io.Writer, opcode byte, fin bool, payload []byte) {
+	t.Helper()
+
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, 0x80|byte(n))
+	default:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	}
+
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := w.Write(frame); err != nil {
+		t.Errorf("write frame: %v", err)
+	}
+}
+
+func readServerFrame(t *testing.T, r io.Reader) (byte, []byte) {
+	t.Helper()
+
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		t.Errorf("read frame header: %v", err)
+		return 0, nil
+	}
+	if header[1]&0x80 != 0 {
+		t.Error("server frames must not be masked")
+	}
+	length := int(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		_, _ = io.ReadFull(r, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		_, _ = io.ReadFull(r, ext[:])
+		length = int(binary.BigEndian.Uint64(ext[:]))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Errorf("read frame payload: %v", err)
+	}
+	return header[0] & 0x0F, payload
+}
+
+func newPipeWSConn(t *testing.T) (*wsConn, net.Conn) {
+	t.Helper()
+	server, client := net.Pipe()
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+	return &wsConn{conn: server, br: bufio.NewReader(server)}, client
+}
+
+func TestWSAcceptKey(t *testing.T) {
+	// Example handshake from RFC 6455, section 1.3.
+	if got := wsAcceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("wsAcceptKey = %q", got)
+	}
+}
+
+func TestWSConn_ReadMessageReassemblesFragmentsAndAnswersPing(t *testing.T) {
+	ws, client := newPipeWSConn(t)
+
+	go func() {
+		writeClientFrame(t, client, wsOpText, false, []byte(`{"type":`))
+		writeClientFrame(t, client, wsOpPing, true, []byte("hi"))
+		writeClientFrame(t, client, wsOpContinuation, true, []byte(`"move"}`))
+	}()
+
+	pong := make(chan []byte, 1)
+	go func() {
+		opcode, payload := readServerFrame(t, client)
+		if opcode != wsOpPong {
+			t.Errorf("opcode = %d, want pong", opcode)
+		}
+		pong <- payload
+	}()
+
+	msg, err := ws.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage failed: %v", err)
+	}
+	if string(msg) != `{"type":"move"}` {
+		t.Errorf("message = %q", msg)
+	}
+	if got := <-pong; string(got) != "hi" {
+		t.Errorf("pong payload = %q, want hi", got)
+	}
+}
+
+func TestWSConn_ReadMessageRejectsProtocolErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		send     func(t *testing.T, w io.Writer)
+		wantCode int
+	}{
+		{
+			name: "unmasked",
+			send: func(t *testing.T, w io.Writer) {
+				_, _ = w.Write([]byte{0x81, 0x01, 'x'})
+			},
+			wantCode: wsCloseProtocolError,
+		},
+		{
+			name: "binary",
+			send: func(t *testing.T, w io.Writer) {
+				writeClientFrame(t, w, wsOpBinary, true, []byte{1, 2})
+			},
+			wantCode: wsCloseUnsupportedData,
+		},
+		{
+			name: "stray_continuation",
+			send: func(t *testing.T, w io.Writer) {
+				writeClientFrame(t, w, wsOpContinuation, true, []byte("x"))
+			},
+			wantCode: wsCloseProtocolError,
+		},
+		{
+			name: "fragmented_ping",
+			send: func(t *testing.T, w io.Writer) {
+				writeClientFrame(t, w, wsOpPing, false, nil)
+			},
+			wantCode: wsCloseProtocolError,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ws, client := newPipeWSConn(t)
+
+			go tc.send(t, client)
+			closed := make(chan int, 1)
+			go func() {
+				opcode, payload := readServerFrame(t, client)
+				if opcode != wsOpClose || len(payload) < 2 {
+					closed <- -1
+					return
+				}
+				closed <- int(binary.BigEndian.Uint16(payload))
+			}()
+
+			var closeErr *wsCloseError
+			if _, err := ws.ReadMessage(); !errors.As(err, &closeErr) {
+				t.Fatalf("ReadMessage error = %v, want protocol error", err)
+			}
+			if got := <-closed; got != tc.wantCode {
+				t.Errorf("close code = %d, want %d", got, tc.wantCode)
+			}
+		})
+	}
+}
+
+func TestWSConn_ReadMessageEchoesClose(t *testing.T) {
+	ws, client := newPipeWSConn(t)
+
+	go writeClientFrame(t, client, wsOpClose, true, []byte{0x03, 0xE8, 'b', 'y', 'e'})
+	echoed := make(chan []byte, 1)
+	go func() {
+		_, payload := readServerFrame(t, client)
+		echoed <- payload
+	}()
+
+	if _, err := ws.ReadMessage(); !errors.Is(err, errWebSocketClosed) {
+		t.Fatalf("ReadMessage error = %v, want %v", err, errWebSocketClosed)
+	}
+	if got := <-echoed; string(got) != "\x03\xe8" {
+		t.Errorf("close payload = %q, want status 1000", got)
+	}
+}
+
+type wsTestClient struct {
+	t    *testing.T
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func dialWS(t *testing.T, srv *httptest.Server, header http.Header) (*wsTestClient, *http.Response) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/ws", nil)
+	req.Header.Set("Connection", "keep-alive, Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if err := req.Write(conn); err != nil {
+		t.Fatalf("write handshake: %v", err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatalf("read handshake: %v", err)
+	}
+	return &wsTestClient{t: t, conn: conn, br: br}, resp
+}
+
+func (c *wsTestClient) send(id int64, kind, data string) {
+	c.t.Helper()
+	writeClientFrame(c.t, c.conn, wsOpText, true, fmt.Appendf(nil, `{"id":%d,"type":%q,"data":%s}`, id, kind, data))
+}
+
+func (c *wsTestClient) next() map[string]json.RawMessage {
+	c.t.Helper()
+	for {
+		opcode, payload := readServerFrame(c.t, c.br)
+		if c.t.Failed() {
+			c.t.FailNow()
+		}
+		if opcode != wsOpText {
+			continue
+		}
+		var msg map[string]json.RawMessage
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			c.t.Fatalf("invalid message %q: %v", payload, err)
+		}
+		return msg
+	}
+}
+
+func (c *wsTestClient) ack() wsAck {
+	c.t.Helper()
+	for {
+		msg := c.next()
+		if string(msg["type"]) != `"ack"` {
+			continue
+		}
+		var ack wsAck
+		raw, _ := json.Marshal(msg)
+		_ = json.Unmarshal(raw, &ack)
+		return ack
+	}
+}
+
+func TestHandleWebSocket_Handshake(t *testing.T) {
+	s, _ := setupTestServer(t)
+	srv := httptest.NewServer(s.server.Handler)
+	defer srv.Close()
+
+	c, resp := dialWS(t, srv, nil)
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Status = %d, want %d", resp.StatusCode, http.StatusSwitchingProtocols)
+	}
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Sec-WebSocket-Accept = %q", got)
+	}
+
+	if msg := c.next(); string(msg["type"]) != `"session"` {
+		t.Errorf("first message type = %s, want session", msg["type"])
+	}
+	msg := c.next()
+	if string(msg["type"]) != `"state"` {
+		t.Fatalf("second message type = %s, want state", msg["type"])
+	}
+	if !strings.Contains(string(msg["data"]), `"current_index":-1`) {
+		t.Errorf("state data = %s, want an empty snapshot", msg["data"])
+	}
+}
+
+func TestHandleWebSocket_RejectsBadHandshake(t *testing.T) {
+	s, _ := setupTestServer(t)
+	srv := httptest.NewServer(s.server.Handler)
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{name: "cross_origin", header: http.Header{"Origin": {"http://evil.example"}}, want: http.StatusForbidden},
+		{name: "old_version", header: http.Header{"Sec-Websocket-Version": {"8"}}, want: http.StatusUpgradeRequired},
+		{name: "bad_key", header: http.Header{"Sec-Websocket-Key": {"short"}}, want: http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, resp := dialWS(t, srv, tc.header)
+			if resp.StatusCode != tc.want {
+				t.Errorf("Status = %d, want %d", resp.StatusCode, tc.want)
+			}
+		})
+	}
+}
+
+func TestHandleWebSocket_CommandAcks(t *testing.T) {
+	s, _ := setupTestServer(t)
+	srv := httptest.NewServer(s.server.Handler)
+	defer srv.Close()
+
+	c, _ := dialWS(t, srv, nil)
+
+	tests := []struct {
+		name       string
+		kind       string
+		data       string
+		wantStatus int
+	}{
+		{name: "invalid_action", kind: "playback", data: `{"action":"dance"}`, wantStatus: http.StatusBadRequest},
+		{name: "seek_idle", kind: "playback", data: `{"action":"seek","value":5}`, wantStatus: http.StatusConflict},
+		{name: "move_invalid", kind: "move", data: `{"from":-1,"to":0}`, wantStatus: http.StatusBadRequest},
+		{name: "queue_empty", kind: "queue", data: `{}`, wantStatus: http.StatusBadRequest},
+		{name: "unknown_type", kind: "remove", data: `{}`, wantStatus: http.StatusBadRequest},
+		{name: "invalid_data", kind: "move", data: `"nope"`, wantStatus: http.StatusBadRequest},
+	}
+
+	for i, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c.t = t
+			id := int64(i + 1)
+			c.send(id, tc.kind, tc.data)
+			ack := c.ack()
+			if ack.ID != id || ack.OK || ack.Status != tc.wantStatus {
+				t.Errorf("ack = %+v, want id %d, status %d", ack, id, tc.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHandleWebSocket_GuestCannotControlPlayback(t *testing.T) {
+	s := setupAuthServer(t)
+	srv := httptest.NewServer(s.server.Handler)
+	defer srv.Close()
+
+	c, _ := dialWS(t, srv, nil)
+	c.send(7, "playback", `{"action":"skip"}`)
+
+	ack := c.ack()
+	if ack.ID != 7 || ack.Status != http.StatusForbidden || ack.Error != "Host access required" {
+		t.Errorf("ack = %+v, want 403 host access required", ack)
+	}
+}